@@ -0,0 +1,168 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/samber/lo"
+
+	"go-doudou-rag/module-chat/dto"
+	"go-doudou-rag/module-chat/tokenizer"
+	kdto "go-doudou-rag/module-knowledge/dto"
+)
+
+const (
+	droppedDuplicate = "duplicate"
+	droppedBudget    = "budget"
+)
+
+// passage 提示词中的一段上下文，由同一文件同一页中序号连续的分块合并而成
+type passage struct {
+	// 排名最靠前的分块，Content 为合并后的内容
+	kdto.QueryResult
+	chunks []kdto.QueryResult
+	// 成员中最靠前的检索排名
+	rank int
+}
+
+// buildContext 把检索结果按排名去重、合并相邻分块后依次放进上下文，超出 maxTokens 时停止，
+// 返回放进上下文的段落和没有放进去的分块。maxTokens 小于等于 0 时不限制
+func buildContext(results []kdto.QueryResult, t tokenizer.Tokenizer, maxTokens int) (passages []passage, dropped []dto.DroppedChunk) {
+	ranked := make([]kdto.QueryResult, len(results))
+	copy(ranked, results)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return rankScore(ranked[i]) > rankScore(ranked[j])
+	})
+
+	// 多个知识库、同一文件的多个版本中可能检索到相同的内容
+	seen := make(map[string]struct{})
+	kept := make([]kdto.QueryResult, 0, len(ranked))
+	for _, item := range ranked {
+		key := strings.TrimSpace(item.Content)
+		if item.Type == "image" && item.Image != "" {
+			key = item.Image
+		}
+		if _, ok := seen[key]; ok {
+			dropped = append(dropped, newDroppedChunk(item, droppedDuplicate))
+			continue
+		}
+		seen[key] = struct{}{}
+		kept = append(kept, item)
+	}
+
+	merged := mergeNeighbours(kept)
+	used := 0
+	for i, item := range merged {
+		tokens := t.Count(fmt.Sprintf("[%d] %s\n", len(passages)+1, item.Content))
+		if maxTokens > 0 && used+tokens > maxTokens {
+			if len(passages) > 0 {
+				for _, rest := range merged[i:] {
+					dropped = append(dropped, lo.Map(rest.chunks, func(chunk kdto.QueryResult, index int) dto.DroppedChunk {
+						return newDroppedChunk(chunk, droppedBudget)
+					})...)
+				}
+				break
+			}
+			// 排名第一的段落本身就超出预算时截断，保证至少有一段上下文
+			item.Content = t.Truncate(item.Content, maxTokens-t.Count("[1] \n"))
+			tokens = maxTokens
+		}
+		used += tokens
+		passages = append(passages, item)
+	}
+
+	return passages, dropped
+}
+
+// mergeNeighbours 合并同一文件同一页中序号连续的文本分块，合并后的段落按成员中最靠前的排名排序。
+// 图片和没有序号的分块单独成段
+func mergeNeighbours(results []kdto.QueryResult) []passage {
+	type pageKey struct {
+		fileId uint
+		page   int
+	}
+	var passages []passage
+	groups := make(map[pageKey][]int)
+	var keys []pageKey
+	for rank, item := range results {
+		if item.Type == "image" || item.ChunkIndex < 0 || item.FileId == 0 {
+			passages = append(passages, passage{
+				QueryResult: item,
+				chunks:      []kdto.QueryResult{item},
+				rank:        rank,
+			})
+			continue
+		}
+		key := pageKey{item.FileId, item.Page}
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], rank)
+	}
+
+	for _, key := range keys {
+		ranks := groups[key]
+		sort.Slice(ranks, func(i, j int) bool {
+			return results[ranks[i]].ChunkIndex < results[ranks[j]].ChunkIndex
+		})
+		var current *passage
+		for _, rank := range ranks {
+			item := results[rank]
+			if current != nil && item.ChunkIndex == current.chunks[len(current.chunks)-1].ChunkIndex+1 {
+				current.Content = joinOverlap(current.Content, item.Content)
+				current.chunks = append(current.chunks, item)
+				if rank < current.rank {
+					content := current.Content
+					current.QueryResult = item
+					current.Content = content
+					current.rank = rank
+				}
+				continue
+			}
+			if current != nil {
+				passages = append(passages, *current)
+			}
+			current = &passage{
+				QueryResult: item,
+				chunks:      []kdto.QueryResult{item},
+				rank:        rank,
+			}
+		}
+		passages = append(passages, *current)
+	}
+
+	sort.SliceStable(passages, func(i, j int) bool {
+		return passages[i].rank < passages[j].rank
+	})
+	return passages
+}
+
+// joinOverlap 拼接相邻的两个分块，去掉分割时前一个分块末尾与后一个分块开头重叠的部分
+func joinOverlap(a, b string) string {
+	ra, rb := []rune(a), []rune(b)
+	for n := min(len(ra), len(rb)); n > 0; n-- {
+		if string(ra[len(ra)-n:]) == string(rb[:n]) {
+			return a + string(rb[n:])
+		}
+	}
+	return a + b
+}
+
+// rankScore 重排过时按重排得分，否则按检索得分
+func rankScore(item kdto.QueryResult) float32 {
+	if item.RerankScore != 0 {
+		return item.RerankScore
+	}
+	return item.Score
+}
+
+func newDroppedChunk(item kdto.QueryResult, reason string) dto.DroppedChunk {
+	return dto.DroppedChunk{
+		Id:       item.ID,
+		FileId:   item.FileId,
+		FileName: item.FileName,
+		Page:     item.Page,
+		Reason:   reason,
+	}
+}
@@ -0,0 +1,39 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"go-doudou-rag/module-chat/tokenizer"
+	kdto "go-doudou-rag/module-knowledge/dto"
+)
+
+func TestBuildContext(t *testing.T) {
+	results := []kdto.QueryResult{
+		{ID: "a2", FileId: 1, Page: 0, ChunkIndex: 2, Score: 0.9, Content: "超过部分自理。一类城市每天不超过五百元。"},
+		{ID: "b", FileId: 2, Page: 3, ChunkIndex: 0, Score: 0.8, Content: "会议室需要提前一天预约。"},
+		{ID: "a1", FileId: 1, Page: 0, ChunkIndex: 1, Score: 0.7, Content: "住宿费按城市分档报销，超过部分自理。"},
+		{ID: "c", FileId: 3, Page: 0, ChunkIndex: 0, Score: 0.6, Content: "会议室需要提前一天预约。"},
+		{ID: "d", FileId: 4, Page: 1, ChunkIndex: 5, Score: 0.5, Content: strings.Repeat("机房巡检", 20)},
+	}
+
+	passages, dropped := buildContext(results, tokenizer.Estimator{}, 60)
+
+	// 同一页相邻的分块按序号合并并去掉重叠部分，排名取成员中最靠前的
+	if len(passages) != 2 || passages[0].ID != "a2" || passages[1].ID != "b" {
+		t.Fatalf("passages = %+v", passages)
+	}
+	if passages[0].Content != "住宿费按城市分档报销，超过部分自理。一类城市每天不超过五百元。" {
+		t.Fatalf("merged content = %q", passages[0].Content)
+	}
+	if len(dropped) != 2 || dropped[0].Id != "c" || dropped[0].Reason != droppedDuplicate ||
+		dropped[1].Id != "d" || dropped[1].Reason != droppedBudget {
+		t.Fatalf("dropped = %+v", dropped)
+	}
+
+	// 排名第一的段落超出预算时截断
+	passages, _ = buildContext(results[4:], tokenizer.Estimator{}, 10)
+	if len(passages) != 1 || (tokenizer.Estimator{}).Count(passages[0].Content) > 10 {
+		t.Fatalf("passages = %+v", passages)
+	}
+}
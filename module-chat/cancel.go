@@ -0,0 +1,29 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+)
+
+const finishReasonCancelled = "cancelled"
+
+var (
+	// errChatCancelled 用户通过 PostChat_IdCancel 停止生成
+	errChatCancelled = errors.New("chat cancelled")
+	// errClientGone 客户端断开连接后没有在 ResumeTimeout 内重连
+	errClientGone = errors.New("client disconnected")
+)
+
+func (receiver *ModuleChatImpl) PostChat_IdCancel(ctx context.Context, id string) (err error) {
+	receiver.stream(ctx, id).cancel(errChatCancelled)
+	return nil
+}
+
+// newRequestID 没有经过请求ID中间件时生成请求ID，保证每个请求都可以被停止
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
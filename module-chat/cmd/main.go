@@ -1,22 +1,33 @@
 /**
 * Generated by go-doudou v2.5.9.
 * You can edit it as your need.
-*/
+ */
 package main
 
 import (
+	_ "go-doudou-rag/module-chat/plugin"
+	_ "go-doudou-rag/module-knowledge/plugin"
+
+	"github.com/unionj-cloud/go-doudou/v2/framework/plugin"
 	"github.com/unionj-cloud/go-doudou/v2/framework/rest"
-	service "go-doudou-rag/module-chat"
-    "go-doudou-rag/module-chat/config"
-	"go-doudou-rag/module-chat/transport/httpsrv"
+	"github.com/unionj-cloud/toolkit/zlogger"
 )
 
 func main() {
-	conf := config.LoadFromEnv()
-    svc := service.NewModuleChat(conf)
-	handler := httpsrv.NewModuleChatHandler(svc)
 	srv := rest.NewRestServer()
-	srv.AddRoutes(httpsrv.Routes(handler))
-	srv.AddRoutes(rest.DocRoutes(service.Oas))
+	plugins := plugin.GetServicePlugins()
+	for _, key := range plugins.Keys() {
+		value, _ := plugins.Get(key)
+		value.Initialize(srv, nil, nil)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			zlogger.Info().Msgf("Recovered. Error: %v\n", r)
+		}
+		for _, key := range plugins.Keys() {
+			value, _ := plugins.Get(key)
+			value.Close()
+		}
+	}()
 	srv.Run()
 }
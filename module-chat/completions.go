@@ -0,0 +1,350 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ascarter/requestid"
+	"github.com/samber/do"
+	"github.com/samber/lo"
+	"github.com/tmc/langchaingo/llms"
+	"github.com/unionj-cloud/toolkit/stringutils"
+	"github.com/unionj-cloud/toolkit/zlogger"
+
+	"go-doudou-rag/module-chat/contextutil"
+	"go-doudou-rag/module-chat/dto"
+	"go-doudou-rag/module-chat/internal/model"
+	"go-doudou-rag/module-chat/tokenizer"
+	know "go-doudou-rag/module-knowledge"
+	kdto "go-doudou-rag/module-knowledge/dto"
+	"go-doudou-rag/toolkit/llm"
+	"go-doudou-rag/toolkit/prompt"
+)
+
+const (
+	objectChatCompletion      = "chat.completion"
+	objectChatCompletionChunk = "chat.completion.chunk"
+)
+
+// openaiError OpenAI 格式的错误响应，兼容 OpenAI SDK 的错误解析
+type openaiError struct {
+	Error struct {
+		Message string `json:"message"`
+		Type    string `json:"type"`
+		Code    string `json:"code,omitempty"`
+	} `json:"error"`
+}
+
+func (receiver *ModuleChatImpl) GetV1Models(ctx context.Context) (object string, data []dto.OpenaiModel, err error) {
+	kbs, err := do.MustInvoke[know.ModuleKnowledge](nil).GetKb(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	data = lo.Map(kbs, func(item kdto.KbDTO, index int) dto.OpenaiModel {
+		var created int64
+		if createdAt, err := time.ParseInLocation(time.DateTime, item.CreatedAt, time.Local); err == nil {
+			created = createdAt.Unix()
+		}
+		return dto.OpenaiModel{
+			Id:      item.Name,
+			Object:  "model",
+			Created: created,
+			OwnedBy: receiver.completionLLM(item.Name),
+		}
+	})
+	return "list", data, nil
+}
+
+func (receiver *ModuleChatImpl) PostV1ChatCompletions(ctx context.Context, req dto.ChatCompletionReq) (err error) {
+	w, _ := contextutil.ResponseWriterFromContext(ctx)
+	requestID, _ := requestid.FromContext(ctx)
+	if stringutils.IsEmpty(requestID) {
+		requestID = newRequestID()
+	}
+
+	kb, ok := receiver.completionKb(ctx, req.Model)
+	if !ok {
+		writeOpenaiError(w, http.StatusNotFound, "invalid_request_error", "model_not_found",
+			fmt.Sprintf("The model `%s` does not exist", req.Model))
+		return
+	}
+	history, question := completionHistory(req.Messages)
+	if stringutils.IsEmpty(strings.TrimSpace(question)) {
+		writeOpenaiError(w, http.StatusBadRequest, "invalid_request_error", "",
+			"The last message must be a user message with text content")
+		return
+	}
+	if maxMessages := 2 * receiver.conf.Biz.History.MaxTurns; maxMessages > 0 && len(history) > maxMessages {
+		history = history[len(history)-maxMessages:]
+	}
+
+	out := &completionWriter{
+		w: w,
+		base: dto.ChatCompletion{
+			Id:      "chatcmpl-" + requestID,
+			Created: time.Now().Unix(),
+			Model:   req.Model,
+		},
+		stream:       req.Stream,
+		includeUsage: req.StreamOptions != nil && req.StreamOptions.IncludeUsage,
+	}
+	if req.Stream {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			writeOpenaiError(w, http.StatusInternalServerError, "server_error", "", "Streaming unsupported by client")
+			return
+		}
+		out.flusher = flusher
+	}
+
+	llmModel := receiver.completionLLM(kb.Name)
+	chatModel, err := receiver.llmProvider.New(llm.Options{
+		BaseUrl: receiver.conf.Openai.BaseUrl,
+		Token:   receiver.conf.Openai.Token,
+		Model:   llmModel,
+	})
+	if err != nil {
+		zlogger.Error().Err(err).Msgf("Create LLM failed, requestId: %s", requestID)
+		writeOpenaiError(w, http.StatusInternalServerError, "server_error", "", err.Error())
+		return
+	}
+
+	query := question
+	if len(history) > 0 && receiver.conf.Biz.History.RewriteQuery {
+		query = receiver.rewriteQuery(ctx, chatModel, history, question)
+	}
+	queryResults, err := receiver.retrieve(ctx, []uint{kb.Id}, nil, query)
+	if err != nil {
+		zlogger.Error().Err(err).Msgf("Query knowledge base failed, requestId: %s", requestID)
+		writeOpenaiError(w, http.StatusInternalServerError, "server_error", "", err.Error())
+		return
+	}
+	if len(queryResults) == 0 {
+		zlogger.Error().Msgf("Knowledge not found, requestId: %s", requestID)
+		out.start(nil)
+		_ = out.content(noKnowledgeAnswer)
+		out.finish(noKnowledgeAnswer, dto.Done{FinishReason: finishReasonStop})
+		return
+	}
+
+	t := tokenizer.For(llmModel)
+	passages, dropped := buildContext(queryResults, t, receiver.conf.Biz.Retrieval.MaxTokens)
+	if len(dropped) > 0 {
+		zlogger.Info().Msgf("Dropped %d of %d retrieved chunks, requestId: %s", len(dropped), len(queryResults), requestID)
+	}
+	sources := newSources(passages)
+	tpl := prompt.ForKb(ctx, kb.PromptTemplate)
+	messages, err := answerMessages(tpl, promptVars(ctx, question, passages, history), history)
+	if err != nil {
+		zlogger.Error().Err(err).Msgf("Render prompt template failed, requestId: %s", requestID)
+		writeOpenaiError(w, http.StatusInternalServerError, "server_error", "", err.Error())
+		return
+	}
+
+	opts := []llms.CallOption{
+		llms.WithMaxTokens(answerMaxTokens),
+		llms.WithTemperature(answerTemperature),
+	}
+	if req.MaxTokens > 0 {
+		opts = append(opts, llms.WithMaxTokens(req.MaxTokens))
+	}
+	if req.Temperature != nil {
+		opts = append(opts, llms.WithTemperature(*req.Temperature))
+	}
+	var answer strings.Builder
+	if req.Stream {
+		opts = append(opts, llms.WithStreamingFunc(func(ctx context.Context, chunk []byte) error {
+			answer.Write(chunk)
+			return out.content(string(chunk))
+		}))
+	}
+
+	out.start(sources)
+	resp, err := chatModel.GenerateContent(ctx, messages, opts...)
+	if err != nil && ctx.Err() != nil {
+		zlogger.Info().Msgf("Chat completion stopped: %v, requestId: %s", context.Cause(ctx), requestID)
+		return
+	}
+	if err != nil {
+		zlogger.Error().Err(err).Msgf("[%s] Error creating chat completion", requestID)
+		out.fail("Failed to create chat completion")
+		return
+	}
+	if !req.Stream && len(resp.Choices) > 0 {
+		answer.WriteString(resp.Choices[0].Content)
+	}
+
+	out.finish(answer.String(), newDone(resp, t, messages, answer.String(), len(passages)))
+	return
+}
+
+// completionKb 按名称查找模型对应的知识库
+func (receiver *ModuleChatImpl) completionKb(ctx context.Context, name string) (kdto.KbDTO, bool) {
+	kbs, err := do.MustInvoke[know.ModuleKnowledge](nil).GetKb(ctx)
+	if err != nil {
+		panic(err)
+	}
+	return lo.Find(kbs, func(item kdto.KbDTO) bool {
+		return item.Name == name
+	})
+}
+
+// completionLLM 知识库回答时使用的大模型
+func (receiver *ModuleChatImpl) completionLLM(kbName string) string {
+	if name := receiver.conf.Biz.Completions.Models[kbName]; stringutils.IsNotEmpty(name) {
+		return name
+	}
+	return receiver.conf.Openai.Model
+}
+
+// completionHistory 最后一条 user 消息作为问题，之前的 user 和 assistant 消息作为历史对话。
+// 系统提示词由服务端决定，请求中的 system 消息被忽略
+func completionHistory(messages []dto.ChatCompletionMessage) (history []*model.Message, question string) {
+	last := len(messages) - 1
+	if last < 0 || messages[last].Role != model.MessageRoleUser {
+		return nil, ""
+	}
+	for _, item := range messages[:last] {
+		if item.Role != model.MessageRoleUser && item.Role != model.MessageRoleAssistant {
+			continue
+		}
+		history = append(history, &model.Message{
+			Role:    item.Role,
+			Content: messageText(item.Content),
+		})
+	}
+	return history, messageText(messages[last].Content)
+}
+
+// messageText 取消息中的文本，content 为数组时拼接其中 type 为 text 的部分
+func messageText(content interface{}) string {
+	switch value := content.(type) {
+	case string:
+		return value
+	case []interface{}:
+		var text strings.Builder
+		for _, part := range value {
+			if item, ok := part.(map[string]interface{}); ok && item["type"] == "text" {
+				if s, ok := item["text"].(string); ok {
+					text.WriteString(s)
+				}
+			}
+		}
+		return text.String()
+	}
+	return ""
+}
+
+// completionWriter 按请求中的 stream 参数以 SSE 或者 JSON 写出对话补全的结果
+type completionWriter struct {
+	w            http.ResponseWriter
+	flusher      http.Flusher
+	base         dto.ChatCompletion
+	stream       bool
+	includeUsage bool
+	started      bool
+}
+
+// start 流式返回时写出响应头和第一条带有角色和来源的消息，非流式时只记下来源
+func (receiver *completionWriter) start(sources []dto.Citation) {
+	receiver.base.Sources = sources
+	if !receiver.stream {
+		return
+	}
+	setSSEHeaders(receiver.w)
+	receiver.started = true
+	_ = receiver.chunk(&dto.ChatCompletionMessage{Role: model.MessageRoleAssistant, Content: ""}, nil, nil, sources)
+}
+
+// content 流式返回时写出一段回答
+func (receiver *completionWriter) content(text string) error {
+	if !receiver.stream {
+		return nil
+	}
+	return receiver.chunk(&dto.ChatCompletionMessage{Content: text}, nil, nil, nil)
+}
+
+// finish 写出结束原因和用量，流式返回时以 [DONE] 结束
+func (receiver *completionWriter) finish(answer string, done dto.Done) {
+	finishReason := done.FinishReason
+	if !receiver.stream {
+		result := receiver.base
+		result.Object = objectChatCompletion
+		result.Choices = []dto.ChatCompletionChoice{
+			{
+				Message:      &dto.ChatCompletionMessage{Role: model.MessageRoleAssistant, Content: answer},
+				FinishReason: &finishReason,
+			},
+		}
+		result.Usage = &done.Usage
+		receiver.w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		if err := json.NewEncoder(receiver.w).Encode(result); err != nil {
+			zlogger.Error().Err(err).Msgf("Write chat completion failed, id: %s", result.Id)
+		}
+		return
+	}
+
+	if err := receiver.chunk(&dto.ChatCompletionMessage{}, &finishReason, nil, nil); err != nil {
+		return
+	}
+	if receiver.includeUsage {
+		if err := receiver.chunk(nil, nil, &done.Usage, nil); err != nil {
+			return
+		}
+	}
+	receiver.done()
+}
+
+// fail 还没有开始流式返回时返回错误响应，否则写出一条错误消息后结束
+func (receiver *completionWriter) fail(message string) {
+	if !receiver.started {
+		writeOpenaiError(receiver.w, http.StatusInternalServerError, "server_error", "", message)
+		return
+	}
+	var body openaiError
+	body.Error.Message = message
+	body.Error.Type = "server_error"
+	data, _ := json.Marshal(body)
+	if err := writeSSEMessage(receiver.w, receiver.flusher, sseEvent{data: data}); err != nil {
+		return
+	}
+	receiver.done()
+}
+
+// chunk 写出一条流式消息，delta 为空时 choices 为空
+func (receiver *completionWriter) chunk(delta *dto.ChatCompletionMessage, finishReason *string, usage *dto.Usage, sources []dto.Citation) error {
+	result := receiver.base
+	result.Object = objectChatCompletionChunk
+	result.Choices = []dto.ChatCompletionChoice{}
+	if delta != nil {
+		result.Choices = append(result.Choices, dto.ChatCompletionChoice{
+			Delta:        delta,
+			FinishReason: finishReason,
+		})
+	}
+	result.Usage = usage
+	result.Sources = sources
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	return writeSSEMessage(receiver.w, receiver.flusher, sseEvent{data: data})
+}
+
+func (receiver *completionWriter) done() {
+	_ = writeSSEMessage(receiver.w, receiver.flusher, sseEvent{data: []byte("[DONE]")})
+}
+
+func writeOpenaiError(w http.ResponseWriter, status int, errType, code, message string) {
+	var body openaiError
+	body.Error.Message = message
+	body.Error.Type = errType
+	body.Error.Code = code
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
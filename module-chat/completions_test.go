@@ -0,0 +1,161 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/tmc/langchaingo/llms"
+
+	"go-doudou-rag/module-chat/contextutil"
+	"go-doudou-rag/module-chat/dto"
+	kdto "go-doudou-rag/module-knowledge/dto"
+	"go-doudou-rag/toolkit/llm"
+	"go-doudou-rag/toolkit/prompt"
+)
+
+func useTravelKb() *fakeKnowledge {
+	knowledge := useKnowledge(kdto.QueryResult{
+		Content: "出差住宿费一类城市每天不超过五百元。",
+		FileId:  3,
+		Type:    "text",
+	})
+	knowledge.kbs = []kdto.KbDTO{
+		{Id: 1, Name: "默认知识库", CreatedAt: "2024-05-01 08:00:00"},
+		{Id: 2, Name: "差旅制度", CreatedAt: "2024-05-02 08:00:00"},
+	}
+	return knowledge
+}
+
+func completions(svc *ModuleChatImpl, req dto.ChatCompletionReq) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	_ = svc.PostV1ChatCompletions(contextutil.NewResponseWriterContext(context.Background(), recorder), req)
+	return recorder
+}
+
+func TestChatCompletions(t *testing.T) {
+	knowledge := useTravelKb()
+	fake := llm.NewFake(llm.Reply{
+		Chunks: []string{"宁波的住宿费标准是多少？"},
+	}, llm.Reply{
+		Chunks: []string{"宁波每天不超过五百元[1]。"},
+	})
+	svc := newTestService(t, fake)
+	svc.conf.Biz.Completions.Models = map[string]string{"差旅制度": "Qwen/Qwen2.5-72B-Instruct"}
+
+	recorder := completions(svc, dto.ChatCompletionReq{
+		Model: "差旅制度",
+		Messages: []dto.ChatCompletionMessage{
+			{Role: "system", Content: "You are a helpful assistant."},
+			{Role: "user", Content: "杭州的住宿费标准是多少？"},
+			{Role: "assistant", Content: "杭州每天不超过五百元。"},
+			{Role: "user", Content: []interface{}{
+				map[string]interface{}{"type": "text", "text": "那宁波呢？"},
+			}},
+		},
+	})
+
+	var result dto.ChatCompletion
+	if err := json.Unmarshal(recorder.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Object != "chat.completion" || result.Model != "差旅制度" || len(result.Choices) != 1 ||
+		result.Choices[0].Message.Content != "宁波每天不超过五百元[1]。" || *result.Choices[0].FinishReason != "stop" {
+		t.Fatalf("result = %s", recorder.Body.String())
+	}
+	if result.Usage == nil || result.Usage.TotalTokens == 0 || len(result.Sources) != 1 || result.Sources[0].FileId != 3 {
+		t.Fatalf("result = %s", recorder.Body.String())
+	}
+
+	// 在模型对应的知识库中检索改写后的问题，system 消息被忽略
+	if req := knowledge.reqs[0]; len(req.KbIds) != 1 || req.KbIds[0] != 2 || req.Text != "宁波的住宿费标准是多少？" {
+		t.Fatalf("query = %+v", req)
+	}
+	answer := fake.Calls()[1]
+	if len(answer) != 4 || answer[0].Parts[0].(llms.TextContent).Text != prompt.DefaultSystem ||
+		!strings.Contains(answer[3].Parts[0].(llms.TextContent).Text, "[1] 出差住宿费一类城市每天不超过五百元。") {
+		t.Fatalf("answer messages = %+v", answer)
+	}
+}
+
+func TestChatCompletionsStream(t *testing.T) {
+	useTravelKb()
+	svc := newTestService(t, llm.NewFake(llm.Reply{
+		Chunks: []string{"一类城市", "每天不超过五百元。"},
+	}))
+
+	recorder := completions(svc, dto.ChatCompletionReq{
+		Model:         "差旅制度",
+		Messages:      []dto.ChatCompletionMessage{{Role: "user", Content: "住宿费标准是多少"}},
+		Stream:        true,
+		StreamOptions: &dto.StreamOptions{IncludeUsage: true},
+	})
+
+	if got := recorder.Header().Get("Content-Type"); got != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", got)
+	}
+	blocks := strings.Split(strings.TrimSpace(recorder.Body.String()), "\n\n")
+	if blocks[len(blocks)-1] != "data: [DONE]" {
+		t.Fatalf("body = %s", recorder.Body.String())
+	}
+	var chunks []dto.ChatCompletion
+	for _, block := range blocks[:len(blocks)-1] {
+		var chunk dto.ChatCompletion
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(block, "data: ")), &chunk); err != nil {
+			t.Fatal(err)
+		}
+		if chunk.Object != "chat.completion.chunk" {
+			t.Fatalf("object = %s", chunk.Object)
+		}
+		chunks = append(chunks, chunk)
+	}
+
+	// 角色和来源、两段回答、结束原因、用量
+	if len(chunks) != 5 || chunks[0].Choices[0].Delta.Role != "assistant" || len(chunks[0].Sources) != 1 {
+		t.Fatalf("body = %s", recorder.Body.String())
+	}
+	answer := chunks[1].Choices[0].Delta.Content.(string) + chunks[2].Choices[0].Delta.Content.(string)
+	if answer != "一类城市每天不超过五百元。" || *chunks[3].Choices[0].FinishReason != "stop" {
+		t.Fatalf("body = %s", recorder.Body.String())
+	}
+	if usage := chunks[4].Usage; len(chunks[4].Choices) != 0 || usage == nil || usage.CompletionTokens == 0 {
+		t.Fatalf("body = %s", recorder.Body.String())
+	}
+}
+
+func TestChatCompletionsModelNotFound(t *testing.T) {
+	useTravelKb()
+	fake := llm.NewFake()
+	svc := newTestService(t, fake)
+
+	recorder := completions(svc, dto.ChatCompletionReq{
+		Model:    "gpt-4o",
+		Messages: []dto.ChatCompletionMessage{{Role: "user", Content: "住宿费标准是多少"}},
+	})
+
+	if recorder.Code != http.StatusNotFound || !strings.Contains(recorder.Body.String(), "model_not_found") {
+		t.Fatalf("status = %d, body = %s", recorder.Code, recorder.Body.String())
+	}
+	if len(fake.Calls()) != 0 {
+		t.Fatal("llm should not be called for unknown models")
+	}
+}
+
+func TestModels(t *testing.T) {
+	useTravelKb()
+	svc := newTestService(t, llm.NewFake())
+	svc.conf.Openai.Model = "Qwen/Qwen2.5-7B-Instruct"
+	svc.conf.Biz.Completions.Models = map[string]string{"差旅制度": "Qwen/Qwen2.5-72B-Instruct"}
+
+	object, models, err := svc.GetV1Models(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if object != "list" || len(models) != 2 || models[0].Id != "默认知识库" || models[0].OwnedBy != "Qwen/Qwen2.5-7B-Instruct" ||
+		models[1].OwnedBy != "Qwen/Qwen2.5-72B-Instruct" || models[1].Created == 0 {
+		t.Fatalf("models = %+v", models)
+	}
+}
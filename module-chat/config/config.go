@@ -5,6 +5,8 @@
 package config
 
 import (
+	"time"
+
 	_ "github.com/unionj-cloud/go-doudou/v2/framework/config"
 	"github.com/unionj-cloud/toolkit/envconfig"
 	"github.com/unionj-cloud/toolkit/zlogger"
@@ -13,12 +15,42 @@ import (
 var G_Config *Config
 
 type Config struct {
+	Biz struct {
+		History struct {
+			// 回答时带上的最近几轮对话，一问一答为一轮
+			MaxTurns int `default:"5"`
+			// 有历史对话时先把问题改写成可以独立检索的问题
+			RewriteQuery bool `default:"true"`
+		}
+		Retrieval struct {
+			// 从知识库检索的分块数量上限
+			Limit               int     `default:"50"`
+			SimilarityThreshold float32 `default:"0.5"`
+			// 放进提示词的检索上下文的 token 预算，按配置的模型计算，小于等于 0 时不限制
+			MaxTokens int `default:"3000"`
+		}
+		Stream struct {
+			// 回答结束后消息在内存中保留的时间，期间断线的客户端可以重连
+			Ttl time.Duration `default:"5m"`
+			// 心跳间隔，防止代理关闭长时间没有数据的连接，小于等于 0 时不发心跳
+			Heartbeat time.Duration `default:"15s"`
+			// 客户端全部断开后等待重连的时间，超时后停止生成，已经生成的部分作为截断的回答保存
+			ResumeTimeout time.Duration `default:"30s"`
+		}
+		Completions struct {
+			// OpenAI 兼容接口中知识库名称到大模型的映射，格式为 知识库:大模型,知识库:大模型，没有配置的知识库使用 Openai.Model
+			Models map[string]string
+		}
+	}
 	Openai struct {
 		BaseUrl        string
 		Token          string
 		EmbeddingModel string
 		Model          string
 	}
+	Db struct {
+		Dsn string
+	}
 }
 
 func init() {
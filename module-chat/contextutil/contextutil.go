@@ -7,6 +7,7 @@ import (
 
 const (
 	responseWriterKey = "responseWriterKey"
+	lastEventIDKey    = "lastEventIDKey"
 )
 
 func NewResponseWriterContext(ctx context.Context, w http.ResponseWriter) context.Context {
@@ -17,3 +18,13 @@ func ResponseWriterFromContext(ctx context.Context) (http.ResponseWriter, bool)
 	w, ok := ctx.Value(responseWriterKey).(http.ResponseWriter)
 	return w, ok
 }
+
+// NewLastEventIDContext 保存 SSE 客户端重连时带的 Last-Event-ID 请求头
+func NewLastEventIDContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, lastEventIDKey, id)
+}
+
+func LastEventIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(lastEventIDKey).(string)
+	return id, ok
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/unionj-cloud/toolkit/stringutils"
+
+	"go-doudou-rag/module-chat/dto"
+	"go-doudou-rag/module-chat/internal/dao"
+	"go-doudou-rag/module-chat/internal/model"
+	"go-doudou-rag/toolkit/auth"
+)
+
+// username 返回 JWT 中的当前用户
+func username(ctx context.Context) string {
+	userInfo, _ := auth.UserInfoFromContext(ctx)
+	return userInfo.Username
+}
+
+// getConversation 返回当前用户的对话，不存在或者属于其他用户时都视为不存在
+func getConversation(ctx context.Context, id uint) *model.Conversation {
+	c := dao.GetConversationRepo().Get(ctx, id, username(ctx))
+	if c == nil {
+		panic(fmt.Sprintf("conversation %d not found", id))
+	}
+	return c
+}
+
+func (receiver *ModuleChatImpl) GetConversation(ctx context.Context) (data []dto.ConversationDTO, err error) {
+	data = lo.Map(dao.GetConversationRepo().List(ctx, username(ctx)), func(item *model.Conversation, index int) dto.ConversationDTO {
+		return newConversationDTO(item)
+	})
+	return data, nil
+}
+
+func (receiver *ModuleChatImpl) GetConversation_Id(ctx context.Context, id uint) (data dto.ConversationDetail, err error) {
+	c := getConversation(ctx, id)
+	messages := dao.GetConversationRepo().ListMessages(ctx, c.ID, 0)
+
+	return dto.ConversationDetail{
+		Conversation: newConversationDTO(c),
+		Messages: lo.Map(messages, func(item *model.Message, index int) dto.MessageDTO {
+			return dto.MessageDTO{
+				Id:        item.ID,
+				Role:      item.Role,
+				Content:   item.Content,
+				Query:     item.Query,
+				Truncated: item.Truncated,
+				CreatedAt: item.CreatedAt.Format(time.DateTime),
+			}
+		}),
+	}, nil
+}
+
+func (receiver *ModuleChatImpl) PutConversation_Id(ctx context.Context, id uint, req dto.UpdateConversationReq) (data dto.ConversationDTO, err error) {
+	c := getConversation(ctx, id)
+
+	fields := make(map[string]any)
+	if req.Title != nil {
+		title := strings.TrimSpace(*req.Title)
+		if stringutils.IsEmpty(title) {
+			panic("title must not be empty")
+		}
+		fields["title"] = title
+		c.Title = title
+	}
+	if req.Pinned != nil {
+		fields["pinned"] = *req.Pinned
+		c.Pinned = *req.Pinned
+	}
+	if len(fields) > 0 {
+		dao.GetConversationRepo().Update(ctx, c.ID, fields)
+	}
+
+	return newConversationDTO(c), nil
+}
+
+func (receiver *ModuleChatImpl) DeleteConversation_Id(ctx context.Context, id uint) (err error) {
+	c := getConversation(ctx, id)
+	dao.GetConversationRepo().Delete(ctx, c.ID)
+	return nil
+}
+
+func newConversationDTO(c *model.Conversation) dto.ConversationDTO {
+	return dto.ConversationDTO{
+		Id:        c.ID,
+		Title:     c.Title,
+		Pinned:    c.Pinned,
+		CreatedAt: c.CreatedAt.Format(time.DateTime),
+		UpdatedAt: c.UpdatedAt.Format(time.DateTime),
+	}
+}
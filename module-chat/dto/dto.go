@@ -68,10 +68,195 @@ type ChatRequest struct {
 	Prompt string `json:"prompt" validate:"required" form:"prompt"`
 	// 多个值英文逗号拼接
 	FileId string `json:"file_id" form:"file_id"`
+	// 检索的知识库，为空时检索默认知识库，指定了文件时检索文件所在的知识库
+	KbIds []uint `json:"kb_ids" form:"kb_ids"`
+	// 为 0 时新建对话，问答保存后在 done 之前通过 type 为 conversation 的消息返回新对话的ID，继续对话时传入该ID
+	ConversationId uint `json:"conversation_id" form:"conversation_id"`
+	// 提示词模板名称，为空时使用第一个知识库的模板，没有指定知识库时使用默认知识库的模板
+	PromptTemplate string `json:"prompt_template" form:"prompt_template"`
+	// 提示词模板的版本，为 0 时使用启用的版本
+	PromptVersion int `json:"prompt_version" form:"prompt_version"`
 }
 
 type ChatResponse struct {
 	Content   string `json:"content" form:"content"`
 	RequestID string `json:"request_id" form:"request_id"`
-	Type      string `json:"type" form:"type"`
+	// conversation, sources, dropped, content, done, error
+	Type string `json:"type" form:"type"`
+	// 仅 type 为 conversation 时有值
+	ConversationId uint `json:"conversation_id,omitempty" form:"conversation_id"`
+	// 仅 type 为 sources 时有值，回答中的 [n] 对应 Index 为 n 的来源
+	Sources []Citation `json:"sources,omitempty" form:"sources"`
+	// 仅 type 为 dropped 时有值
+	Dropped []DroppedChunk `json:"dropped,omitempty" form:"dropped"`
+	// 仅 type 为 done 时有值
+	Done *Done `json:"done,omitempty" form:"done"`
+}
+
+// Citation 回答引用的知识来源
+type Citation struct {
+	// 对应提示词中上下文的序号，从 1 开始
+	Index      int     `json:"index" form:"index"`
+	FileId     uint    `json:"file_id" form:"file_id"`
+	FileName   string  `json:"file_name" form:"file_name"`
+	Page       int     `json:"page" form:"page"`
+	Type       string  `json:"type" form:"type"`
+	Image      string  `json:"image" form:"image"`
+	Similarity float32 `json:"similarity" form:"similarity"`
+	// 检索得分，重排过时为重排得分
+	Score float32 `json:"score" form:"score"`
+}
+
+// Done 回答结束
+type Done struct {
+	// stop 为正常结束，length 为达到了最大 token 数，cancelled 为被停止
+	FinishReason string `json:"finish_reason" form:"finish_reason"`
+	Usage        Usage  `json:"usage" form:"usage"`
+	// 回答中实际引用的来源序号，按第一次出现的顺序
+	Cited []int `json:"cited" form:"cited"`
+}
+
+// Usage 本次回答消耗的 token 数量
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens" form:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens" form:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens" form:"total_tokens"`
+	// 大模型没有返回用量时按配置的模型估算
+	Estimated bool `json:"estimated" form:"estimated"`
+}
+
+// DroppedChunk 检索到但是没有放进提示词的分块
+type DroppedChunk struct {
+	Id       string `json:"id" form:"id"`
+	FileId   uint   `json:"file_id" form:"file_id"`
+	FileName string `json:"file_name" form:"file_name"`
+	Page     int    `json:"page" form:"page"`
+	// duplicate 为与排名更靠前的分块重复，budget 为超出了 token 预算
+	Reason string `json:"reason" form:"reason"`
+}
+
+// ConversationDTO 对话，不包含消息
+type ConversationDTO struct {
+	Id     uint   `json:"id" form:"id"`
+	Title  string `json:"title" form:"title"`
+	Pinned bool   `json:"pinned" form:"pinned"`
+	// 创建时间
+	CreatedAt string `json:"created_at" form:"created_at"`
+	// 最后一次对话的时间
+	UpdatedAt string `json:"updated_at" form:"updated_at"`
+}
+
+// MessageDTO 对话中的一条消息
+type MessageDTO struct {
+	Id uint `json:"id" form:"id"`
+	// user 或 assistant
+	Role    string `json:"role" form:"role"`
+	Content string `json:"content" form:"content"`
+	// 改写后用于检索的问题，仅 role 为 user 时有值
+	Query string `json:"query" form:"query"`
+	// 回答被停止或者客户端断开连接，只有已经生成的部分
+	Truncated bool   `json:"truncated" form:"truncated"`
+	CreatedAt string `json:"created_at" form:"created_at"`
+}
+
+// ConversationDetail 对话及其全部消息，消息按时间正序
+type ConversationDetail struct {
+	Conversation ConversationDTO `json:"conversation" form:"conversation"`
+	Messages     []MessageDTO    `json:"messages" form:"messages"`
+}
+
+// UpdateConversationReq 为空的字段不修改
+type UpdateConversationReq struct {
+	Title  *string `json:"title,omitempty" form:"title"`
+	Pinned *bool   `json:"pinned,omitempty" form:"pinned"`
+}
+
+// ChatCompletionReq OpenAI 兼容的对话补全请求，最后一条 user 消息作为问题，之前的 user 和 assistant 消息作为历史对话，
+// system 消息被忽略
+type ChatCompletionReq struct {
+	// 知识库名称，可选的值见 /v1/models
+	Model    string                  `json:"model" validate:"required" form:"model"`
+	Messages []ChatCompletionMessage `json:"messages" validate:"required,min=1" form:"messages"`
+	Stream   bool                    `json:"stream" form:"stream"`
+	// 仅 stream 为 true 时有效
+	StreamOptions *StreamOptions `json:"stream_options,omitempty" form:"stream_options"`
+	// 为空时使用默认值
+	Temperature *float64 `json:"temperature,omitempty" form:"temperature"`
+	// 为 0 时使用默认值
+	MaxTokens int `json:"max_tokens" form:"max_tokens"`
+}
+
+// ChatCompletionMessage 对话补全中的一条消息，流式返回时作为 delta 只带有变化的字段
+type ChatCompletionMessage struct {
+	// system, user 或 assistant
+	Role string `json:"role,omitempty" form:"role"`
+	// 字符串，或者由 type 为 text 的内容组成的数组，其他类型的内容会被忽略
+	Content interface{} `json:"content,omitempty" form:"content"`
+}
+
+type StreamOptions struct {
+	// 结束前多返回一条 choices 为空、带有 usage 的消息
+	IncludeUsage bool `json:"include_usage" form:"include_usage"`
+}
+
+// ChatCompletion 对话补全的结果，流式返回时 object 为 chat.completion.chunk
+type ChatCompletion struct {
+	Id      string                 `json:"id" form:"id"`
+	Object  string                 `json:"object" form:"object"`
+	Created int64                  `json:"created" form:"created"`
+	Model   string                 `json:"model" form:"model"`
+	Choices []ChatCompletionChoice `json:"choices" form:"choices"`
+	Usage   *Usage                 `json:"usage,omitempty" form:"usage"`
+	// 扩展字段，放进上下文的来源，与回答中的 [n] 对应。流式返回时只在第一条消息中
+	Sources []Citation `json:"sources,omitempty" form:"sources"`
+}
+
+type ChatCompletionChoice struct {
+	Index   int                    `json:"index" form:"index"`
+	Message *ChatCompletionMessage `json:"message,omitempty" form:"message"`
+	Delta   *ChatCompletionMessage `json:"delta,omitempty" form:"delta"`
+	// stop 或 length，流式返回时只在最后一条消息中有值
+	FinishReason *string `json:"finish_reason" form:"finish_reason"`
+}
+
+// OpenaiModel OpenAI 兼容接口中的模型，每个知识库对应一个模型
+type OpenaiModel struct {
+	// 知识库名称
+	Id      string `json:"id" form:"id"`
+	Object  string `json:"object" form:"object"`
+	Created int64  `json:"created" form:"created"`
+	// 回答使用的大模型
+	OwnedBy string `json:"owned_by" form:"owned_by"`
+}
+
+// PromptTemplateDTO 提示词模板的一个版本，version 为 0 时是内置模板
+type PromptTemplateDTO struct {
+	Name    string `json:"name" form:"name"`
+	Version int    `json:"version" form:"version"`
+	System  string `json:"system" form:"system"`
+	Prompt  string `json:"prompt" form:"prompt"`
+	Vision  string `json:"vision" form:"vision"`
+	Comment string `json:"comment" form:"comment"`
+	Active  bool   `json:"active" form:"active"`
+	// 保存该版本的用户
+	CreatedBy string `json:"created_by" form:"created_by"`
+	CreatedAt string `json:"created_at" form:"created_at"`
+}
+
+// SavePromptReq 保存为模板的新版本。模板使用 text/template 语法，可以引用 .Question、.User、
+// .Contexts（Index、Content、FileName、Page）和 .History（Role、Content），为空的部分使用内置模板
+type SavePromptReq struct {
+	Name string `json:"name" validate:"required" form:"name"`
+	// 系统提示词
+	System string `json:"system" form:"system"`
+	// 带有检索上下文的问题
+	Prompt string `json:"prompt" form:"prompt"`
+	// 入库时解析图片的提示词，渲染时变量都为空
+	Vision string `json:"vision" form:"vision"`
+	// 修改说明
+	Comment string `json:"comment" form:"comment"`
+}
+
+type ActivatePromptReq struct {
+	Version int `json:"version" validate:"required,min=1" form:"version"`
 }
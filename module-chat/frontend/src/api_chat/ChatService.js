@@ -12,6 +12,28 @@ export class ChatService extends BizService {
     postChat(payload) {
         return this.getAxios().post(`/chat`, payload, {});
     }
+    /**
+     * POST /chat/:id/cancel
+     * PostChat_IdCancel 停止当前用户正在生成的回答，id 为回答中的 request_id。
+     * 已经生成的部分作为截断的回答保存，对话请求以 finish_reason 为 cancelled 的 done 消息结束
+     *
+     * @param id
+     * @returns Promise<PostChat_IdCancelResp>
+     */
+    postChatIdCancel(id) {
+        return this.getAxios().post(`/chat/${id}/cancel`, {});
+    }
+    /**
+     * GET /chat/:id/events
+     * GetChat_IdEvents 断线重连，id 为回答中的 request_id。先补发 Last-Event-ID 请求头之后的消息，
+     * 回答还没有结束时继续推送，没有该请求头时从头开始。回答结束后消息保留一段时间，过期后返回错误
+     *
+     * @param id
+     * @returns Promise<GetChat_IdEventsResp>
+     */
+    getChatIdEvents(id) {
+        return this.getAxios().get(`/chat/${id}/events`, {});
+    }
 }
 export default ChatService;
 export function createChatService(opt) {
@@ -0,0 +1,51 @@
+import BizService from "./BizService";
+export class ConversationService extends BizService {
+    constructor(options) {
+        super(options);
+    }
+    /**
+     * GET /conversation
+     * GetConversation 返回当前用户的全部对话，置顶的在前，其余按最后一次对话的时间倒序
+     *
+     * @returns Promise<GetConversationResp>
+     */
+    getConversation() {
+        return this.getAxios().get(`/conversation`, {});
+    }
+    /**
+     * GET /conversation/:id
+     * GetConversation_Id 返回当前用户的一个对话及其全部消息
+     *
+     * @param id
+     * @returns Promise<GetConversation_IdResp>
+     */
+    getConversationId(id) {
+        return this.getAxios().get(`/conversation/${id}`, {});
+    }
+    /**
+     * PUT /conversation/:id
+     * PutConversation_Id 重命名或者置顶、取消置顶当前用户的对话
+     *
+     * @param id
+     * @param payload
+     * @returns Promise<PutConversation_IdResp>
+     */
+    putConversationId(id, payload) {
+        return this.getAxios().put(`/conversation/${id}`, payload, {});
+    }
+    /**
+     * DELETE /conversation/:id
+     * DeleteConversation_Id 删除当前用户的对话及其全部消息
+     *
+     * @param id
+     * @returns Promise<DeleteConversation_IdResp>
+     */
+    deleteConversationId(id) {
+        return this.getAxios().delete(`/conversation/${id}`, {});
+    }
+}
+export default ConversationService;
+export function createConversationService(opt) {
+    return new ConversationService(opt);
+}
+export const conversationService = createConversationService();
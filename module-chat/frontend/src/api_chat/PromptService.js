@@ -0,0 +1,52 @@
+import BizService from "./BizService";
+export class PromptService extends BizService {
+    constructor(options) {
+        super(options);
+    }
+    /**
+     * GET /prompt
+     * GetPrompt @role(admin) 返回每个提示词模板启用的版本，数据库中没有 default 模板时包含版本为 0 的内置模板
+     *
+     * @returns Promise<GetPromptResp>
+     */
+    getPrompt() {
+        return this.getAxios().get(`/prompt`, {});
+    }
+    /**
+     * POST /prompt
+     * PostPrompt @role(admin) 把提示词模板保存为新版本并启用，保存前用示例变量试渲染。
+     * 知识库的 prompt_template 或者对话请求的 prompt_template 引用模板名称，name 为 default 时替换内置模板
+     *
+     * @param payload
+     * @returns Promise<PostPromptResp>
+     */
+    postPrompt(payload) {
+        return this.getAxios().post(`/prompt`, payload, {});
+    }
+    /**
+     * GET /prompt/:name
+     * GetPrompt_Name @role(admin) 返回提示词模板的全部版本，新版本在前
+     *
+     * @param name
+     * @returns Promise<GetPrompt_NameResp>
+     */
+    getPromptName(name) {
+        return this.getAxios().get(`/prompt/${name}`, {});
+    }
+    /**
+     * PUT /prompt/:name/active
+     * PutPrompt_NameActive @role(admin) 启用提示词模板的指定版本，用于回滚
+     *
+     * @param name
+     * @param payload
+     * @returns Promise<PutPrompt_NameActiveResp>
+     */
+    putPromptNameActive(name, payload) {
+        return this.getAxios().put(`/prompt/${name}/active`, payload, {});
+    }
+}
+export default PromptService;
+export function createPromptService(opt) {
+    return new PromptService(opt);
+}
+export const promptService = createPromptService();
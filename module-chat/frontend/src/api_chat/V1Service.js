@@ -0,0 +1,31 @@
+import BizService from "./BizService";
+export class V1Service extends BizService {
+    constructor(options) {
+        super(options);
+    }
+    /**
+     * POST /v1/chat/completions
+     * PostV1ChatCompletions OpenAI 兼容的对话补全接口，model 为知识库名称。检索和提示词与 Chat 相同，
+     * 但是不保存对话。stream 为 true 时以 SSE 返回，以 data: [DONE] 结束
+     *
+     * @param payload
+     * @returns Promise<PostV1ChatCompletionsResp>
+     */
+    postV1ChatCompletions(payload) {
+        return this.getAxios().post(`/v1/chat/completions`, payload, {});
+    }
+    /**
+     * GET /v1/models
+     * GetV1Models OpenAI 兼容的模型列表，每个知识库对应一个模型
+     *
+     * @returns Promise<GetV1ModelsResp>
+     */
+    getV1Models() {
+        return this.getAxios().get(`/v1/models`, {});
+    }
+}
+export default V1Service;
+export function createV1Service(opt) {
+    return new V1Service(opt);
+}
+export const v1Service = createV1Service();
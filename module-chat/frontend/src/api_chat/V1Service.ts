@@ -0,0 +1,47 @@
+/* eslint-disable prettier/prettier */
+/* eslint-disable @typescript-eslint/no-explicit-any */
+/**
+ * Generated by pullcode v1.2.1.
+ * Don't edit!
+ *
+ * @module V1
+ */
+import { CreateAxiosOptions } from "@/httputil/axiosTransform";
+import BizService from "./BizService";
+import type { ChatCompletionReq, GetV1ModelsResp, PostV1ChatCompletionsResp } from "./types";
+
+export class V1Service extends BizService {
+  constructor(options?: Partial<CreateAxiosOptions>) {
+    super(options);
+  }
+
+  /**
+   * POST /v1/chat/completions
+   * PostV1ChatCompletions OpenAI 兼容的对话补全接口，model 为知识库名称。检索和提示词与 Chat 相同，
+   * 但是不保存对话。stream 为 true 时以 SSE 返回，以 data: [DONE] 结束
+   *
+   * @param payload
+   * @returns Promise<PostV1ChatCompletionsResp>
+   */
+  postV1ChatCompletions(payload: ChatCompletionReq): Promise<PostV1ChatCompletionsResp> {
+    return this.getAxios().post(`/v1/chat/completions`, payload, {});
+  }
+
+  /**
+   * GET /v1/models
+   * GetV1Models OpenAI 兼容的模型列表，每个知识库对应一个模型
+   *
+   * @returns Promise<GetV1ModelsResp>
+   */
+  getV1Models(): Promise<GetV1ModelsResp> {
+    return this.getAxios().get(`/v1/models`, {});
+  }
+}
+
+export default V1Service;
+
+export function createV1Service(opt?: Partial<CreateAxiosOptions>) {
+  return new V1Service(opt);
+}
+
+export const v1Service = createV1Service();
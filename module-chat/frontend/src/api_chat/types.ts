@@ -8,22 +8,202 @@
  * @module types
  */
 
+export interface ActivatePromptReq {
+  version: number;
+}
+
+/**
+ * ChatCompletion 对话补全的结果，流式返回时 object 为 chat.completion.chunk
+ */
+export interface ChatCompletion {
+  choices: ChatCompletionChoice[];
+  created: number;
+  id: string;
+  model: string;
+  object: string;
+  /**
+   * 扩展字段，放进上下文的来源，与回答中的 [n] 对应。流式返回时只在第一条消息中
+   */
+  sources?: Citation[];
+  usage?: Usage;
+}
+
+export interface ChatCompletionChoice {
+  delta?: ChatCompletionMessage;
+  /**
+   * stop 或 length，流式返回时只在最后一条消息中有值
+   */
+  finish_reason?: string;
+  index: number;
+  message?: ChatCompletionMessage;
+}
+
+/**
+ * ChatCompletionMessage 对话补全中的一条消息，流式返回时作为 delta 只带有变化的字段
+ */
+export interface ChatCompletionMessage {
+  /**
+   * 字符串，或者由 type 为 text 的内容组成的数组，其他类型的内容会被忽略
+   */
+  content?: any;
+  /**
+   * system, user 或 assistant
+   */
+  role?: string;
+}
+
+/**
+ * ChatCompletionReq OpenAI 兼容的对话补全请求，最后一条 user 消息作为问题，之前的 user 和 assistant 消息作为历史对话，
+ * system 消息被忽略
+ */
+export interface ChatCompletionReq {
+  /**
+   * 为 0 时使用默认值
+   */
+  max_tokens: number;
+  messages: ChatCompletionMessage[];
+  /**
+   * 知识库名称，可选的值见 /v1/models
+   */
+  model: string;
+  stream: boolean;
+  /**
+   * 仅 stream 为 true 时有效
+   */
+  stream_options?: StreamOptions;
+  /**
+   * 为空时使用默认值
+   */
+  temperature?: number;
+}
+
 export interface ChatRequest {
+  /**
+   * 为 0 时新建对话，问答保存后在 done 之前通过 type 为 conversation 的消息返回新对话的ID，继续对话时传入该ID
+   */
+  conversation_id: number;
   /**
    * 多个值英文逗号拼接
    */
   file_id: string;
+  /**
+   * 检索的知识库，为空时检索默认知识库，指定了文件时检索文件所在的知识库
+   */
+  kb_ids: number[];
   prompt: string;
+  /**
+   * 提示词模板名称，为空时使用第一个知识库的模板，没有指定知识库时使用默认知识库的模板
+   */
+  prompt_template: string;
+  /**
+   * 提示词模板的版本，为 0 时使用启用的版本
+   */
+  prompt_version: number;
 }
 
 export interface ChatResp {}
 
 export interface ChatResponse {
   content: string;
+  /**
+   * 仅 type 为 conversation 时有值
+   */
+  conversation_id?: number;
+  /**
+   * 仅 type 为 done 时有值
+   */
+  done?: Done;
+  /**
+   * 仅 type 为 dropped 时有值
+   */
+  dropped?: DroppedChunk[];
   request_id: string;
+  /**
+   * 仅 type 为 sources 时有值，回答中的 [n] 对应 Index 为 n 的来源
+   */
+  sources?: Citation[];
+  /**
+   * conversation, sources, dropped, content, done, error
+   */
   type: string;
 }
 
+/**
+ * Citation 回答引用的知识来源
+ */
+export interface Citation {
+  file_id: number;
+  file_name: string;
+  image: string;
+  /**
+   * 对应提示词中上下文的序号，从 1 开始
+   */
+  index: number;
+  page: number;
+  /**
+   * 检索得分，重排过时为重排得分
+   */
+  score: number;
+  similarity: number;
+  type: string;
+}
+
+/**
+ * ConversationDTO 对话，不包含消息
+ */
+export interface ConversationDTO {
+  /**
+   * 创建时间
+   */
+  created_at: string;
+  id: number;
+  pinned: boolean;
+  title: string;
+  /**
+   * 最后一次对话的时间
+   */
+  updated_at: string;
+}
+
+/**
+ * ConversationDetail 对话及其全部消息，消息按时间正序
+ */
+export interface ConversationDetail {
+  conversation: ConversationDTO;
+  messages: MessageDTO[];
+}
+
+export interface DeleteConversation_IdResp {}
+
+/**
+ * Done 回答结束
+ */
+export interface Done {
+  /**
+   * 回答中实际引用的来源序号，按第一次出现的顺序
+   */
+  cited: number[];
+  /**
+   * stop 为正常结束，length 为达到了最大 token 数，cancelled 为被停止
+   */
+  finish_reason: string;
+  usage: Usage;
+}
+
+/**
+ * DroppedChunk 检索到但是没有放进提示词的分块
+ */
+export interface DroppedChunk {
+  file_id: number;
+  file_name: string;
+  id: string;
+  page: number;
+  /**
+   * duplicate 为与排名更靠前的分块重复，budget 为超出了 token 预算
+   */
+  reason: string;
+}
+
 export interface GddUser {
   dept: string;
   id: number;
@@ -31,9 +211,69 @@ export interface GddUser {
   phone: string;
 }
 
+export interface GetChat_IdEventsResp {}
+
+export interface GetConversationResp {
+  data: ConversationDTO[];
+}
+
+export interface GetConversation_IdResp {
+  data: ConversationDetail;
+}
+
+export interface GetPromptResp {
+  data: PromptTemplateDTO[];
+}
+
+export interface GetPrompt_NameResp {
+  data: PromptTemplateDTO[];
+}
+
+export interface GetV1ModelsResp {
+  data: OpenaiModel[];
+  object: string;
+}
+
+/**
+ * MessageDTO 对话中的一条消息
+ */
+export interface MessageDTO {
+  content: string;
+  created_at: string;
+  id: number;
+  /**
+   * 改写后用于检索的问题，仅 role 为 user 时有值
+   */
+  query: string;
+  /**
+   * user 或 assistant
+   */
+  role: string;
+  /**
+   * 回答被停止或者客户端断开连接，只有已经生成的部分
+   */
+  truncated: boolean;
+}
+
 /**
  * Page result wrapper
  */
+/**
+ * OpenaiModel OpenAI 兼容接口中的模型，每个知识库对应一个模型
+ */
+export interface OpenaiModel {
+  created: number;
+  /**
+   * 知识库名称
+   */
+  id: string;
+  object: string;
+  /**
+   * 回答使用的大模型
+   */
+  owned_by: string;
+}
+
 export interface Page {
   first: boolean;
   items: any[];
@@ -57,3 +297,89 @@ export interface Parameter {
   size: number;
   sort: string;
 }
+
+export interface PostChat_IdCancelResp {}
+
+export interface PostPromptResp {
+  data: PromptTemplateDTO;
+}
+
+export interface PostV1ChatCompletionsResp {}
+
+/**
+ * PromptTemplateDTO 提示词模板的一个版本，version 为 0 时是内置模板
+ */
+export interface PromptTemplateDTO {
+  active: boolean;
+  comment: string;
+  created_at: string;
+  /**
+   * 保存该版本的用户
+   */
+  created_by: string;
+  name: string;
+  prompt: string;
+  system: string;
+  version: number;
+  vision: string;
+}
+
+export interface PutConversation_IdResp {
+  data: ConversationDTO;
+}
+
+export interface PutPrompt_NameActiveResp {
+  data: PromptTemplateDTO;
+}
+
+/**
+ * SavePromptReq 保存为模板的新版本。模板使用 text/template 语法，可以引用 .Question、.User、
+ * .Contexts（Index、Content、FileName、Page）和 .History（Role、Content），为空的部分使用内置模板
+ */
+export interface SavePromptReq {
+  /**
+   * 修改说明
+   */
+  comment: string;
+  name: string;
+  /**
+   * 带有检索上下文的问题
+   */
+  prompt: string;
+  /**
+   * 系统提示词
+   */
+  system: string;
+  /**
+   * 入库时解析图片的提示词，渲染时变量都为空
+   */
+  vision: string;
+}
+
+export interface StreamOptions {
+  /**
+   * 结束前多返回一条 choices 为空、带有 usage 的消息
+   */
+  include_usage: boolean;
+}
+
+/**
+ * UpdateConversationReq 为空的字段不修改
+ */
+export interface UpdateConversationReq {
+  pinned?: boolean;
+  title?: string;
+}
+
+/**
+ * Usage 本次回答消耗的 token 数量
+ */
+export interface Usage {
+  completion_tokens: number;
+  /**
+   * 大模型没有返回用量时按配置的模型估算
+   */
+  estimated: boolean;
+  prompt_tokens: number;
+  total_tokens: number;
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/tmc/langchaingo/llms"
+	"github.com/unionj-cloud/toolkit/stringutils"
+	"github.com/unionj-cloud/toolkit/zlogger"
+
+	"go-doudou-rag/module-chat/internal/model"
+)
+
+// 对话标题的最大字数
+const titleLength = 30
+
+const rewritePrompt = `下面是用户与助手之间的历史对话，以及用户的最新问题。最新问题可能省略了历史对话中已经提到的主语、地点、时间等信息，
+请结合历史对话把它改写成一个完整、独立、可以直接用于检索知识库的问题。如果最新问题本身已经完整，原样输出。
+只输出改写后的问题，不要回答问题，也不要输出任何解释。
+
+历史对话：
+%s
+最新问题：%s`
+
+// newTitle 取问题的前若干个字作为对话标题
+func newTitle(prompt string) string {
+	runes := []rune(strings.TrimSpace(prompt))
+	if len(runes) > titleLength {
+		return string(runes[:titleLength]) + "…"
+	}
+	return string(runes)
+}
+
+// historyMessages 把历史消息转换成大模型的多轮消息
+func historyMessages(history []*model.Message) []llms.MessageContent {
+	messages := make([]llms.MessageContent, 0, len(history))
+	for _, item := range history {
+		role := llms.ChatMessageTypeHuman
+		if item.Role == model.MessageRoleAssistant {
+			role = llms.ChatMessageTypeAI
+		}
+		messages = append(messages, llms.TextParts(role, item.Content))
+	}
+	return messages
+}
+
+// rewriteQuery 结合历史对话把追问改写成可以独立检索的问题，例如上一轮问的是杭州的政策时，
+// “那宁波呢？”改写成“宁波出台了什么经济相关的政策？”。改写失败时使用原问题检索
+func (receiver *ModuleChatImpl) rewriteQuery(ctx context.Context, chatModel llms.Model, history []*model.Message, question string) string {
+	var turns strings.Builder
+	for _, item := range history {
+		if item.Role == model.MessageRoleAssistant {
+			turns.WriteString("助手：")
+		} else {
+			turns.WriteString("用户：")
+		}
+		turns.WriteString(item.Content)
+		turns.WriteString("\n")
+	}
+
+	resp, err := chatModel.GenerateContent(ctx, []llms.MessageContent{
+		llms.TextParts(llms.ChatMessageTypeHuman, fmt.Sprintf(rewritePrompt, turns.String(), question)),
+	},
+		llms.WithMaxTokens(256),
+		llms.WithTemperature(0),
+	)
+	if err != nil {
+		zlogger.Warn().Err(err).Msgf("Rewrite query %q failed, use it as is", question)
+		return question
+	}
+	rewritten := strings.TrimSpace(resp.Choices[0].Content)
+	if stringutils.IsEmpty(rewritten) {
+		return question
+	}
+	zlogger.Info().Msgf("Rewrite query %q to %q", question, rewritten)
+	return rewritten
+}
@@ -0,0 +1,112 @@
+package dao
+
+import (
+	"context"
+	"go-doudou-rag/module-chat/internal/model"
+	"gorm.io/gorm"
+)
+
+var conversationRepo *ConversationRepo
+
+func init() {
+	conversationRepo = &ConversationRepo{}
+}
+
+type ConversationRepo struct {
+	db *gorm.DB
+}
+
+func (cr *ConversationRepo) Use(db *gorm.DB) {
+	cr.db = db
+}
+
+func (cr *ConversationRepo) Save(ctx context.Context, conversation *model.Conversation) uint {
+	if err := cr.db.Save(conversation).Error; err != nil {
+		panic(err)
+	}
+
+	return conversation.ID
+}
+
+// Get 返回用户的对话，对话不存在或者属于其他用户时返回 nil
+func (cr *ConversationRepo) Get(ctx context.Context, id uint, username string) *model.Conversation {
+	var conversations []*model.Conversation
+	if err := cr.db.Where("id = ? and username = ?", id, username).Find(&conversations).Error; err != nil {
+		panic(err)
+	}
+
+	if len(conversations) == 0 {
+		return nil
+	}
+	return conversations[0]
+}
+
+// List 返回用户的全部对话，置顶的在前，其余按最后一次对话的时间倒序
+func (cr *ConversationRepo) List(ctx context.Context, username string) []*model.Conversation {
+	var conversations []*model.Conversation
+	if err := cr.db.Where("username = ?", username).Order("pinned desc, updated_at desc, id desc").Find(&conversations).Error; err != nil {
+		panic(err)
+	}
+
+	return conversations
+}
+
+// Update 修改对话的标题和置顶状态，不修改对话的修改时间，避免改名或者置顶后排序发生变化
+func (cr *ConversationRepo) Update(ctx context.Context, id uint, fields map[string]any) {
+	if err := cr.db.Model(&model.Conversation{}).Where("id = ?", id).UpdateColumns(fields).Error; err != nil {
+		panic(err)
+	}
+}
+
+// Delete 软删除对话并删除其中的全部消息
+func (cr *ConversationRepo) Delete(ctx context.Context, id uint) {
+	if err := cr.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("conversation_id = ?", id).Delete(&model.Message{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&model.Conversation{}, id).Error
+	}); err != nil {
+		panic(err)
+	}
+}
+
+// AddTurn 在同一个事务中保存一问一答两条消息，并更新对话的修改时间。对话还没有保存时先创建对话，
+// 新对话只有在第一轮问答保存成功时才会出现
+func (cr *ConversationRepo) AddTurn(ctx context.Context, conversation *model.Conversation, question, answer *model.Message) {
+	if err := cr.db.Transaction(func(tx *gorm.DB) error {
+		if conversation.ID == 0 {
+			if err := tx.Create(conversation).Error; err != nil {
+				return err
+			}
+		}
+		question.ConversationID = conversation.ID
+		answer.ConversationID = conversation.ID
+		if err := tx.Create(question).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(answer).Error; err != nil {
+			return err
+		}
+		return tx.Model(&model.Conversation{}).Where("id = ?", conversation.ID).
+			Update("updated_at", answer.CreatedAt).Error
+	}); err != nil {
+		panic(err)
+	}
+}
+
+// ListMessages 返回对话中最近的 limit 条消息，按时间正序，limit 小于等于 0 时返回全部
+func (cr *ConversationRepo) ListMessages(ctx context.Context, conversationId uint, limit int) []*model.Message {
+	var messages []*model.Message
+	tx := cr.db.Where("conversation_id = ?", conversationId).Order("id desc")
+	if limit > 0 {
+		tx = tx.Limit(limit)
+	}
+	if err := tx.Find(&messages).Error; err != nil {
+		panic(err)
+	}
+
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages
+}
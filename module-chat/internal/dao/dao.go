@@ -0,0 +1,18 @@
+package dao
+
+import (
+	"gorm.io/gorm"
+)
+
+func Use(db *gorm.DB) {
+	conversationRepo.Use(db)
+	promptTemplateRepo.Use(db)
+}
+
+func GetConversationRepo() *ConversationRepo {
+	return conversationRepo
+}
+
+func GetPromptTemplateRepo() *PromptTemplateRepo {
+	return promptTemplateRepo
+}
@@ -0,0 +1,95 @@
+package dao
+
+import (
+	"context"
+	"go-doudou-rag/module-chat/internal/model"
+
+	"gorm.io/gorm"
+)
+
+var promptTemplateRepo *PromptTemplateRepo
+
+func init() {
+	promptTemplateRepo = &PromptTemplateRepo{}
+}
+
+type PromptTemplateRepo struct {
+	db *gorm.DB
+}
+
+func (pr *PromptTemplateRepo) Use(db *gorm.DB) {
+	pr.db = db
+}
+
+// Get 返回模板的指定版本，version 为 0 时返回启用的版本，不存在时返回 nil
+func (pr *PromptTemplateRepo) Get(ctx context.Context, name string, version int) *model.PromptTemplate {
+	tx := pr.db.Where("name = ?", name)
+	if version > 0 {
+		tx = tx.Where("version = ?", version)
+	} else {
+		tx = tx.Where("active = ?", true)
+	}
+	var templates []*model.PromptTemplate
+	if err := tx.Limit(1).Find(&templates).Error; err != nil {
+		panic(err)
+	}
+
+	if len(templates) == 0 {
+		return nil
+	}
+	return templates[0]
+}
+
+// ListActive 返回每个模板启用的版本，按名称排序
+func (pr *PromptTemplateRepo) ListActive(ctx context.Context) []*model.PromptTemplate {
+	var templates []*model.PromptTemplate
+	if err := pr.db.Where("active = ?", true).Order("name").Find(&templates).Error; err != nil {
+		panic(err)
+	}
+
+	return templates
+}
+
+// ListVersions 返回模板的全部版本，新版本在前
+func (pr *PromptTemplateRepo) ListVersions(ctx context.Context, name string) []*model.PromptTemplate {
+	var templates []*model.PromptTemplate
+	if err := pr.db.Where("name = ?", name).Order("version desc").Find(&templates).Error; err != nil {
+		panic(err)
+	}
+
+	return templates
+}
+
+// AddVersion 在同一个事务中把模板保存为该名称的下一个版本并启用
+func (pr *PromptTemplateRepo) AddVersion(ctx context.Context, template *model.PromptTemplate) {
+	if err := pr.db.Transaction(func(tx *gorm.DB) error {
+		var latest int
+		if err := tx.Model(&model.PromptTemplate{}).Where("name = ?", template.Name).
+			Select("coalesce(max(version), 0)").Scan(&latest).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&model.PromptTemplate{}).Where("name = ?", template.Name).
+			Update("active", false).Error; err != nil {
+			return err
+		}
+		template.Version = latest + 1
+		template.Active = true
+		return tx.Create(template).Error
+	}); err != nil {
+		panic(err)
+	}
+}
+
+// Activate 启用模板的指定版本，同时停用其他版本
+func (pr *PromptTemplateRepo) Activate(ctx context.Context, name string, version int) {
+	if err := pr.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.PromptTemplate{}).Where("name = ?", name).
+			Update("active", false).Error; err != nil {
+			return err
+		}
+		return tx.Model(&model.PromptTemplate{}).Where("name = ? and version = ?", name, version).
+			Update("active", true).Error
+	}); err != nil {
+		panic(err)
+	}
+}
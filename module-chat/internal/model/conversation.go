@@ -0,0 +1,35 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	MessageRoleUser      = "user"
+	MessageRoleAssistant = "assistant"
+)
+
+// Conversation 一个用户的一次多轮对话，标题默认取第一个问题
+type Conversation struct {
+	ID        uint           `gorm:"primarykey" json:"id"`
+	Username  string         `gorm:"index" json:"username"`
+	Title     string         `json:"title"`
+	Pinned    bool           `json:"pinned"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at"`
+}
+
+// Message 对话中的一条消息。用户消息同时记录改写后用于检索的问题，
+// 回答被停止或者客户端断开连接时只保存已经生成的部分并标记为截断
+type Message struct {
+	ID             uint      `gorm:"primarykey" json:"id"`
+	ConversationID uint      `gorm:"index" json:"conversation_id"`
+	Role           string    `json:"role"`
+	Content        string    `gorm:"type:text" json:"content"`
+	Query          string    `gorm:"type:text" json:"query"`
+	Truncated      bool      `json:"truncated"`
+	CreatedAt      time.Time `json:"created_at"`
+}
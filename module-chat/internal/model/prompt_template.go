@@ -0,0 +1,20 @@
+package model
+
+import (
+	"time"
+)
+
+// PromptTemplate 提示词模板的一个版本。每次修改都保存为新版本，同一名称下只有一个启用的版本
+type PromptTemplate struct {
+	ID      uint   `gorm:"primarykey" json:"id"`
+	Name    string `gorm:"uniqueIndex:idx_prompt_template_version" json:"name"`
+	Version int    `gorm:"uniqueIndex:idx_prompt_template_version" json:"version"`
+	System  string `gorm:"type:text" json:"system"`
+	Prompt  string `gorm:"type:text" json:"prompt"`
+	Vision  string `gorm:"type:text" json:"vision"`
+	// 修改说明
+	Comment   string    `json:"comment"`
+	Active    bool      `gorm:"index" json:"active"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -8,16 +8,26 @@ import (
 	service "go-doudou-rag/module-chat"
 	"go-doudou-rag/module-chat/config"
 	"go-doudou-rag/module-chat/frontend"
+	"go-doudou-rag/module-chat/internal/dao"
+	"go-doudou-rag/module-chat/internal/model"
+	"go-doudou-rag/module-chat/tokenizer"
 	"go-doudou-rag/module-chat/transport/httpsrv"
+	"go-doudou-rag/toolkit/llm"
+	"go-doudou-rag/toolkit/prompt"
 	"io/fs"
 	"os"
+	"time"
 
+	"github.com/glebarez/sqlite"
+	"github.com/samber/do"
+	"github.com/samber/lo"
 	"github.com/unionj-cloud/go-doudou/v2/framework/grpcx"
 	"github.com/unionj-cloud/go-doudou/v2/framework/plugin"
 	"github.com/unionj-cloud/go-doudou/v2/framework/rest"
 	"github.com/unionj-cloud/toolkit/pipeconn"
 	"github.com/unionj-cloud/toolkit/stringutils"
 	"google.golang.org/grpc"
+	"gorm.io/gorm"
 )
 
 var _ plugin.ServicePlugin = (*ModuleChatPlugin)(nil)
@@ -49,7 +59,24 @@ func (receiver *ModuleChatPlugin) Initialize(restServer *rest.RestServer, grpcSe
 	restServer.AddStaticResource(dist_storage, "")
 
 	conf := config.LoadFromEnv()
-	svc := service.NewModuleChat(conf)
+
+	db, err := gorm.Open(sqlite.Open(conf.Db.Dsn), &gorm.Config{})
+	if err != nil {
+		panic("failed to connect database")
+	}
+
+	if err = db.AutoMigrate(&model.Conversation{}, &model.Message{}, &model.PromptTemplate{}); err != nil {
+		panic(err)
+	}
+
+	dao.Use(db)
+	// 提示词模板保存在对话数据库中，知识库模块入库解析图片时也从这里读取
+	do.ProvideValue[prompt.Store](nil, service.NewPromptStore())
+
+	// 分词器的编码文件可能需要下载，启动时加载，避免在请求中等待
+	tokenizer.Load(10*time.Second, append(lo.Values(conf.Biz.Completions.Models), conf.Openai.Model)...)
+
+	svc := service.NewModuleChat(conf, do.MustInvoke[llm.Provider](nil))
 	routes := httpsrv.Routes(httpsrv.NewModuleChatHandler(svc))
 	restServer.GroupRoutes("/modulechat", routes, httpsrv.InjectResponseWriter)
 	restServer.GroupRoutes("/modulechat", rest.DocRoutes(service.Oas))
@@ -0,0 +1,133 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/samber/do"
+	"github.com/samber/lo"
+	"github.com/tmc/langchaingo/llms"
+	"github.com/unionj-cloud/toolkit/stringutils"
+
+	"go-doudou-rag/module-chat/dto"
+	"go-doudou-rag/module-chat/internal/dao"
+	"go-doudou-rag/module-chat/internal/model"
+	know "go-doudou-rag/module-knowledge"
+	kdto "go-doudou-rag/module-knowledge/dto"
+	"go-doudou-rag/toolkit/prompt"
+)
+
+// 知识库中没有检索到相关内容时的回答
+const noKnowledgeAnswer = "非常抱歉，未能检索到相关信息，无法回答"
+
+// 回答的默认参数
+const (
+	answerMaxTokens   = 4096
+	answerTemperature = 0.2
+)
+
+var _ prompt.Store = (*promptStore)(nil)
+
+// promptStore 从对话数据库中读取提示词模板，由插件注入给各模块使用
+type promptStore struct {
+}
+
+func NewPromptStore() prompt.Store {
+	return &promptStore{}
+}
+
+func (receiver *promptStore) Get(ctx context.Context, name string, version int) (prompt.Template, bool) {
+	tpl := dao.GetPromptTemplateRepo().Get(ctx, name, version)
+	if tpl == nil {
+		return prompt.Template{}, false
+	}
+	return prompt.Template{
+		Name:    tpl.Name,
+		Version: tpl.Version,
+		System:  tpl.System,
+		Prompt:  tpl.Prompt,
+		Vision:  tpl.Vision,
+	}, true
+}
+
+// retrieve 按配置的数量和相似度阈值检索知识库，fileIds 不为空时只在这些文件中检索
+func (receiver *ModuleChatImpl) retrieve(ctx context.Context, kbIds []uint, fileIds []uint, query string) ([]kdto.QueryResult, error) {
+	queryReq := kdto.QueryReq{
+		KbIds:               kbIds,
+		Text:                query,
+		RetrieveLimit:       receiver.conf.Biz.Retrieval.Limit,
+		SimilarityThreshold: receiver.conf.Biz.Retrieval.SimilarityThreshold,
+	}
+	if len(fileIds) > 0 {
+		queryReq.Filter = &kdto.QueryFilter{
+			FileIds: fileIds,
+		}
+	}
+	return do.MustInvoke[know.ModuleKnowledge](nil).GetQuery(ctx, queryReq)
+}
+
+// promptTemplate 请求指定了模板时使用请求的模板，否则使用第一个知识库的模板，没有指定知识库时使用默认知识库的模板
+func (receiver *ModuleChatImpl) promptTemplate(ctx context.Context, req dto.ChatRequest) (prompt.Template, error) {
+	if stringutils.IsNotEmpty(req.PromptTemplate) || req.PromptVersion > 0 {
+		tpl, ok := prompt.Lookup(ctx, req.PromptTemplate, req.PromptVersion)
+		if !ok {
+			return tpl, fmt.Errorf("prompt template %s version %d not found", lo.Ternary(stringutils.IsEmpty(req.PromptTemplate), prompt.Default, req.PromptTemplate), req.PromptVersion)
+		}
+		return tpl, nil
+	}
+
+	kbs, err := do.MustInvoke[know.ModuleKnowledge](nil).GetKb(ctx)
+	if err != nil {
+		return prompt.Template{}, err
+	}
+	kb, ok := lo.Find(kbs, func(item kdto.KbDTO) bool {
+		if len(req.KbIds) > 0 {
+			return item.Id == req.KbIds[0]
+		}
+		return item.IsDefault
+	})
+	if !ok && len(req.KbIds) > 0 {
+		return prompt.Template{}, fmt.Errorf("knowledge base %d not found", req.KbIds[0])
+	}
+	return prompt.ForKb(ctx, kb.PromptTemplate), nil
+}
+
+// promptVars 模板变量，上下文的序号与来源的序号一致
+func promptVars(ctx context.Context, question string, passages []passage, history []*model.Message) prompt.Vars {
+	return prompt.Vars{
+		Question: question,
+		Contexts: lo.Map(passages, func(item passage, index int) prompt.Context {
+			return prompt.Context{
+				Index:    index + 1,
+				Content:  item.Content,
+				FileName: item.FileName,
+				Page:     item.Page,
+			}
+		}),
+		History: lo.Map(history, func(item *model.Message, index int) prompt.Turn {
+			return prompt.Turn{
+				Role:    item.Role,
+				Content: item.Content,
+			}
+		}),
+		User: username(ctx),
+	}
+}
+
+// answerMessages 用模板渲染回答时发给大模型的消息。历史对话只带问题和回答，不带当时检索到的上下文
+func answerMessages(tpl prompt.Template, vars prompt.Vars, history []*model.Message) ([]llms.MessageContent, error) {
+	system, err := prompt.Render(tpl.System, vars)
+	if err != nil {
+		return nil, fmt.Errorf("render system prompt of template %s version %d: %w", tpl.Name, tpl.Version, err)
+	}
+	question, err := prompt.Render(tpl.Prompt, vars)
+	if err != nil {
+		return nil, fmt.Errorf("render prompt of template %s version %d: %w", tpl.Name, tpl.Version, err)
+	}
+
+	messages := []llms.MessageContent{
+		llms.TextParts(llms.ChatMessageTypeSystem, system),
+	}
+	messages = append(messages, historyMessages(history)...)
+	return append(messages, llms.TextParts(llms.ChatMessageTypeHuman, question)), nil
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/unionj-cloud/toolkit/stringutils"
+
+	"go-doudou-rag/module-chat/dto"
+	"go-doudou-rag/module-chat/internal/dao"
+	"go-doudou-rag/module-chat/internal/model"
+	"go-doudou-rag/toolkit/prompt"
+)
+
+// sampleVars 保存模板前用来试渲染的变量
+var sampleVars = prompt.Vars{
+	Question: "住宿费标准是多少",
+	Contexts: []prompt.Context{
+		{Index: 1, Content: "出差住宿费一类城市每天不超过五百元。", FileName: "差旅制度.docx"},
+	},
+	History: []prompt.Turn{
+		{Role: model.MessageRoleUser, Content: "差旅费怎么报销"},
+		{Role: model.MessageRoleAssistant, Content: "凭发票在出差结束后一个月内报销。"},
+	},
+	User: "admin",
+}
+
+func newPromptTemplateDTO(tpl *model.PromptTemplate) dto.PromptTemplateDTO {
+	return dto.PromptTemplateDTO{
+		Name:      tpl.Name,
+		Version:   tpl.Version,
+		System:    tpl.System,
+		Prompt:    tpl.Prompt,
+		Vision:    tpl.Vision,
+		Comment:   tpl.Comment,
+		Active:    tpl.Active,
+		CreatedBy: tpl.CreatedBy,
+		CreatedAt: tpl.CreatedAt.Format(time.DateTime),
+	}
+}
+
+// builtinPromptTemplateDTO 数据库中还没有 default 模板时返回的内置模板
+func builtinPromptTemplateDTO() dto.PromptTemplateDTO {
+	builtin := prompt.Builtin()
+	return dto.PromptTemplateDTO{
+		Name:   builtin.Name,
+		System: builtin.System,
+		Prompt: builtin.Prompt,
+		Vision: builtin.Vision,
+		Active: true,
+	}
+}
+
+func (receiver *ModuleChatImpl) GetPrompt(ctx context.Context) (data []dto.PromptTemplateDTO, err error) {
+	templates := dao.GetPromptTemplateRepo().ListActive(ctx)
+	data = lo.Map(templates, func(item *model.PromptTemplate, index int) dto.PromptTemplateDTO {
+		return newPromptTemplateDTO(item)
+	})
+	if !lo.ContainsBy(templates, func(item *model.PromptTemplate) bool {
+		return item.Name == prompt.Default
+	}) {
+		data = append([]dto.PromptTemplateDTO{builtinPromptTemplateDTO()}, data...)
+	}
+	return data, nil
+}
+
+func (receiver *ModuleChatImpl) GetPrompt_Name(ctx context.Context, name string) (data []dto.PromptTemplateDTO, err error) {
+	templates := dao.GetPromptTemplateRepo().ListVersions(ctx, name)
+	if len(templates) == 0 {
+		if name == prompt.Default {
+			return []dto.PromptTemplateDTO{builtinPromptTemplateDTO()}, nil
+		}
+		panic(fmt.Sprintf("prompt template %s not found", name))
+	}
+	data = lo.Map(templates, func(item *model.PromptTemplate, index int) dto.PromptTemplateDTO {
+		return newPromptTemplateDTO(item)
+	})
+	return data, nil
+}
+
+func (receiver *ModuleChatImpl) PostPrompt(ctx context.Context, req dto.SavePromptReq) (data dto.PromptTemplateDTO, err error) {
+	name := strings.TrimSpace(req.Name)
+	if stringutils.IsEmpty(name) {
+		panic("name must not be empty")
+	}
+	// 保存前先试渲染，避免语法错误或者引用了不存在的变量的模板在对话时才报错
+	for part, text := range map[string]string{
+		"system": req.System,
+		"prompt": req.Prompt,
+		"vision": req.Vision,
+	} {
+		if stringutils.IsEmpty(text) {
+			continue
+		}
+		if _, err = prompt.Render(text, sampleVars); err != nil {
+			panic(fmt.Sprintf("invalid %s template: %v", part, err))
+		}
+	}
+
+	tpl := &model.PromptTemplate{
+		Name:      name,
+		System:    req.System,
+		Prompt:    req.Prompt,
+		Vision:    req.Vision,
+		Comment:   req.Comment,
+		CreatedBy: username(ctx),
+	}
+	dao.GetPromptTemplateRepo().AddVersion(ctx, tpl)
+	return newPromptTemplateDTO(tpl), nil
+}
+
+func (receiver *ModuleChatImpl) PutPrompt_NameActive(ctx context.Context, name string, req dto.ActivatePromptReq) (data dto.PromptTemplateDTO, err error) {
+	tpl := dao.GetPromptTemplateRepo().Get(ctx, name, req.Version)
+	if tpl == nil {
+		panic(fmt.Sprintf("prompt template %s version %d not found", name, req.Version))
+	}
+	dao.GetPromptTemplateRepo().Activate(ctx, name, req.Version)
+	tpl.Active = true
+	return newPromptTemplateDTO(tpl), nil
+}
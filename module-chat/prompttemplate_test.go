@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/tmc/langchaingo/llms"
+
+	"go-doudou-rag/module-chat/dto"
+	kdto "go-doudou-rag/module-knowledge/dto"
+	"go-doudou-rag/toolkit/auth"
+	"go-doudou-rag/toolkit/llm"
+	"go-doudou-rag/toolkit/prompt"
+)
+
+func TestPromptTemplate(t *testing.T) {
+	knowledge := useKnowledge(kdto.QueryResult{
+		Content:  "出差住宿费一类城市每天不超过五百元。",
+		FileId:   3,
+		FileName: "差旅制度.docx",
+		Type:     "text",
+	})
+	knowledge.kbs = []kdto.KbDTO{
+		{Id: 1, Name: "默认知识库", IsDefault: true},
+		{Id: 2, Name: "差旅制度", PromptTemplate: "travel"},
+	}
+	fake := llm.NewFake(llm.Reply{Chunks: []string{"五百元[1]。"}},
+		llm.Reply{Chunks: []string{"五百元[1]。"}},
+		llm.Reply{Chunks: []string{"五百元[1]。"}})
+	svc := newTestService(t, fake)
+	ctx := auth.NewUserInfoContext(context.Background(), auth.UserInfo{Username: "admin"})
+
+	if data, _ := svc.GetPrompt(ctx); len(data) != 1 || data[0].Name != prompt.Default || data[0].Version != 0 {
+		t.Fatalf("templates = %+v", data)
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("templates referencing unknown variables should be rejected")
+			}
+		}()
+		_, _ = svc.PostPrompt(ctx, dto.SavePromptReq{Name: "travel", System: "{{.Kb}}"})
+	}()
+
+	v1, _ := svc.PostPrompt(ctx, dto.SavePromptReq{
+		Name:   "travel",
+		System: "你是财务部门的差旅报销专员，正在回答 {{.User}} 的问题。",
+	})
+	v2, _ := svc.PostPrompt(ctx, dto.SavePromptReq{
+		Name:    "travel",
+		System:  "你是差旅报销专员。",
+		Prompt:  "{{range .Contexts}}<{{.Index}}> {{.FileName}}：{{.Content}}\n{{end}}问题：{{.Question}}",
+		Comment: "上下文带上文件名",
+	})
+	if v1.Version != 1 || v2.Version != 2 || !v2.Active || v2.CreatedBy != "admin" {
+		t.Fatalf("versions = %+v, %+v", v1, v2)
+	}
+
+	// 知识库引用的模板使用启用的版本
+	chat(t, svc, dto.ChatRequest{Prompt: "住宿费标准是多少", KbIds: []uint{2}})
+	answer := fake.Calls()[0]
+	if answer[0].Parts[0].(llms.TextContent).Text != "你是差旅报销专员。" ||
+		answer[1].Parts[0].(llms.TextContent).Text != "<1> 差旅制度.docx：出差住宿费一类城市每天不超过五百元。\n问题：住宿费标准是多少" {
+		t.Fatalf("answer messages = %+v", answer)
+	}
+
+	// 回滚到第一个版本，为空的部分使用内置模板
+	if data, _ := svc.PutPrompt_NameActive(ctx, "travel", dto.ActivatePromptReq{Version: 1}); !data.Active || data.Version != 1 {
+		t.Fatalf("activated = %+v", data)
+	}
+	if data, _ := svc.GetPrompt_Name(ctx, "travel"); len(data) != 2 || data[0].Active || !data[1].Active {
+		t.Fatalf("versions = %+v", data)
+	}
+	chat(t, svc, dto.ChatRequest{Prompt: "住宿费标准是多少", KbIds: []uint{2}})
+	answer = fake.Calls()[1]
+	if answer[0].Parts[0].(llms.TextContent).Text != "你是财务部门的差旅报销专员，正在回答  的问题。" ||
+		!strings.Contains(answer[1].Parts[0].(llms.TextContent).Text, "[1] 出差住宿费一类城市每天不超过五百元。") {
+		t.Fatalf("answer messages = %+v", answer)
+	}
+
+	// 请求指定的版本优先于知识库的模板，默认知识库没有指定模板时使用内置模板
+	chat(t, svc, dto.ChatRequest{Prompt: "住宿费标准是多少", PromptTemplate: "travel", PromptVersion: 2})
+	if answer = fake.Calls()[2]; answer[0].Parts[0].(llms.TextContent).Text != "你是差旅报销专员。" {
+		t.Fatalf("answer messages = %+v", answer)
+	}
+	events := chat(t, svc, dto.ChatRequest{Prompt: "住宿费标准是多少", PromptTemplate: "legal"})
+	if got := eventTypes(events); got != "error" || !strings.Contains(events[0].Content, "legal") {
+		t.Fatalf("events = %+v", events)
+	}
+
+	// 不存在的知识库不能悄悄使用内置模板
+	events = chat(t, svc, dto.ChatRequest{Prompt: "住宿费标准是多少", KbIds: []uint{9}})
+	if got := eventTypes(events); got != "error" || !strings.Contains(events[0].Content, "knowledge base 9 not found") {
+		t.Fatalf("events = %+v", events)
+	}
+	if len(fake.Calls()) != 3 {
+		t.Fatalf("calls = %d, want 3", len(fake.Calls()))
+	}
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"regexp"
+
+	"github.com/samber/lo"
+	"github.com/spf13/cast"
+	"github.com/tmc/langchaingo/llms"
+
+	"go-doudou-rag/module-chat/dto"
+	"go-doudou-rag/module-chat/tokenizer"
+)
+
+const finishReasonStop = "stop"
+
+// 回答中的引用标记，例如 [1]
+var citationMarker = regexp.MustCompile(`\[(\d+)]`)
+
+// newSources 把放进上下文的段落转换成来源，序号与提示词中的 [n] 一致
+func newSources(passages []passage) []dto.Citation {
+	return lo.Map(passages, func(item passage, index int) dto.Citation {
+		return dto.Citation{
+			Index:      index + 1,
+			FileId:     item.FileId,
+			FileName:   item.FileName,
+			Page:       item.Page,
+			Type:       item.Type,
+			Image:      item.Image,
+			Similarity: item.Similarity,
+			Score:      rankScore(item.QueryResult),
+		}
+	})
+}
+
+// citedIndexes 返回回答中引用的来源序号，去掉重复的和超出来源数量的
+func citedIndexes(answer string, sources int) []int {
+	cited := make([]int, 0)
+	for _, match := range citationMarker.FindAllStringSubmatch(answer, -1) {
+		index := cast.ToInt(match[1])
+		if index < 1 || index > sources || lo.Contains(cited, index) {
+			continue
+		}
+		cited = append(cited, index)
+	}
+	return cited
+}
+
+// newDone 从大模型的响应中取结束原因和 token 用量，OpenAI 兼容接口的用量在 GenerationInfo 中，
+// 没有返回用量时用分词器估算
+func newDone(resp *llms.ContentResponse, t tokenizer.Tokenizer, messages []llms.MessageContent, answer string, sources int) dto.Done {
+	done := dto.Done{
+		FinishReason: finishReasonStop,
+		Cited:        citedIndexes(answer, sources),
+	}
+	if resp != nil && len(resp.Choices) > 0 {
+		choice := resp.Choices[0]
+		if choice.StopReason != "" {
+			done.FinishReason = choice.StopReason
+		}
+		done.Usage = dto.Usage{
+			PromptTokens:     cast.ToInt(choice.GenerationInfo["PromptTokens"]),
+			CompletionTokens: cast.ToInt(choice.GenerationInfo["CompletionTokens"]),
+			TotalTokens:      cast.ToInt(choice.GenerationInfo["TotalTokens"]),
+		}
+	}
+	if done.Usage.TotalTokens > 0 {
+		return done
+	}
+
+	for _, message := range messages {
+		for _, part := range message.Parts {
+			if text, ok := part.(llms.TextContent); ok {
+				done.Usage.PromptTokens += t.Count(text.Text)
+			}
+		}
+	}
+	done.Usage.CompletionTokens = t.Count(answer)
+	done.Usage.TotalTokens = done.Usage.PromptTokens + done.Usage.CompletionTokens
+	done.Usage.Estimated = true
+	return done
+}
@@ -0,0 +1,16 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCitedIndexes(t *testing.T) {
+	got := citedIndexes("一类城市每天不超过五百元[2]，二类城市不超过四百元[1][2]，见附件[7]。", 3)
+	if !reflect.DeepEqual(got, []int{2, 1}) {
+		t.Fatalf("cited = %v", got)
+	}
+	if got = citedIndexes("不知道", 3); len(got) != 0 {
+		t.Fatalf("cited = %v", got)
+	}
+}
@@ -0,0 +1,217 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/spf13/cast"
+	"github.com/unionj-cloud/toolkit/zlogger"
+
+	"go-doudou-rag/module-chat/contextutil"
+	"go-doudou-rag/module-chat/dto"
+)
+
+// sseEvent 一条已经编号的 SSE 消息，编号从 1 开始连续递增
+type sseEvent struct {
+	id   int
+	data []byte
+}
+
+// chatStream 一次对话请求的全部 SSE 消息。生成回答与客户端连接解耦：消息先写进缓冲区，
+// 每个连接各自从缓冲区读取，断线重连时从 Last-Event-ID 之后继续
+type chatStream struct {
+	requestID string
+	username  string
+	cancel    context.CancelCauseFunc
+
+	mu          sync.Mutex
+	events      []sseEvent
+	finished    bool
+	subscribers int
+	// 有新消息或者回答结束时关闭，通知等待中的连接
+	notify chan struct{}
+}
+
+// publish 编号并缓存一条消息
+func (receiver *chatStream) publish(resp dto.ChatResponse) {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		zlogger.Error().Err(err).Msgf("Marshal chat response failed, requestId: %s", receiver.requestID)
+		return
+	}
+
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+
+	receiver.events = append(receiver.events, sseEvent{
+		id:   len(receiver.events) + 1,
+		data: data,
+	})
+	close(receiver.notify)
+	receiver.notify = make(chan struct{})
+}
+
+// next 返回编号大于 after 的消息以及回答是否已经结束，没有新消息时通过返回的通道等待
+func (receiver *chatStream) next(after int) ([]sseEvent, bool, <-chan struct{}) {
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+
+	after = min(max(after, 0), len(receiver.events))
+	return receiver.events[after:], receiver.finished, receiver.notify
+}
+
+// open 登记一次对话请求。请求ID可能来自客户端的请求头，已经被其他请求占用时改用服务端生成的ID，
+// 不能覆盖别人的对话，客户端以消息中的 request_id 为准
+func (receiver *ModuleChatImpl) open(requestID, username string, cancel context.CancelCauseFunc) *chatStream {
+	receiver.streamsMu.Lock()
+	defer receiver.streamsMu.Unlock()
+
+	for {
+		if _, ok := receiver.streams[requestID]; !ok {
+			break
+		}
+		requestID = newRequestID()
+	}
+	stream := &chatStream{
+		requestID: requestID,
+		username:  username,
+		cancel:    cancel,
+		notify:    make(chan struct{}),
+	}
+	receiver.streams[requestID] = stream
+	return stream
+}
+
+// finish 回答结束，消息继续保留 Ttl 供断线的客户端重连
+func (receiver *ModuleChatImpl) finish(stream *chatStream) {
+	stream.mu.Lock()
+	stream.finished = true
+	close(stream.notify)
+	stream.notify = make(chan struct{})
+	stream.mu.Unlock()
+	stream.cancel(nil)
+
+	time.AfterFunc(receiver.conf.Biz.Stream.Ttl, func() {
+		receiver.streamsMu.Lock()
+		defer receiver.streamsMu.Unlock()
+		delete(receiver.streams, stream.requestID)
+	})
+}
+
+// stream 返回当前用户的对话请求，不存在、已经过期或者属于其他用户时都视为不存在
+func (receiver *ModuleChatImpl) stream(ctx context.Context, requestID string) *chatStream {
+	receiver.streamsMu.Lock()
+	stream, ok := receiver.streams[requestID]
+	receiver.streamsMu.Unlock()
+
+	if !ok || stream.username != username(ctx) {
+		panic(fmt.Sprintf("chat %s not found", requestID))
+	}
+	return stream
+}
+
+// serve 把编号大于 after 的消息写给客户端，直到回答结束或者客户端断开连接。
+// 没有新消息时定期写心跳注释，防止代理关闭长时间没有数据的连接
+func (receiver *ModuleChatImpl) serve(ctx context.Context, w http.ResponseWriter, flusher http.Flusher, stream *chatStream, after int) {
+	receiver.attach(stream)
+	defer receiver.detach(stream)
+
+	var heartbeat <-chan time.Time
+	if receiver.conf.Biz.Stream.Heartbeat > 0 {
+		ticker := time.NewTicker(receiver.conf.Biz.Stream.Heartbeat)
+		defer ticker.Stop()
+		heartbeat = ticker.C
+	}
+
+	for {
+		events, finished, wait := stream.next(after)
+		for _, item := range events {
+			if err := writeSSEMessage(w, flusher, item); err != nil {
+				return
+			}
+			after = item.id
+		}
+		if finished {
+			return
+		}
+
+		select {
+		case <-wait:
+		case <-heartbeat:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (receiver *ModuleChatImpl) attach(stream *chatStream) {
+	stream.mu.Lock()
+	defer stream.mu.Unlock()
+	stream.subscribers++
+}
+
+// detach 最后一个连接断开后等待 ResumeTimeout，期间没有重连就停止生成
+func (receiver *ModuleChatImpl) detach(stream *chatStream) {
+	stream.mu.Lock()
+	defer stream.mu.Unlock()
+
+	stream.subscribers--
+	if stream.subscribers > 0 || stream.finished {
+		return
+	}
+	time.AfterFunc(receiver.conf.Biz.Stream.ResumeTimeout, func() {
+		stream.mu.Lock()
+		defer stream.mu.Unlock()
+
+		if stream.subscribers == 0 && !stream.finished {
+			stream.cancel(errClientGone)
+		}
+	})
+}
+
+func (receiver *ModuleChatImpl) GetChat_IdEvents(ctx context.Context, id string) (err error) {
+	stream := receiver.stream(ctx, id)
+	lastEventID, _ := contextutil.LastEventIDFromContext(ctx)
+
+	w, _ := contextutil.ResponseWriterFromContext(ctx)
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		panic("streaming unsupported by client")
+	}
+	setSSEHeaders(w)
+	receiver.serve(ctx, w, flusher, stream, cast.ToInt(lastEventID))
+	return
+}
+
+func setSSEHeaders(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("Transfer-Encoding", "chunked")
+}
+
+// writeSSEMessage 写出一条消息，id 为 0 时不带编号
+func writeSSEMessage(w http.ResponseWriter, flusher http.Flusher, event sseEvent) error {
+	var err error
+	if event.id > 0 {
+		_, err = fmt.Fprintf(w, "id: %d\ndata: %s\n\n", event.id, event.data)
+	} else {
+		_, err = fmt.Fprintf(w, "data: %s\n\n", event.data)
+	}
+	if err != nil {
+		return fmt.Errorf("error writing to response: %v", err)
+	}
+
+	if flusher != nil {
+		flusher.Flush()
+	}
+	return nil
+}
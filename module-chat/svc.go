@@ -22,4 +22,32 @@ curl -N -X POST 'http://localhost:6060/modulechat/chat' \
 */
 type ModuleChat interface {
 	Chat(ctx context.Context, req dto.ChatRequest) (err error)
+	// PostChat_IdCancel 停止当前用户正在生成的回答，id 为回答中的 request_id。
+	// 已经生成的部分作为截断的回答保存，对话请求以 finish_reason 为 cancelled 的 done 消息结束
+	PostChat_IdCancel(ctx context.Context, id string) (err error)
+	// GetChat_IdEvents 断线重连，id 为回答中的 request_id。先补发 Last-Event-ID 请求头之后的消息，
+	// 回答还没有结束时继续推送，没有该请求头时从头开始。回答结束后消息保留一段时间，过期后返回错误
+	GetChat_IdEvents(ctx context.Context, id string) (err error)
+	// PostV1ChatCompletions OpenAI 兼容的对话补全接口，model 为知识库名称。检索和提示词与 Chat 相同，
+	// 但是不保存对话。stream 为 true 时以 SSE 返回，以 data: [DONE] 结束
+	PostV1ChatCompletions(ctx context.Context, req dto.ChatCompletionReq) (err error)
+	// GetV1Models OpenAI 兼容的模型列表，每个知识库对应一个模型
+	GetV1Models(ctx context.Context) (object string, data []dto.OpenaiModel, err error)
+	// GetConversation 返回当前用户的全部对话，置顶的在前，其余按最后一次对话的时间倒序
+	GetConversation(ctx context.Context) (data []dto.ConversationDTO, err error)
+	// GetConversation_Id 返回当前用户的一个对话及其全部消息
+	GetConversation_Id(ctx context.Context, id uint) (data dto.ConversationDetail, err error)
+	// PutConversation_Id 重命名或者置顶、取消置顶当前用户的对话
+	PutConversation_Id(ctx context.Context, id uint, req dto.UpdateConversationReq) (data dto.ConversationDTO, err error)
+	// DeleteConversation_Id 删除当前用户的对话及其全部消息
+	DeleteConversation_Id(ctx context.Context, id uint) (err error)
+	// GetPrompt @role(admin) 返回每个提示词模板启用的版本，数据库中没有 default 模板时包含版本为 0 的内置模板
+	GetPrompt(ctx context.Context) (data []dto.PromptTemplateDTO, err error)
+	// GetPrompt_Name @role(admin) 返回提示词模板的全部版本，新版本在前
+	GetPrompt_Name(ctx context.Context, name string) (data []dto.PromptTemplateDTO, err error)
+	// PostPrompt @role(admin) 把提示词模板保存为新版本并启用，保存前用示例变量试渲染。
+	// 知识库的 prompt_template 或者对话请求的 prompt_template 引用模板名称，name 为 default 时替换内置模板
+	PostPrompt(ctx context.Context, req dto.SavePromptReq) (data dto.PromptTemplateDTO, err error)
+	// PutPrompt_NameActive @role(admin) 启用提示词模板的指定版本，用于回滚
+	PutPrompt_NameActive(ctx context.Context, name string, req dto.ActivatePromptReq) (data dto.PromptTemplateDTO, err error)
 }
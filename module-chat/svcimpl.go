@@ -11,61 +11,96 @@ import (
 	"go-doudou-rag/module-chat/config"
 	"go-doudou-rag/module-chat/contextutil"
 	"go-doudou-rag/module-chat/dto"
-	know "go-doudou-rag/module-knowledge"
-	kdto "go-doudou-rag/module-knowledge/dto"
+	"go-doudou-rag/module-chat/internal/dao"
+	"go-doudou-rag/module-chat/internal/model"
+	"go-doudou-rag/module-chat/tokenizer"
+	"go-doudou-rag/toolkit/llm"
 	"net/http"
-	"os"
+	"strings"
+	"sync"
 
 	"github.com/unionj-cloud/toolkit/stringutils"
 
 	"github.com/ascarter/requestid"
-	"github.com/samber/do"
 	"github.com/samber/lo"
+	"github.com/spf13/cast"
 	"github.com/tmc/langchaingo/llms"
-	"github.com/tmc/langchaingo/llms/openai"
 	"github.com/unionj-cloud/toolkit/zlogger"
 )
 
 var _ ModuleChat = (*ModuleChatImpl)(nil)
 
 type ModuleChatImpl struct {
-	conf *config.Config
+	conf        *config.Config
+	llmProvider llm.Provider
+	// 请求ID -> 对话请求，回答结束后保留 Stream.Ttl
+	streams   map[string]*chatStream
+	streamsMu sync.Mutex
 }
 
-func NewModuleChat(conf *config.Config) *ModuleChatImpl {
+func NewModuleChat(conf *config.Config, llmProvider llm.Provider) *ModuleChatImpl {
 	return &ModuleChatImpl{
-		conf: conf,
+		conf:        conf,
+		llmProvider: llmProvider,
+		streams:     make(map[string]*chatStream),
 	}
 }
 
 func (receiver *ModuleChatImpl) Chat(ctx context.Context, req dto.ChatRequest) (err error) {
 	w, _ := contextutil.ResponseWriterFromContext(ctx)
 	requestID, _ := requestid.FromContext(ctx)
+	if stringutils.IsEmpty(requestID) {
+		requestID = newRequestID()
+	}
 
 	// Set headers before any potential error responses
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
-	w.Header().Set("Transfer-Encoding", "chunked")
+	setSSEHeaders(w)
 
 	flusher, ok := w.(http.Flusher)
 	if !ok {
 		zlogger.Error().Msgf("Streaming not supported, requestId: %s", requestID)
-		chunk := dto.ChatResponse{
+		chunk, _ := json.Marshal(dto.ChatResponse{
 			Content:   "Streaming unsupported by client",
 			RequestID: requestID,
 			Type:      "error",
-		}
-		writeSSEMessage(w, flusher, chunk)
+		})
+		writeSSEMessage(w, nil, sseEvent{data: chunk})
 		return
 	}
 
-	llm, err := openai.New(
-		openai.WithBaseURL(receiver.conf.Openai.BaseUrl),
-		openai.WithToken(lo.Ternary(stringutils.IsNotEmpty(receiver.conf.Openai.Token), receiver.conf.Openai.Token, os.Getenv("OPENAI_API_KEY"))),
-		openai.WithEmbeddingModel(receiver.conf.Openai.EmbeddingModel),
-		openai.WithModel(receiver.conf.Openai.Model),
-	)
+	// 生成回答与客户端连接解耦：断线后继续生成，客户端可以通过 GetChat_IdEvents 重连，
+	// 超过 ResumeTimeout 没有重连或者调用了 PostChat_IdCancel 时停止生成
+	genCtx, cancel := context.WithCancelCause(context.WithoutCancel(ctx))
+	stream := receiver.open(requestID, username(ctx), cancel)
+	requestID = stream.requestID
+	go func() {
+		defer receiver.finish(stream)
+		defer func() {
+			if r := recover(); r != nil {
+				zlogger.Error().Msgf("Chat failed: %v, requestId: %s", r, requestID)
+				stream.publish(dto.ChatResponse{
+					Content:   fmt.Sprint(r),
+					RequestID: requestID,
+					Type:      "error",
+				})
+			}
+		}()
+		receiver.generate(genCtx, stream, req)
+	}()
+
+	receiver.serve(ctx, w, flusher, stream, 0)
+	return
+}
+
+// generate 检索知识库并生成回答，全部消息写进 stream
+func (receiver *ModuleChatImpl) generate(ctx context.Context, stream *chatStream, req dto.ChatRequest) {
+	requestID := stream.requestID
+
+	chatModel, err := receiver.llmProvider.New(llm.Options{
+		BaseUrl: receiver.conf.Openai.BaseUrl,
+		Token:   receiver.conf.Openai.Token,
+		Model:   receiver.conf.Openai.Model,
+	})
 	if err != nil {
 		zlogger.Error().Err(err).Msgf("Create LLM failed, requestId: %s", requestID)
 		chunk := dto.ChatResponse{
@@ -73,111 +108,180 @@ func (receiver *ModuleChatImpl) Chat(ctx context.Context, req dto.ChatRequest) (
 			RequestID: requestID,
 			Type:      "error",
 		}
-		writeSSEMessage(w, flusher, chunk)
+		stream.publish(chunk)
 		return
 	}
 
-	knowService := do.MustInvoke[know.ModuleKnowledge](nil)
-
-	prompt := "请结合下面给出的上下文信息回答问题，答案必须分条阐述，力求条理清晰，如果不知道可以回答不知道，但不要编造答案：\n"
-
-	if stringutils.IsEmpty(req.FileId) {
-		queryResults, err := knowService.GetQuery(ctx, kdto.QueryReq{
-			Text:                req.Prompt,
-			RetrieveLimit:       1000,
-			SimilarityThreshold: 0.5,
-		})
-		if err != nil {
-			zlogger.Error().Err(err).Msgf("Query knowledge base failed, requestId: %s", requestID)
+	conversationRepo := dao.GetConversationRepo()
+	var conversation *model.Conversation
+	if req.ConversationId > 0 {
+		if conversation = conversationRepo.Get(ctx, req.ConversationId, username(ctx)); conversation == nil {
 			chunk := dto.ChatResponse{
-				Content:   err.Error(),
+				Content:   fmt.Sprintf("conversation %d not found", req.ConversationId),
 				RequestID: requestID,
 				Type:      "error",
 			}
-			writeSSEMessage(w, flusher, chunk)
-			return err
+			stream.publish(chunk)
+			return
 		}
-
-		if len(queryResults) == 0 {
-			zlogger.Error().Msgf("Knowledge not found, requestId: %s", requestID)
-			chunk := dto.ChatResponse{
-				Content:   "非常抱歉，未能检索到相关信息，无法回答",
-				RequestID: requestID,
-				Type:      "error",
-			}
-			writeSSEMessage(w, flusher, chunk)
-			return err
+	} else {
+		// 新对话在保存第一轮问答时才创建，中途失败不会留下空的对话
+		conversation = &model.Conversation{
+			Username: username(ctx),
+			Title:    newTitle(req.Prompt),
 		}
+	}
 
-		lo.ForEach(queryResults, func(item kdto.QueryResult, index int) {
-			prompt += fmt.Sprintf("%d. %s\n", index+1, item.Content)
+	var history []*model.Message
+	if conversation.ID > 0 {
+		history = conversationRepo.ListMessages(ctx, conversation.ID, 2*receiver.conf.Biz.History.MaxTurns)
+	}
+	query := req.Prompt
+	if len(history) > 0 && receiver.conf.Biz.History.RewriteQuery {
+		query = receiver.rewriteQuery(ctx, chatModel, history, req.Prompt)
+	}
+
+	// saveTurn 保存这一轮问答，新对话保存后通过 type 为 conversation 的消息返回ID
+	saveTurn := func(answer string, truncated bool) {
+		created := conversation.ID == 0
+		conversationRepo.AddTurn(context.WithoutCancel(ctx), conversation, &model.Message{
+			Role:    model.MessageRoleUser,
+			Content: req.Prompt,
+			Query:   query,
+		}, &model.Message{
+			Role:      model.MessageRoleAssistant,
+			Content:   answer,
+			Truncated: truncated,
 		})
-	} else {
-		listReq := kdto.GetListReq{
-			FileId:      req.FileId,
-			WithContent: true,
+		if created {
+			stream.publish(dto.ChatResponse{
+				RequestID:      requestID,
+				Type:           "conversation",
+				ConversationId: conversation.ID,
+			})
 		}
-		fileDTOList, _ := knowService.GetList(ctx, listReq)
+	}
 
-		if len(fileDTOList) == 0 {
-			zlogger.Error().Msgf("Knowledge not found, requestId: %s", requestID)
-			chunk := dto.ChatResponse{
-				Content:   "非常抱歉，未能检索到相关信息，无法回答",
-				RequestID: requestID,
-				Type:      "error",
-			}
-			writeSSEMessage(w, flusher, chunk)
-			return err
+	var fileIds []uint
+	if stringutils.IsNotEmpty(req.FileId) {
+		fileIds = lo.Map(strings.Split(req.FileId, ","), func(item string, index int) uint {
+			return cast.ToUint(strings.TrimSpace(item))
+		})
+	}
+
+	tpl, err := receiver.promptTemplate(ctx, req)
+	if err != nil {
+		zlogger.Error().Err(err).Msgf("Select prompt template failed, requestId: %s", requestID)
+		stream.publish(dto.ChatResponse{
+			Content:   err.Error(),
+			RequestID: requestID,
+			Type:      "error",
+		})
+		return
+	}
+
+	queryResults, err := receiver.retrieve(ctx, req.KbIds, fileIds, query)
+	if err != nil {
+		zlogger.Error().Err(err).Msgf("Query knowledge base failed, requestId: %s", requestID)
+		chunk := dto.ChatResponse{
+			Content:   err.Error(),
+			RequestID: requestID,
+			Type:      "error",
 		}
+		stream.publish(chunk)
+		return
+	}
 
-		lo.ForEach(fileDTOList, func(item kdto.FileDTO, index int) {
-			prompt += fmt.Sprintf("%d. %s\n", index+1, item.Content)
+	if len(queryResults) == 0 {
+		// 没有检索到内容时不请求大模型，固定的回答与正常的回答一样保存
+		zlogger.Info().Msgf("Knowledge not found, requestId: %s", requestID)
+		stream.publish(dto.ChatResponse{
+			Content:   noKnowledgeAnswer,
+			RequestID: requestID,
+			Type:      "content",
 		})
+		saveTurn(noKnowledgeAnswer, false)
+		stream.publish(dto.ChatResponse{
+			RequestID: requestID,
+			Type:      "done",
+			Done:      &dto.Done{FinishReason: finishReasonStop},
+		})
+		return
 	}
 
-	prompt += "请回答：" + req.Prompt + "\n\n\n"
+	t := tokenizer.For(receiver.conf.Openai.Model)
+	passages, dropped := buildContext(queryResults, t, receiver.conf.Biz.Retrieval.MaxTokens)
+	// 生成之前先返回全部来源，前端据此把回答中的 [n] 渲染成可以点击的引用
+	stream.publish(dto.ChatResponse{
+		RequestID: requestID,
+		Type:      "sources",
+		Sources:   newSources(passages),
+	})
+
+	if len(dropped) > 0 {
+		zlogger.Info().Msgf("Dropped %d of %d retrieved chunks, requestId: %s", len(dropped), len(queryResults), requestID)
+		stream.publish(dto.ChatResponse{
+			RequestID: requestID,
+			Type:      "dropped",
+			Dropped:   dropped,
+		})
+	}
 
-	content := []llms.MessageContent{
-		llms.TextParts(llms.ChatMessageTypeSystem, "You are a senior public policy researcher."),
-		llms.TextParts(llms.ChatMessageTypeHuman, prompt),
+	content, err := answerMessages(tpl, promptVars(ctx, req.Prompt, passages, history), history)
+	if err != nil {
+		zlogger.Error().Err(err).Msgf("Render prompt template failed, requestId: %s", requestID)
+		stream.publish(dto.ChatResponse{
+			Content:   err.Error(),
+			RequestID: requestID,
+			Type:      "error",
+		})
+		return
 	}
 
-	if _, err = llm.GenerateContent(ctx, content,
-		llms.WithMaxTokens(4096),
-		llms.WithTemperature(0.2),
+	var answer strings.Builder
+	resp, err := chatModel.GenerateContent(ctx, content,
+		llms.WithMaxTokens(answerMaxTokens),
+		llms.WithTemperature(answerTemperature),
 		llms.WithStreamingFunc(func(ctx context.Context, chunk []byte) error {
+			answer.Write(chunk)
 			chunkResp := dto.ChatResponse{
 				Content:   string(chunk),
 				RequestID: requestID,
 				Type:      "content",
 			}
-			return writeSSEMessage(w, flusher, chunkResp)
-		})); err != nil {
+			stream.publish(chunkResp)
+			return nil
+		}))
+	if err != nil && ctx.Err() != nil {
+		// 用户停止生成或者客户端断开后没有重连，只保存已经生成的部分
+		zlogger.Info().Msgf("Chat stopped: %v, requestId: %s", context.Cause(ctx), requestID)
+		saveTurn(answer.String(), true)
+		done := newDone(nil, t, content, answer.String(), len(passages))
+		done.FinishReason = finishReasonCancelled
+		stream.publish(dto.ChatResponse{
+			RequestID: requestID,
+			Type:      "done",
+			Done:      &done,
+		})
+		return
+	}
+	if err != nil {
 		zlogger.Error().Err(err).Msgf("[%s] Error creating chat completion stream", requestID)
 		chunk := dto.ChatResponse{
 			Content:   "Failed to create chat completion stream",
 			RequestID: requestID,
 			Type:      "error",
 		}
-		writeSSEMessage(w, flusher, chunk)
+		stream.publish(chunk)
 		return
 	}
-	return
-}
 
-func writeSSEMessage(w http.ResponseWriter, flusher http.Flusher, chunk dto.ChatResponse) error {
-	var err error
-	chunkJSON, err := json.Marshal(chunk)
-	if err != nil {
-		return fmt.Errorf("error marshaling chunk: %v", err)
-	}
-
-	_, err = fmt.Fprintf(w, "data: %s\n\n", chunkJSON)
-	//_, err = fmt.Fprint(w, chunk.Content)
-	if err != nil {
-		return fmt.Errorf("error writing to response: %v", err)
-	}
+	saveTurn(answer.String(), false)
 
-	flusher.Flush()
-	return nil
+	done := newDone(resp, t, content, answer.String(), len(passages))
+	stream.publish(dto.ChatResponse{
+		RequestID: requestID,
+		Type:      "done",
+		Done:      &done,
+	})
 }
@@ -0,0 +1,536 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ascarter/requestid"
+	"github.com/glebarez/sqlite"
+	"github.com/samber/do"
+	"github.com/tmc/langchaingo/llms"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"go-doudou-rag/module-chat/config"
+	"go-doudou-rag/module-chat/contextutil"
+	"go-doudou-rag/module-chat/dto"
+	"go-doudou-rag/module-chat/internal/dao"
+	"go-doudou-rag/module-chat/internal/model"
+	know "go-doudou-rag/module-knowledge"
+	kdto "go-doudou-rag/module-knowledge/dto"
+	"go-doudou-rag/toolkit/auth"
+	"go-doudou-rag/toolkit/llm"
+	"go-doudou-rag/toolkit/prompt"
+)
+
+// fakeKnowledge 只实现检索和知识库列表，其余方法调用时直接 panic
+type fakeKnowledge struct {
+	know.ModuleKnowledge
+	results []kdto.QueryResult
+	reqs    []kdto.QueryReq
+	kbs     []kdto.KbDTO
+}
+
+func (receiver *fakeKnowledge) GetQuery(ctx context.Context, req kdto.QueryReq) ([]kdto.QueryResult, error) {
+	receiver.reqs = append(receiver.reqs, req)
+	return receiver.results, nil
+}
+
+func (receiver *fakeKnowledge) GetKb(ctx context.Context) ([]kdto.KbDTO, error) {
+	return receiver.kbs, nil
+}
+
+func useKnowledge(results ...kdto.QueryResult) *fakeKnowledge {
+	knowledge := &fakeKnowledge{
+		results: results,
+	}
+	do.OverrideValue[know.ModuleKnowledge](nil, knowledge)
+	return knowledge
+}
+
+// newTestService 使用临时目录中的对话数据库和按脚本回答的大模型
+func newTestService(t *testing.T, fake *llm.Fake) *ModuleChatImpl {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "chat.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.AutoMigrate(&model.Conversation{}, &model.Message{}, &model.PromptTemplate{}); err != nil {
+		t.Fatal(err)
+	}
+	dao.Use(db)
+	do.OverrideValue[prompt.Store](nil, NewPromptStore())
+
+	conf := &config.Config{}
+	conf.Biz.History.MaxTurns = 5
+	conf.Biz.History.RewriteQuery = true
+	conf.Biz.Retrieval.Limit = 50
+	conf.Biz.Retrieval.SimilarityThreshold = 0.5
+	conf.Biz.Retrieval.MaxTokens = 3000
+	conf.Biz.Stream.Ttl = time.Minute
+	conf.Biz.Stream.ResumeTimeout = 5 * time.Second
+	return NewModuleChat(conf, fake)
+}
+
+// chat 调用 Chat 并解析写出的 SSE 事件
+func chat(t *testing.T, svc *ModuleChatImpl, req dto.ChatRequest) []dto.ChatResponse {
+	recorder := httptest.NewRecorder()
+	ctx := contextutil.NewResponseWriterContext(context.Background(), recorder)
+	_ = svc.Chat(ctx, req)
+
+	if got := recorder.Header().Get("Content-Type"); got != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", got)
+	}
+	return parseEvents(t, recorder.Body.String())
+}
+
+// parseEvents 解析 SSE 事件
+func parseEvents(t *testing.T, body string) []dto.ChatResponse {
+	_, events := parseStream(t, body)
+	return events
+}
+
+// parseStream 解析 SSE 事件及其编号，跳过心跳注释
+func parseStream(t *testing.T, body string) ([]int, []dto.ChatResponse) {
+	var ids []int
+	var events []dto.ChatResponse
+	for _, block := range strings.Split(strings.TrimSpace(body), "\n\n") {
+		if strings.HasPrefix(block, ":") {
+			continue
+		}
+		id, event, ok := parseBlock(block)
+		if !ok {
+			t.Fatalf("unexpected sse block %q", block)
+		}
+		ids = append(ids, id)
+		events = append(events, event)
+	}
+	return ids, events
+}
+
+// parseBlock 解析一条 SSE 消息，没有编号时 id 为 0
+func parseBlock(block string) (id int, event dto.ChatResponse, ok bool) {
+	for _, line := range strings.Split(strings.TrimSpace(block), "\n") {
+		if value, found := strings.CutPrefix(line, "id: "); found {
+			id, _ = strconv.Atoi(value)
+		}
+		if data, found := strings.CutPrefix(line, "data: "); found {
+			ok = json.Unmarshal([]byte(data), &event) == nil
+		}
+	}
+	return id, event, ok
+}
+
+func eventTypes(events []dto.ChatResponse) string {
+	types := make([]string, 0, len(events))
+	for _, item := range events {
+		types = append(types, item.Type)
+	}
+	return strings.Join(types, ",")
+}
+
+// conversationOf 返回 type 为 conversation 的消息中的对话ID，没有时返回 0
+func conversationOf(events []dto.ChatResponse) uint {
+	for _, item := range events {
+		if item.Type == "conversation" {
+			return item.ConversationId
+		}
+	}
+	return 0
+}
+
+// answerOf 拼接 type 为 content 的消息
+func answerOf(events []dto.ChatResponse) string {
+	var answer string
+	for _, item := range events {
+		if item.Type == "content" {
+			answer += item.Content
+		}
+	}
+	return answer
+}
+
+func TestChat(t *testing.T) {
+	knowledge := useKnowledge(kdto.QueryResult{
+		Content:    "出差住宿费一类城市每天不超过五百元。",
+		FileId:     3,
+		FileName:   "差旅制度.docx",
+		Similarity: 0.8,
+		Type:       "text",
+	})
+	fake := llm.NewFake(llm.Reply{
+		Chunks: []string{"1. 一类城市", "每天不超过", "五百元[1]。"},
+	})
+	svc := newTestService(t, fake)
+
+	events := chat(t, svc, dto.ChatRequest{
+		Prompt: "住宿费标准是多少",
+		FileId: "3, 4",
+	})
+
+	if got := eventTypes(events); got != "sources,content,content,content,conversation,done" {
+		t.Fatalf("events = %s", got)
+	}
+	if conversationOf(events) == 0 {
+		t.Fatal("conversation id is empty")
+	}
+	if sources := events[0].Sources; len(sources) != 1 || sources[0].Index != 1 || sources[0].FileId != 3 {
+		t.Fatalf("sources = %+v", sources)
+	}
+	if answer := answerOf(events); answer != "1. 一类城市每天不超过五百元[1]。" {
+		t.Fatalf("answer = %q", answer)
+	}
+	// Fake 不返回用量，按字符估算
+	done := events[5].Done
+	if done == nil || done.FinishReason != "stop" || len(done.Cited) != 1 || done.Cited[0] != 1 ||
+		!done.Usage.Estimated || done.Usage.CompletionTokens == 0 ||
+		done.Usage.TotalTokens != done.Usage.PromptTokens+done.Usage.CompletionTokens {
+		t.Fatalf("done = %+v", done)
+	}
+
+	if filter := knowledge.reqs[0].Filter; filter == nil || len(filter.FileIds) != 2 || filter.FileIds[1] != 4 {
+		t.Fatalf("filter = %+v", filter)
+	}
+	calls := fake.Calls()
+	if len(calls) != 1 {
+		t.Fatalf("calls = %d, want 1", len(calls))
+	}
+	prompt := calls[0][1].Parts[0].(llms.TextContent).Text
+	if !strings.Contains(prompt, "[1] 出差住宿费一类城市每天不超过五百元。") || !strings.Contains(prompt, "住宿费标准是多少") {
+		t.Fatalf("prompt = %q", prompt)
+	}
+}
+
+func TestChatKnowledgeNotFound(t *testing.T) {
+	useKnowledge()
+	fake := llm.NewFake()
+	svc := newTestService(t, fake)
+
+	events := chat(t, svc, dto.ChatRequest{
+		Prompt: "住宿费标准是多少",
+	})
+
+	if got := eventTypes(events); got != "content,conversation,done" {
+		t.Fatalf("events = %s", got)
+	}
+	if events[0].Content != noKnowledgeAnswer || events[2].Done.FinishReason != "stop" {
+		t.Fatalf("events = %+v", events)
+	}
+	if len(fake.Calls()) != 0 {
+		t.Fatal("llm should not be called without knowledge")
+	}
+	// 没有检索到内容时的回答也作为一轮问答保存
+	messages := dao.GetConversationRepo().ListMessages(context.Background(), conversationOf(events), 0)
+	if len(messages) != 2 || messages[0].Content != "住宿费标准是多少" || messages[1].Content != noKnowledgeAnswer {
+		t.Fatalf("messages = %+v", messages)
+	}
+}
+
+func TestChatStreamFailed(t *testing.T) {
+	useKnowledge(kdto.QueryResult{
+		Content: "出差住宿费一类城市每天不超过五百元。",
+	})
+	svc := newTestService(t, llm.NewFake(llm.Reply{
+		Chunks: []string{"1. 一类城市"},
+		Err:    errors.New("connection reset"),
+	}))
+
+	events := chat(t, svc, dto.ChatRequest{
+		Prompt: "住宿费标准是多少",
+	})
+
+	if got := eventTypes(events); got != "sources,content,error" {
+		t.Fatalf("events = %s", got)
+	}
+	// 回答失败时不保存这一轮对话，也不会留下空的对话
+	if conversations := dao.GetConversationRepo().List(context.Background(), ""); len(conversations) != 0 {
+		t.Fatalf("conversations = %d, want 0", len(conversations))
+	}
+}
+
+func TestChatFollowUp(t *testing.T) {
+	knowledge := useKnowledge(kdto.QueryResult{
+		Content: "出差住宿费一类城市每天不超过五百元。",
+	})
+	fake := llm.NewFake(llm.Reply{
+		Chunks: []string{"杭州每天不超过五百元。"},
+	}, llm.Reply{
+		Chunks: []string{"宁波的住宿费标准是多少？"},
+	}, llm.Reply{
+		Chunks: []string{"宁波每天不超过四百元。"},
+	})
+	svc := newTestService(t, fake)
+
+	first := chat(t, svc, dto.ChatRequest{
+		Prompt: "杭州的住宿费标准是多少？",
+	})
+	conversationId := conversationOf(first)
+	second := chat(t, svc, dto.ChatRequest{
+		Prompt:         "那宁波呢？",
+		ConversationId: conversationId,
+	})
+
+	if got := eventTypes(second); got != "sources,content,done" {
+		t.Fatalf("events = %s", got)
+	}
+	if text := knowledge.reqs[1].Text; text != "宁波的住宿费标准是多少？" {
+		t.Fatalf("retrieval query = %q", text)
+	}
+
+	// 改写问题时带上历史对话，回答时历史对话作为多轮消息放在当前问题之前
+	calls := fake.Calls()
+	if len(calls) != 3 {
+		t.Fatalf("calls = %d, want 3", len(calls))
+	}
+	rewrite := calls[1][0].Parts[0].(llms.TextContent).Text
+	if !strings.Contains(rewrite, "用户：杭州的住宿费标准是多少？") || !strings.Contains(rewrite, "那宁波呢？") {
+		t.Fatalf("rewrite prompt = %q", rewrite)
+	}
+	answer := calls[2]
+	if len(answer) != 4 || answer[1].Role != llms.ChatMessageTypeHuman || answer[2].Role != llms.ChatMessageTypeAI ||
+		answer[2].Parts[0].(llms.TextContent).Text != "杭州每天不超过五百元。" {
+		t.Fatalf("answer messages = %+v", answer)
+	}
+
+	messages := dao.GetConversationRepo().ListMessages(context.Background(), conversationId, 0)
+	if len(messages) != 4 || messages[2].Query != "宁波的住宿费标准是多少？" || messages[3].Content != "宁波每天不超过四百元。" {
+		t.Fatalf("messages = %+v", messages)
+	}
+
+	missing := chat(t, svc, dto.ChatRequest{
+		Prompt:         "那宁波呢？",
+		ConversationId: conversationId + 100,
+	})
+	if got := eventTypes(missing); got != "error" {
+		t.Fatalf("events = %s", got)
+	}
+}
+
+func TestConversation(t *testing.T) {
+	svc := newTestService(t, llm.NewFake())
+	alice := auth.NewUserInfoContext(context.Background(), auth.UserInfo{Username: "alice"})
+	bob := auth.NewUserInfoContext(context.Background(), auth.UserInfo{Username: "bob"})
+
+	repo := dao.GetConversationRepo()
+	first := repo.Save(alice, &model.Conversation{Username: "alice", Title: "住宿费标准"})
+	second := repo.Save(alice, &model.Conversation{Username: "alice", Title: "会议室预约"})
+	repo.Save(bob, &model.Conversation{Username: "bob", Title: "机房巡检"})
+
+	pinned := true
+	title := "杭州住宿费标准"
+	if _, err := svc.PutConversation_Id(alice, first, dto.UpdateConversationReq{Title: &title, Pinned: &pinned}); err != nil {
+		t.Fatal(err)
+	}
+	list, err := svc.GetConversation(alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].Id != first || list[0].Title != title || !list[0].Pinned || list[1].Id != second {
+		t.Fatalf("conversations = %+v", list)
+	}
+
+	// 其他用户的对话视为不存在
+	func() {
+		defer func() {
+			if r := recover(); r == nil {
+				t.Fatal("bob should not see alice's conversation")
+			}
+		}()
+		_, _ = svc.GetConversation_Id(bob, first)
+	}()
+
+	if err = svc.DeleteConversation_Id(alice, first); err != nil {
+		t.Fatal(err)
+	}
+	if list, _ = svc.GetConversation(alice); len(list) != 1 || list[0].Id != second {
+		t.Fatalf("conversations = %+v", list)
+	}
+	if list, _ = svc.GetConversation(bob); len(list) != 1 {
+		t.Fatalf("conversations = %+v", list)
+	}
+}
+
+// hookWriter 每写出一条 SSE 消息之前调用 onEvent，onEvent 返回错误时模拟客户端断开连接
+type hookWriter struct {
+	*httptest.ResponseRecorder
+	onEvent func(id int, event dto.ChatResponse) error
+}
+
+func (w *hookWriter) Write(b []byte) (int, error) {
+	if id, event, ok := parseBlock(string(b)); ok {
+		if err := w.onEvent(id, event); err != nil {
+			return 0, err
+		}
+	}
+	return w.ResponseRecorder.Write(b)
+}
+
+func TestChatCancel(t *testing.T) {
+	useKnowledge(kdto.QueryResult{
+		Content: "出差住宿费一类城市每天不超过五百元。",
+	})
+	svc := newTestService(t, llm.NewFake(llm.Reply{
+		Chunks: []string{"1. 一类城市", "每天不超过", "五百元。"},
+		Delay:  50 * time.Millisecond,
+	}))
+	alice := auth.NewUserInfoContext(context.Background(), auth.UserInfo{Username: "alice"})
+	bob := auth.NewUserInfoContext(context.Background(), auth.UserInfo{Username: "bob"})
+
+	cancelled := false
+	w := &hookWriter{
+		ResponseRecorder: httptest.NewRecorder(),
+		onEvent: func(id int, event dto.ChatResponse) error {
+			if event.Type != "content" || cancelled {
+				return nil
+			}
+			cancelled = true
+			// 其他用户不能停止
+			func() {
+				defer func() {
+					if r := recover(); r == nil {
+						t.Error("bob should not cancel alice's chat")
+					}
+				}()
+				_ = svc.PostChat_IdCancel(bob, event.RequestID)
+			}()
+			if err := svc.PostChat_IdCancel(alice, event.RequestID); err != nil {
+				t.Error(err)
+			}
+			return nil
+		},
+	}
+	_ = svc.Chat(contextutil.NewResponseWriterContext(alice, w), dto.ChatRequest{
+		Prompt: "住宿费标准是多少",
+	})
+
+	events := parseEvents(t, w.Body.String())
+	if got := eventTypes(events); got != "sources,content,conversation,done" {
+		t.Fatalf("events = %s", got)
+	}
+	if done := events[3].Done; done == nil || done.FinishReason != "cancelled" {
+		t.Fatalf("done = %+v", done)
+	}
+
+	// 已经生成的部分作为截断的回答保存
+	messages := dao.GetConversationRepo().ListMessages(context.Background(), conversationOf(events), 0)
+	if len(messages) != 2 || messages[1].Content != "1. 一类城市" || !messages[1].Truncated {
+		t.Fatalf("messages = %+v", messages)
+	}
+}
+
+func TestChatResume(t *testing.T) {
+	useKnowledge(kdto.QueryResult{
+		Content: "出差住宿费一类城市每天不超过五百元。",
+	})
+	svc := newTestService(t, llm.NewFake(llm.Reply{
+		Chunks: []string{"1. 一类城市", "每天不超过", "五百元。"},
+		Delay:  20 * time.Millisecond,
+	}))
+	alice := auth.NewUserInfoContext(context.Background(), auth.UserInfo{Username: "alice"})
+
+	// 收到第一段回答之后断开连接
+	var requestID string
+	lastEventID := 0
+	w := &hookWriter{
+		ResponseRecorder: httptest.NewRecorder(),
+		onEvent: func(id int, event dto.ChatResponse) error {
+			if requestID != "" {
+				return errors.New("broken pipe")
+			}
+			if event.Type == "content" {
+				requestID = event.RequestID
+			}
+			lastEventID = id
+			return nil
+		},
+	}
+	_ = svc.Chat(contextutil.NewResponseWriterContext(alice, w), dto.ChatRequest{
+		Prompt: "住宿费标准是多少",
+	})
+	firstIds, first := parseStream(t, w.Body.String())
+	if got := eventTypes(first); got != "sources,content" {
+		t.Fatalf("events = %s", got)
+	}
+
+	// 带上 Last-Event-ID 重连，从断开的位置继续
+	recorder := httptest.NewRecorder()
+	ctx := contextutil.NewLastEventIDContext(contextutil.NewResponseWriterContext(alice, recorder), strconv.Itoa(lastEventID))
+	if err := svc.GetChat_IdEvents(ctx, requestID); err != nil {
+		t.Fatal(err)
+	}
+	secondIds, second := parseStream(t, recorder.Body.String())
+	if got := eventTypes(second); got != "content,content,conversation,done" {
+		t.Fatalf("events = %s", got)
+	}
+	ids := append(firstIds, secondIds...)
+	for i, id := range ids {
+		if id != i+1 {
+			t.Fatalf("ids = %v", ids)
+		}
+	}
+	answer := first[1].Content + second[0].Content + second[1].Content
+	if answer != "1. 一类城市每天不超过五百元。" || second[3].Done.FinishReason != "stop" {
+		t.Fatalf("answer = %q, done = %+v", answer, second[3].Done)
+	}
+
+	// 其他用户不能重连
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fatal("bob should not resume alice's chat")
+		}
+	}()
+	bob := auth.NewUserInfoContext(context.Background(), auth.UserInfo{Username: "bob"})
+	_ = svc.GetChat_IdEvents(contextutil.NewResponseWriterContext(bob, httptest.NewRecorder()), requestID)
+}
+
+func TestChatDuplicateRequestID(t *testing.T) {
+	useKnowledge(kdto.QueryResult{
+		Content: "出差住宿费一类城市每天不超过五百元。",
+	})
+	svc := newTestService(t, llm.NewFake(llm.Reply{
+		Chunks: []string{"一类城市每天不超过五百元。"},
+	}, llm.Reply{
+		Chunks: []string{"机房每周巡检一次。"},
+	}))
+	alice := auth.NewUserInfoContext(context.Background(), auth.UserInfo{Username: "alice"})
+	bob := auth.NewUserInfoContext(context.Background(), auth.UserInfo{Username: "bob"})
+	send := func(ctx context.Context, prompt string) []dto.ChatResponse {
+		recorder := httptest.NewRecorder()
+		ctx = requestid.NewContext(contextutil.NewResponseWriterContext(ctx, recorder), "client-id")
+		_ = svc.Chat(ctx, dto.ChatRequest{Prompt: prompt})
+		return parseEvents(t, recorder.Body.String())
+	}
+
+	first := send(alice, "住宿费标准是多少")
+	if first[0].RequestID != "client-id" {
+		t.Fatalf("request id = %q", first[0].RequestID)
+	}
+	// 请求头中的请求ID已经被占用时使用服务端生成的ID，不会覆盖 alice 的对话
+	second := send(bob, "机房多久巡检一次")
+	if second[0].RequestID == "client-id" || second[0].RequestID == "" {
+		t.Fatalf("request id = %q", second[0].RequestID)
+	}
+
+	recorder := httptest.NewRecorder()
+	if err := svc.GetChat_IdEvents(contextutil.NewResponseWriterContext(alice, recorder), "client-id"); err != nil {
+		t.Fatal(err)
+	}
+	if events := parseEvents(t, recorder.Body.String()); answerOf(events) != "一类城市每天不超过五百元。" {
+		t.Fatalf("alice's events = %+v", events)
+	}
+	recorder = httptest.NewRecorder()
+	if err := svc.GetChat_IdEvents(contextutil.NewResponseWriterContext(bob, recorder), second[0].RequestID); err != nil {
+		t.Fatal(err)
+	}
+	if events := parseEvents(t, recorder.Body.String()); answerOf(events) != "机房每周巡检一次。" {
+		t.Fatalf("bob's events = %+v", events)
+	}
+}
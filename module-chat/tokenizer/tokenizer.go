@@ -0,0 +1,129 @@
+package tokenizer
+
+import (
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkoukk/tiktoken-go"
+	"github.com/samber/lo"
+	"github.com/unionj-cloud/toolkit/zlogger"
+)
+
+// Tokenizer 统计文本的 token 数量
+type Tokenizer interface {
+	Count(text string) int
+	// Truncate 返回文本开头不超过 n 个 token 的部分
+	Truncate(text string, n int) string
+}
+
+// 模型名称 -> *entry
+var cache sync.Map
+
+// 测试中替换为不访问网络的实现
+var encodingForModel = tiktoken.EncodingForModel
+
+// entry 模型分词器的加载状态，ready 关闭后 t 可用
+type entry struct {
+	ready chan struct{}
+	t     Tokenizer
+}
+
+// load 在后台加载模型的分词器，每个模型只加载一次。tiktoken 首次使用某种编码时会下载编码文件，且没有超时
+func load(model string) *entry {
+	e := &entry{ready: make(chan struct{})}
+	actual, loaded := cache.LoadOrStore(model, e)
+	if loaded {
+		return actual.(*entry)
+	}
+	newEncoding := encodingForModel
+	go func() {
+		defer close(e.ready)
+		e.t = Estimator{}
+		if encoding, err := newEncoding(model); err == nil {
+			e.t = &tiktokenTokenizer{encoding: encoding}
+		} else {
+			zlogger.Warn().Msgf("No tokenizer for model %s, estimate token counts from characters: %v", model, err)
+		}
+	}()
+	return e
+}
+
+// Load 启动时加载模型的分词器，最多等待 timeout，超时后在后台继续加载
+func Load(timeout time.Duration, models ...string) {
+	deadline := time.After(timeout)
+	for _, model := range lo.Uniq(models) {
+		select {
+		case <-load(model).ready:
+		case <-deadline:
+			zlogger.Warn().Msgf("Loading tokenizers timed out after %s, estimate token counts from characters until loaded", timeout)
+			return
+		}
+	}
+}
+
+// For 返回模型对应的分词器，不等待加载：分词器还没有加载完成、tiktoken 不认识的模型或者编码文件下载失败时按字符估算
+func For(model string) Tokenizer {
+	e := load(model)
+	select {
+	case <-e.ready:
+		return e.t
+	default:
+		return Estimator{}
+	}
+}
+
+type tiktokenTokenizer struct {
+	encoding *tiktoken.Tiktoken
+}
+
+func (receiver *tiktokenTokenizer) Count(text string) int {
+	return len(receiver.encoding.Encode(text, nil, nil))
+}
+
+func (receiver *tiktokenTokenizer) Truncate(text string, n int) string {
+	tokens := receiver.encoding.Encode(text, nil, nil)
+	if len(tokens) <= n {
+		return text
+	}
+	// 一个汉字可能被编码成多个 token，截断处不完整的字符直接去掉
+	return strings.ToValidUTF8(receiver.encoding.Decode(tokens[:max(n, 0)]), "")
+}
+
+// Estimator 按字符估算 token 数量：中日韩文字每个字算一个 token，其余字符每 4 个字节算一个 token
+type Estimator struct{}
+
+func (Estimator) Count(text string) int {
+	var cjk, other int
+	for _, r := range text {
+		if isCJK(r) {
+			cjk++
+		} else {
+			other += utf8.RuneLen(r)
+		}
+	}
+	return cjk + (other+3)/4
+}
+
+func (Estimator) Truncate(text string, n int) string {
+	var cjk, other int
+	for i, r := range text {
+		if isCJK(r) {
+			cjk++
+		} else {
+			other += utf8.RuneLen(r)
+		}
+		if cjk+(other+3)/4 > n {
+			return text[:i]
+		}
+	}
+	return text
+}
+
+// isCJK 中日韩文字以及全角标点
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) ||
+		(r >= 0x3000 && r <= 0x303f) || (r >= 0xff00 && r <= 0xffef)
+}
@@ -0,0 +1,61 @@
+package tokenizer
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pkoukk/tiktoken-go"
+)
+
+func TestEstimator(t *testing.T) {
+	var e Estimator
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"住宿费", 3},
+		{"hello world!", 3},
+		{"一类城市 500 元。", 8},
+	}
+	for _, tt := range tests {
+		if got := e.Count(tt.text); got != tt.want {
+			t.Errorf("Count(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+
+	if got := e.Truncate("一类城市每天不超过五百元", 4); got != "一类城市" {
+		t.Errorf("Truncate = %q", got)
+	}
+	if got := e.Truncate("住宿费", 10); got != "住宿费" {
+		t.Errorf("Truncate = %q", got)
+	}
+}
+
+func TestForUnknownModel(t *testing.T) {
+	if _, ok := For("unknown-model").(Estimator); !ok {
+		t.Fatal("unknown models should fall back to the estimator")
+	}
+}
+
+func TestForDoesNotWaitForLoading(t *testing.T) {
+	release := make(chan struct{})
+	encodingForModel = func(model string) (*tiktoken.Tiktoken, error) {
+		<-release
+		return nil, errors.New("offline")
+	}
+	t.Cleanup(func() {
+		encodingForModel = tiktoken.EncodingForModel
+	})
+
+	start := time.Now()
+	Load(50*time.Millisecond, "slow-model", "slow-model")
+	if _, ok := For("slow-model").(Estimator); !ok {
+		t.Fatal("models still loading should fall back to the estimator")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("waited %s for the tokenizer", elapsed)
+	}
+	close(release)
+}
@@ -13,6 +13,18 @@ import (
 
 type ModuleChatHandler interface {
 	Chat(w http.ResponseWriter, r *http.Request)
+	PostChat_IdCancel(w http.ResponseWriter, r *http.Request)
+	GetChat_IdEvents(w http.ResponseWriter, r *http.Request)
+	PostV1ChatCompletions(w http.ResponseWriter, r *http.Request)
+	GetV1Models(w http.ResponseWriter, r *http.Request)
+	GetConversation(w http.ResponseWriter, r *http.Request)
+	GetConversation_Id(w http.ResponseWriter, r *http.Request)
+	PutConversation_Id(w http.ResponseWriter, r *http.Request)
+	DeleteConversation_Id(w http.ResponseWriter, r *http.Request)
+	GetPrompt(w http.ResponseWriter, r *http.Request)
+	GetPrompt_Name(w http.ResponseWriter, r *http.Request)
+	PostPrompt(w http.ResponseWriter, r *http.Request)
+	PutPrompt_NameActive(w http.ResponseWriter, r *http.Request)
 }
 
 func Routes(handler ModuleChatHandler) []rest.Route {
@@ -23,10 +35,115 @@ func Routes(handler ModuleChatHandler) []rest.Route {
 			Pattern:     "/chat",
 			HandlerFunc: handler.Chat,
 		},
+		{
+			Name:        "PostChat_IdCancel",
+			Method:      "POST",
+			Pattern:     "/chat/:id/cancel",
+			HandlerFunc: handler.PostChat_IdCancel,
+		},
+		{
+			Name:        "GetChat_IdEvents",
+			Method:      "GET",
+			Pattern:     "/chat/:id/events",
+			HandlerFunc: handler.GetChat_IdEvents,
+		},
+		{
+			Name:        "PostV1ChatCompletions",
+			Method:      "POST",
+			Pattern:     "/v1/chat/completions",
+			HandlerFunc: handler.PostV1ChatCompletions,
+		},
+		{
+			Name:        "GetV1Models",
+			Method:      "GET",
+			Pattern:     "/v1/models",
+			HandlerFunc: handler.GetV1Models,
+		},
+		{
+			Name:        "GetConversation",
+			Method:      "GET",
+			Pattern:     "/conversation",
+			HandlerFunc: handler.GetConversation,
+		},
+		{
+			Name:        "GetConversation_Id",
+			Method:      "GET",
+			Pattern:     "/conversation/:id",
+			HandlerFunc: handler.GetConversation_Id,
+		},
+		{
+			Name:        "PutConversation_Id",
+			Method:      "PUT",
+			Pattern:     "/conversation/:id",
+			HandlerFunc: handler.PutConversation_Id,
+		},
+		{
+			Name:        "DeleteConversation_Id",
+			Method:      "DELETE",
+			Pattern:     "/conversation/:id",
+			HandlerFunc: handler.DeleteConversation_Id,
+		},
+		{
+			Name:        "GetPrompt",
+			Method:      "GET",
+			Pattern:     "/prompt",
+			HandlerFunc: handler.GetPrompt,
+		},
+		{
+			Name:        "GetPrompt_Name",
+			Method:      "GET",
+			Pattern:     "/prompt/:name",
+			HandlerFunc: handler.GetPrompt_Name,
+		},
+		{
+			Name:        "PostPrompt",
+			Method:      "POST",
+			Pattern:     "/prompt",
+			HandlerFunc: handler.PostPrompt,
+		},
+		{
+			Name:        "PutPrompt_NameActive",
+			Method:      "PUT",
+			Pattern:     "/prompt/:name/active",
+			HandlerFunc: handler.PutPrompt_NameActive,
+		},
 	}
 }
 
-var RouteAnnotationStore = framework.AnnotationStore{}
+var RouteAnnotationStore = framework.AnnotationStore{
+	"GetPrompt": {
+		{
+			Name: "@role",
+			Params: []string{
+				"admin",
+			},
+		},
+	},
+	"GetPrompt_Name": {
+		{
+			Name: "@role",
+			Params: []string{
+				"admin",
+			},
+		},
+	},
+	"PostPrompt": {
+		{
+			Name: "@role",
+			Params: []string{
+				"admin",
+			},
+		},
+	},
+	"PutPrompt_NameActive": {
+		{
+			Name: "@role",
+			Params: []string{
+				"admin",
+			},
+		},
+	},
+}
 
 func init() {
 	framework.RegisterAnnotationStore(RouteAnnotationStore)
@@ -6,12 +6,15 @@ package httpsrv
 
 import (
 	"context"
+	"errors"
 	service "go-doudou-rag/module-chat"
 	"go-doudou-rag/module-chat/dto"
 	"net/http"
 
 	"github.com/bytedance/sonic"
 	"github.com/unionj-cloud/go-doudou/v2/framework/rest"
+	"github.com/unionj-cloud/go-doudou/v2/framework/rest/httprouter"
+	"github.com/unionj-cloud/toolkit/cast"
 )
 
 var json = sonic.ConfigDefault
@@ -43,6 +46,340 @@ func (receiver *ModuleChatHandlerImpl) Chat(_writer http.ResponseWriter, _req *h
 	}
 }
 
+func (receiver *ModuleChatHandlerImpl) PostChat_IdCancel(_writer http.ResponseWriter, _req *http.Request) {
+	var (
+		ctx context.Context
+		id  string
+		err error
+	)
+	ctx = _req.Context()
+	paramsFromCtx := httprouter.ParamsFromContext(_req.Context())
+	id = paramsFromCtx.ByName("id")
+	err = receiver.moduleChat.PostChat_IdCancel(
+		ctx,
+		id,
+	)
+	if err != nil {
+		panic(err)
+	}
+	_writer.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if _err := json.NewEncoder(_writer).Encode(struct {
+	}{}); _err != nil {
+		rest.HandleInternalServerError(_err)
+	}
+}
+
+func (receiver *ModuleChatHandlerImpl) GetChat_IdEvents(_writer http.ResponseWriter, _req *http.Request) {
+	var (
+		ctx context.Context
+		id  string
+		err error
+	)
+	ctx = _req.Context()
+	paramsFromCtx := httprouter.ParamsFromContext(_req.Context())
+	id = paramsFromCtx.ByName("id")
+	err = receiver.moduleChat.GetChat_IdEvents(
+		ctx,
+		id,
+	)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func (receiver *ModuleChatHandlerImpl) PostV1ChatCompletions(_writer http.ResponseWriter, _req *http.Request) {
+	var (
+		ctx context.Context
+		req dto.ChatCompletionReq
+		err error
+	)
+	ctx = _req.Context()
+	if _err := json.NewDecoder(_req.Body).Decode(&req); _err != nil {
+		rest.HandleBadRequestErr(_err)
+	} else {
+		if _err := rest.ValidateStruct(req); _err != nil {
+			rest.HandleBadRequestErr(_err)
+		}
+	}
+	err = receiver.moduleChat.PostV1ChatCompletions(
+		ctx,
+		req,
+	)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func (receiver *ModuleChatHandlerImpl) GetV1Models(_writer http.ResponseWriter, _req *http.Request) {
+	var (
+		ctx    context.Context
+		object string
+		data   []dto.OpenaiModel
+		err    error
+	)
+	ctx = _req.Context()
+	object, data, err = receiver.moduleChat.GetV1Models(
+		ctx,
+	)
+	if err != nil {
+		panic(err)
+	}
+	_writer.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if _err := json.NewEncoder(_writer).Encode(struct {
+		Object string            `json:"object"`
+		Data   []dto.OpenaiModel `json:"data"`
+	}{
+		Object: object,
+		Data:   data,
+	}); _err != nil {
+		rest.HandleInternalServerError(_err)
+	}
+}
+
+func (receiver *ModuleChatHandlerImpl) GetConversation(_writer http.ResponseWriter, _req *http.Request) {
+	var (
+		ctx  context.Context
+		data []dto.ConversationDTO
+		err  error
+	)
+	ctx = _req.Context()
+	data, err = receiver.moduleChat.GetConversation(
+		ctx,
+	)
+	if err != nil {
+		panic(err)
+	}
+	_writer.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if _err := json.NewEncoder(_writer).Encode(struct {
+		Data []dto.ConversationDTO `json:"data"`
+	}{
+		Data: data,
+	}); _err != nil {
+		rest.HandleInternalServerError(_err)
+	}
+}
+func (receiver *ModuleChatHandlerImpl) GetConversation_Id(_writer http.ResponseWriter, _req *http.Request) {
+	var (
+		ctx  context.Context
+		id   uint
+		data dto.ConversationDetail
+		err  error
+	)
+	ctx = _req.Context()
+	paramsFromCtx := httprouter.ParamsFromContext(_req.Context())
+	if casted, _err := cast.ToUintE(paramsFromCtx.ByName("id")); _err != nil {
+		rest.HandleBadRequestErr(_err)
+	} else {
+		id = casted
+	}
+	data, err = receiver.moduleChat.GetConversation_Id(
+		ctx,
+		id,
+	)
+	if err != nil {
+		panic(err)
+	}
+	_writer.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if _err := json.NewEncoder(_writer).Encode(struct {
+		Data dto.ConversationDetail `json:"data"`
+	}{
+		Data: data,
+	}); _err != nil {
+		rest.HandleInternalServerError(_err)
+	}
+}
+func (receiver *ModuleChatHandlerImpl) PutConversation_Id(_writer http.ResponseWriter, _req *http.Request) {
+	var (
+		ctx  context.Context
+		id   uint
+		req  dto.UpdateConversationReq
+		data dto.ConversationDTO
+		err  error
+	)
+	ctx = _req.Context()
+	paramsFromCtx := httprouter.ParamsFromContext(_req.Context())
+	if casted, _err := cast.ToUintE(paramsFromCtx.ByName("id")); _err != nil {
+		rest.HandleBadRequestErr(_err)
+	} else {
+		id = casted
+	}
+	if _req.Body == nil {
+		rest.HandleBadRequestErr(errors.New("missing request body"))
+	} else {
+		if _err := json.NewDecoder(_req.Body).Decode(&req); _err != nil {
+			rest.HandleBadRequestErr(_err)
+		} else {
+			if _err := rest.ValidateStruct(req); _err != nil {
+				rest.HandleBadRequestErr(_err)
+			}
+		}
+	}
+	data, err = receiver.moduleChat.PutConversation_Id(
+		ctx,
+		id,
+		req,
+	)
+	if err != nil {
+		panic(err)
+	}
+	_writer.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if _err := json.NewEncoder(_writer).Encode(struct {
+		Data dto.ConversationDTO `json:"data"`
+	}{
+		Data: data,
+	}); _err != nil {
+		rest.HandleInternalServerError(_err)
+	}
+}
+func (receiver *ModuleChatHandlerImpl) DeleteConversation_Id(_writer http.ResponseWriter, _req *http.Request) {
+	var (
+		ctx context.Context
+		id  uint
+		err error
+	)
+	ctx = _req.Context()
+	paramsFromCtx := httprouter.ParamsFromContext(_req.Context())
+	if casted, _err := cast.ToUintE(paramsFromCtx.ByName("id")); _err != nil {
+		rest.HandleBadRequestErr(_err)
+	} else {
+		id = casted
+	}
+	err = receiver.moduleChat.DeleteConversation_Id(
+		ctx,
+		id,
+	)
+	if err != nil {
+		panic(err)
+	}
+	_writer.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if _err := json.NewEncoder(_writer).Encode(struct {
+	}{}); _err != nil {
+		rest.HandleInternalServerError(_err)
+	}
+}
+func (receiver *ModuleChatHandlerImpl) GetPrompt(_writer http.ResponseWriter, _req *http.Request) {
+	var (
+		ctx  context.Context
+		data []dto.PromptTemplateDTO
+		err  error
+	)
+	ctx = _req.Context()
+	data, err = receiver.moduleChat.GetPrompt(
+		ctx,
+	)
+	if err != nil {
+		panic(err)
+	}
+	_writer.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if _err := json.NewEncoder(_writer).Encode(struct {
+		Data []dto.PromptTemplateDTO `json:"data"`
+	}{
+		Data: data,
+	}); _err != nil {
+		rest.HandleInternalServerError(_err)
+	}
+}
+func (receiver *ModuleChatHandlerImpl) GetPrompt_Name(_writer http.ResponseWriter, _req *http.Request) {
+	var (
+		ctx  context.Context
+		name string
+		data []dto.PromptTemplateDTO
+		err  error
+	)
+	ctx = _req.Context()
+	paramsFromCtx := httprouter.ParamsFromContext(_req.Context())
+	name = paramsFromCtx.ByName("name")
+	data, err = receiver.moduleChat.GetPrompt_Name(
+		ctx,
+		name,
+	)
+	if err != nil {
+		panic(err)
+	}
+	_writer.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if _err := json.NewEncoder(_writer).Encode(struct {
+		Data []dto.PromptTemplateDTO `json:"data"`
+	}{
+		Data: data,
+	}); _err != nil {
+		rest.HandleInternalServerError(_err)
+	}
+}
+func (receiver *ModuleChatHandlerImpl) PostPrompt(_writer http.ResponseWriter, _req *http.Request) {
+	var (
+		ctx  context.Context
+		req  dto.SavePromptReq
+		data dto.PromptTemplateDTO
+		err  error
+	)
+	ctx = _req.Context()
+	if _req.Body == nil {
+		rest.HandleBadRequestErr(errors.New("missing request body"))
+	} else {
+		if _err := json.NewDecoder(_req.Body).Decode(&req); _err != nil {
+			rest.HandleBadRequestErr(_err)
+		} else {
+			if _err := rest.ValidateStruct(req); _err != nil {
+				rest.HandleBadRequestErr(_err)
+			}
+		}
+	}
+	data, err = receiver.moduleChat.PostPrompt(
+		ctx,
+		req,
+	)
+	if err != nil {
+		panic(err)
+	}
+	_writer.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if _err := json.NewEncoder(_writer).Encode(struct {
+		Data dto.PromptTemplateDTO `json:"data"`
+	}{
+		Data: data,
+	}); _err != nil {
+		rest.HandleInternalServerError(_err)
+	}
+}
+func (receiver *ModuleChatHandlerImpl) PutPrompt_NameActive(_writer http.ResponseWriter, _req *http.Request) {
+	var (
+		ctx  context.Context
+		name string
+		req  dto.ActivatePromptReq
+		data dto.PromptTemplateDTO
+		err  error
+	)
+	ctx = _req.Context()
+	paramsFromCtx := httprouter.ParamsFromContext(_req.Context())
+	name = paramsFromCtx.ByName("name")
+	if _req.Body == nil {
+		rest.HandleBadRequestErr(errors.New("missing request body"))
+	} else {
+		if _err := json.NewDecoder(_req.Body).Decode(&req); _err != nil {
+			rest.HandleBadRequestErr(_err)
+		} else {
+			if _err := rest.ValidateStruct(req); _err != nil {
+				rest.HandleBadRequestErr(_err)
+			}
+		}
+	}
+	data, err = receiver.moduleChat.PutPrompt_NameActive(
+		ctx,
+		name,
+		req,
+	)
+	if err != nil {
+		panic(err)
+	}
+	_writer.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if _err := json.NewEncoder(_writer).Encode(struct {
+		Data dto.PromptTemplateDTO `json:"data"`
+	}{
+		Data: data,
+	}); _err != nil {
+		rest.HandleInternalServerError(_err)
+	}
+}
+
 func NewModuleChatHandler(moduleChat service.ModuleChat) ModuleChatHandler {
 	return &ModuleChatHandlerImpl{
 		moduleChat,
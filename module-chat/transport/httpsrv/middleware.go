@@ -11,7 +11,11 @@ import (
 
 func InjectResponseWriter(inner http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		r = r.WithContext(contextutil.NewResponseWriterContext(r.Context(), w))
+		ctx := contextutil.NewResponseWriterContext(r.Context(), w)
+		if lastEventID := r.Header.Get("Last-Event-ID"); lastEventID != "" {
+			ctx = contextutil.NewLastEventIDContext(ctx, lastEventID)
+		}
+		r = r.WithContext(ctx)
 		inner.ServeHTTP(w, r)
 	})
 }
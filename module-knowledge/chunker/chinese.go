@@ -0,0 +1,143 @@
+package chunker
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/tmc/langchaingo/textsplitter"
+)
+
+var _ textsplitter.TextSplitter = (*ChineseSplitter)(nil)
+
+// ChineseSplitter 先在中文句末标点和换行处断句，再把相邻句子合并到不超过 ChunkSize 个字符，
+// 相邻分块之间重叠不超过 ChunkOverlap 个字符的完整句子。超长的单句按字符硬切
+type ChineseSplitter struct {
+	Options
+}
+
+func NewChineseSplitter(opts Options) *ChineseSplitter {
+	return &ChineseSplitter{
+		Options: opts,
+	}
+}
+
+func (receiver *ChineseSplitter) SplitText(text string) ([]string, error) {
+	return mergeUnits(splitSentences(text), "", receiver.ChunkSize, receiver.ChunkOverlap, ""), nil
+}
+
+// splitSentences 在。！？；!?; 和换行处断句，标点、换行保留在句末，紧跟的引号、括号也归入前一句，
+// 因此直接拼接各句即可还原原文
+func splitSentences(text string) []string {
+	var sentences []string
+	var sb strings.Builder
+	runes := []rune(text)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		sb.WriteRune(r)
+		if r != '\n' && !strings.ContainsRune("。！？；!?;…", r) {
+			continue
+		}
+		for i+1 < len(runes) && strings.ContainsRune("。！？；!?;…”’」』）) \t\n", runes[i+1]) {
+			i++
+			sb.WriteRune(runes[i])
+		}
+		sentences = appendSentence(sentences, sb.String())
+		sb.Reset()
+	}
+	return appendSentence(sentences, sb.String())
+}
+
+func appendSentence(sentences []string, sentence string) []string {
+	if strings.TrimSpace(sentence) == "" {
+		return sentences
+	}
+	return append(sentences, sentence)
+}
+
+// mergeUnits 把切好的句子或条款用 sep 连接，贪心地合并成分块，单元本身超长时按字符硬切。
+// prefix 不为空时加在硬切出的第二段及以后每一段前面，用于保留条款编号等上下文
+func mergeUnits(units []string, sep string, chunkSize, chunkOverlap int, prefix string) []string {
+	if chunkSize <= 0 {
+		return units
+	}
+
+	var chunks []string
+	var current []string
+	size := 0
+	// current 中是否有还没有输出过的单元，只剩重叠部分时不再单独成块
+	fresh := false
+
+	flush := func() {
+		if fresh {
+			chunks = append(chunks, strings.TrimSpace(strings.Join(current, sep)))
+		}
+		fresh = false
+
+		// 从末尾保留若干完整单元作为下一个分块的开头
+		var overlap []string
+		overlapSize := 0
+		for i := len(current) - 1; i >= 0; i-- {
+			n := utf8.RuneCountInString(current[i])
+			if overlapSize+n > chunkOverlap {
+				break
+			}
+			overlap = append([]string{current[i]}, overlap...)
+			overlapSize += n
+		}
+		current = overlap
+		size = overlapSize
+	}
+
+	for _, unit := range units {
+		n := utf8.RuneCountInString(unit)
+		if n > chunkSize {
+			flush()
+			current, size = nil, 0
+			chunks = append(chunks, hardSplit(strings.TrimSpace(unit), chunkSize, chunkOverlap, prefix)...)
+			continue
+		}
+		if size+n > chunkSize {
+			flush()
+			// 重叠部分加上当前单元仍然超长时放弃重叠
+			if size+n > chunkSize {
+				current, size = nil, 0
+			}
+		}
+		current = append(current, unit)
+		size += n
+		fresh = true
+	}
+	flush()
+
+	return chunks
+}
+
+// hardSplit 按字符切分超长的单元，带上 prefix 和换行后每一段仍然不超过 chunkSize，
+// chunkSize 放不下 prefix 和重叠部分时不加 prefix
+func hardSplit(text string, chunkSize, chunkOverlap int, prefix string) []string {
+	runes := []rune(text)
+	prefixRunes := []rune(prefix)
+	size := chunkSize
+	if len(prefixRunes) > 0 {
+		size -= len(prefixRunes) + 1
+	}
+	if size <= chunkOverlap {
+		size = chunkSize
+		prefixRunes = nil
+	}
+	step := size - min(chunkOverlap, size-1)
+
+	var chunks []string
+	for start := 0; start < len(runes); start += step {
+		end := min(start+size, len(runes))
+		chunk := string(runes[start:end])
+		if start > 0 && len(prefixRunes) > 0 {
+			chunk = string(prefixRunes) + "\n" + chunk
+		}
+		chunks = append(chunks, chunk)
+		if end == len(runes) {
+			break
+		}
+	}
+	return chunks
+}
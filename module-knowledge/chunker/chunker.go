@@ -0,0 +1,99 @@
+package chunker
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/tmc/langchaingo/textsplitter"
+)
+
+const (
+	// StrategyRecursive 按段落、换行、空格递归切分，默认策略
+	StrategyRecursive = "recursive"
+	// StrategyToken 按 tiktoken 计算的 token 数切分
+	StrategyToken = "token"
+	// StrategyChinese 在句号、问号、感叹号、分号等中文句末标点处断句后合并
+	StrategyChinese = "chinese"
+	// StrategyMarkdown 按 markdown 标题层级切分，分块带有所在的各级标题
+	StrategyMarkdown = "markdown"
+	// StrategyPolicy 按“第X条”“一、”“（二）”等条款编号切分，单个条款不会被拆开
+	StrategyPolicy = "policy"
+)
+
+// Options 中的长度单位由各策略自行决定，token 策略为 token 数，其余为字符数
+type Options struct {
+	ChunkSize    int
+	ChunkOverlap int
+}
+
+// Factory 根据参数创建分割器
+type Factory func(opts Options) textsplitter.TextSplitter
+
+var (
+	mu       sync.RWMutex
+	registry = make(map[string]Factory)
+)
+
+func init() {
+	Register(StrategyRecursive, func(opts Options) textsplitter.TextSplitter {
+		return textsplitter.NewRecursiveCharacter(
+			textsplitter.WithChunkSize(opts.ChunkSize),
+			textsplitter.WithChunkOverlap(opts.ChunkOverlap),
+		)
+	})
+	Register(StrategyToken, func(opts Options) textsplitter.TextSplitter {
+		return textsplitter.NewTokenSplitter(
+			textsplitter.WithChunkSize(opts.ChunkSize),
+			textsplitter.WithChunkOverlap(opts.ChunkOverlap),
+		)
+	})
+	Register(StrategyMarkdown, func(opts Options) textsplitter.TextSplitter {
+		// 每个分块前面带上它所在的各级标题，拆开的小节也能检索到标题中的关键词
+		return textsplitter.NewMarkdownTextSplitter(
+			textsplitter.WithChunkSize(opts.ChunkSize),
+			textsplitter.WithChunkOverlap(opts.ChunkOverlap),
+			textsplitter.WithHeadingHierarchy(true),
+		)
+	})
+	Register(StrategyChinese, func(opts Options) textsplitter.TextSplitter {
+		return NewChineseSplitter(opts)
+	})
+	Register(StrategyPolicy, func(opts Options) textsplitter.TextSplitter {
+		return NewPolicySplitter(opts)
+	})
+}
+
+// Register 注册一个分割策略，同名策略后注册的覆盖先注册的
+func Register(name string, factory Factory) {
+	mu.Lock()
+	defer mu.Unlock()
+	registry[normalize(name)] = factory
+}
+
+// New 按策略名称创建分割器
+func New(name string, opts Options) (textsplitter.TextSplitter, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	factory, ok := registry[normalize(name)]
+	if !ok {
+		return nil, false
+	}
+	return factory(opts), true
+}
+
+// Names 返回所有已注册的策略名称
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func normalize(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
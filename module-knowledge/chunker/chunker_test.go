@@ -0,0 +1,254 @@
+package chunker
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSplitSentences(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{
+			name: "中文句末标点",
+			text: "第一句。第二句！第三句？第四句；最后一句",
+			want: []string{"第一句。", "第二句！", "第三句？", "第四句；", "最后一句"},
+		},
+		{
+			name: "引号括号归入前一句",
+			text: "他说：“好。”然后走了（完）。后来呢？」",
+			want: []string{"他说：“好。”", "然后走了（完）。", "后来呢？」"},
+		},
+		{
+			name: "换行和英文标点",
+			text: "标题\n\nOK! Next;last",
+			want: []string{"标题\n\n", "OK! ", "Next;", "last"},
+		},
+		{
+			name: "省略号和空白",
+			text: "  \n等等……好",
+			want: []string{"等等……", "好"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitSentences(tt.text)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("splitSentences() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeUnits(t *testing.T) {
+	tests := []struct {
+		name    string
+		units   []string
+		sep     string
+		size    int
+		overlap int
+		prefix  string
+		want    []string
+	}{
+		{
+			name:  "不超过分块大小",
+			units: []string{"一二三。", "四五六。", "七八九。"},
+			size:  8,
+			want:  []string{"一二三。四五六。", "七八九。"},
+		},
+		{
+			name:    "重叠完整的句子",
+			units:   []string{"一二三。", "四五六。", "七八九。", "十。"},
+			size:    8,
+			overlap: 4,
+			want:    []string{"一二三。四五六。", "四五六。七八九。", "七八九。十。"},
+		},
+		{
+			name:    "重叠放不下整句时不重叠",
+			units:   []string{"一二三。", "四五六。", "七八九。"},
+			size:    8,
+			overlap: 3,
+			want:    []string{"一二三。四五六。", "七八九。"},
+		},
+		{
+			name:    "重叠加上当前句超长时放弃重叠",
+			units:   []string{"一二。", "三四五六七。"},
+			size:    7,
+			overlap: 3,
+			want:    []string{"一二。", "三四五六七。"},
+		},
+		{
+			name:    "单句超长时硬切",
+			units:   []string{"短句。", "一二三四五六七八九十", "尾。"},
+			size:    6,
+			overlap: 2,
+			want:    []string{"短句。", "一二三四五六", "五六七八九十", "尾。"},
+		},
+		{
+			name:  "分隔符",
+			units: []string{"第一条 甲", "第二条 乙", "第三条 丙"},
+			sep:   "\n",
+			size:  10,
+			want:  []string{"第一条 甲\n第二条 乙", "第三条 丙"},
+		},
+		{
+			name:  "不限制大小",
+			units: []string{"一", "二"},
+			want:  []string{"一", "二"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mergeUnits(tt.units, tt.sep, tt.size, tt.overlap, tt.prefix)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("mergeUnits() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHardSplit(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		size    int
+		overlap int
+		prefix  string
+		want    []string
+	}{
+		{
+			name: "不重叠",
+			text: "一二三四五六七八九十",
+			size: 4,
+			want: []string{"一二三四", "五六七八", "九十"},
+		},
+		{
+			name:    "重叠",
+			text:    "一二三四五六七八九十",
+			size:    6,
+			overlap: 2,
+			want:    []string{"一二三四五六", "五六七八九十"},
+		},
+		{
+			name:    "第二段起带上前缀",
+			text:    "一二三四五六七八九十",
+			size:    8,
+			overlap: 1,
+			prefix:  "第一条",
+			want:    []string{"一二三四", "第一条\n四五六七", "第一条\n七八九十"},
+		},
+		{
+			name:    "放不下前缀时不加前缀",
+			text:    "一二三四五六七八",
+			size:    5,
+			overlap: 1,
+			prefix:  "第一条",
+			want:    []string{"一二三四五", "五六七八"},
+		},
+		{
+			name:    "重叠不小于分块大小",
+			text:    "一二三四",
+			size:    2,
+			overlap: 5,
+			want:    []string{"一二", "二三", "三四"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := hardSplit(tt.text, tt.size, tt.overlap, tt.prefix)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("hardSplit() = %q, want %q", got, tt.want)
+			}
+			for _, chunk := range got {
+				if n := utf8.RuneCountInString(chunk); n > tt.size {
+					t.Fatalf("chunk %q has %d runes, more than %d", chunk, n, tt.size)
+				}
+			}
+		})
+	}
+}
+
+func TestStrategies(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy string
+		opts     Options
+		text     string
+		want     []string
+	}{
+		{
+			name:     "recursive",
+			strategy: StrategyRecursive,
+			opts:     Options{ChunkSize: 10},
+			text:     "aaaa bbbb cccc dddd\n\neeee",
+			want:     []string{"aaaa bbbb", "cccc dddd", "eeee"},
+		},
+		{
+			name:     "chinese",
+			strategy: " Chinese ",
+			opts:     Options{ChunkSize: 20, ChunkOverlap: 8},
+			text:     "第一句话很短。第二句话也很短！第三句“引号”？第四句；最后一句没有标点",
+			want:     []string{"第一句话很短。第二句话也很短！", "第二句话也很短！第三句“引号”？第四句；", "第四句；最后一句没有标点"},
+		},
+		{
+			name:     "markdown 分块带上各级标题",
+			strategy: StrategyMarkdown,
+			opts:     Options{ChunkSize: 40},
+			text:     "# 差旅管理办法\n\n## 住宿费\n\n一类城市每天不超过五百元，二类城市每天不超过四百元。\n\n## 交通费\n\n乘坐高铁二等座。\n",
+			want: []string{
+				"# 差旅管理办法",
+				"# 差旅管理办法\n## 住宿费\n一类城市每天不超过五百元，二类城市每天不超过四百元。",
+				"# 差旅管理办法\n## 交通费\n乘坐高铁二等座。",
+			},
+		},
+		{
+			name:     "policy 条款不拆开",
+			strategy: StrategyPolicy,
+			opts:     Options{ChunkSize: 40},
+			text:     "总则说明。\n第一条 出差住宿费按城市分档。\n第二条 一类城市每天不超过五百元。\n第三条 本办法自发布之日起施行。",
+			want: []string{
+				"总则说明。\n第一条 出差住宿费按城市分档。\n第二条 一类城市每天不超过五百元。",
+				"第三条 本办法自发布之日起施行。",
+			},
+		},
+		{
+			name:     "policy 超长条款按句子拆分并带上编号",
+			strategy: StrategyPolicy,
+			opts:     Options{ChunkSize: 30},
+			text:     "第一条 出差住宿费按城市分档。\n第二条 一类城市每天不超过五百元。二类城市每天不超过四百元。三类城市每天不超过三百元。",
+			want: []string{
+				"第一条 出差住宿费按城市分档。",
+				"第二条 一类城市每天不超过五百元。",
+				"第二条\n二类城市每天不超过四百元。三类城市每天不超过三百元。",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			splitter, ok := New(tt.strategy, tt.opts)
+			if !ok {
+				t.Fatalf("strategy %s not registered", tt.strategy)
+			}
+			got, err := splitter.SplitText(tt.text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("SplitText() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	if got := strings.Join(Names(), ","); got != "chinese,markdown,policy,recursive,token" {
+		t.Fatalf("Names() = %s", got)
+	}
+	if _, ok := New("unknown", Options{}); ok {
+		t.Fatal("unknown strategy should not be found")
+	}
+}
@@ -0,0 +1,66 @@
+package chunker
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/tmc/langchaingo/textsplitter"
+)
+
+var _ textsplitter.TextSplitter = (*PolicySplitter)(nil)
+
+// clauseHeading 匹配行首的条款编号：第X章/节/条、一、、（二）、(2)、1、、1．
+var clauseHeading = regexp.MustCompile(`^(第[一二三四五六七八九十百千零〇两\d]+[编章节条款]|[一二三四五六七八九十百]+、|[（(][一二三四五六七八九十百\d]+[）)]|\d+[、．]|\d+\.(\D|$))`)
+
+// PolicySplitter 适用于政策、法规类公文，以编号条款为最小单元合并分块，单个条款不会被拆到两个分块中。
+// 条款本身超过 ChunkSize 时按句子拆分，拆出的每一段都带上条款编号
+type PolicySplitter struct {
+	Options
+}
+
+func NewPolicySplitter(opts Options) *PolicySplitter {
+	return &PolicySplitter{
+		Options: opts,
+	}
+}
+
+func (receiver *PolicySplitter) SplitText(text string) ([]string, error) {
+	var units []string
+	for _, clause := range splitClauses(text) {
+		if receiver.ChunkSize <= 0 || utf8.RuneCountInString(clause) <= receiver.ChunkSize {
+			units = append(units, clause)
+			continue
+		}
+		heading := clauseHeading.FindString(clause)
+		pieces := mergeUnits(splitSentences(clause), "", receiver.ChunkSize-utf8.RuneCountInString(heading)-1, 0, heading)
+		for i, piece := range pieces {
+			if i > 0 && heading != "" && !strings.HasPrefix(piece, heading) {
+				piece = heading + "\n" + piece
+			}
+			units = append(units, piece)
+		}
+	}
+	return mergeUnits(units, "\n", receiver.ChunkSize, receiver.ChunkOverlap, ""), nil
+}
+
+// splitClauses 按行首的条款编号把文本切成条款，第一个编号之前的内容单独作为一个条款
+func splitClauses(text string) []string {
+	var clauses []string
+	var current []string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if clauseHeading.MatchString(line) && len(current) > 0 {
+			clauses = append(clauses, strings.Join(current, "\n"))
+			current = nil
+		}
+		current = append(current, line)
+	}
+	if len(current) > 0 {
+		clauses = append(clauses, strings.Join(current, "\n"))
+	}
+	return clauses
+}
@@ -16,7 +16,43 @@ type Config struct {
 	Biz struct {
 		FileSavePath string
 		VectorStore  struct {
+			// 向量库后端：chromem, sqlite。sqlite 把向量保存在 Db.Dsn 指向的知识库数据库中，
+			// 切换后端不会迁移已有的向量，需要重新上传文件
+			Backend string `default:"chromem"`
+			// chromem 后端的快照文件，写操作先追加到同目录下的 <ExportToFile>.wal
 			ExportToFile string
+			// chromem 后端快照和预写日志的加密密钥，为空时不加密，否则必须为 32 字节。已有的快照加上或者去掉密钥后无法导入
+			EncryptionKey string
+			// 预写日志超过该大小（MB）时合并成新的快照
+			CompactSizeMb int `default:"64"`
+		}
+		Embedding struct {
+			// 向量化提供方：openai, ollama, hash。hash 在本地按词做特征哈希，不请求任何服务，只用于离线开发和测试。
+			// 切换提供方后已有的知识库需要重新向量化
+			Provider string `default:"openai"`
+			// 为空时 openai 使用 Openai.BaseUrl，ollama 使用 http://localhost:11434/api
+			BaseUrl string
+			// hash 提供方的向量维度
+			Dimension int `default:"256"`
+		}
+		Ingest struct {
+			// 并发执行入库任务的 worker 数量
+			Workers   int `default:"2"`
+			QueueSize int `default:"100"`
+		}
+		Chunking struct {
+			// 默认分割策略：recursive, token, chinese, markdown, policy，上传时可以单独指定
+			Strategy     string `default:"recursive"`
+			ChunkSize    int    `default:"500"`
+			ChunkOverlap int    `default:"100"`
+		}
+		Retrieval struct {
+			// 默认检索模式：vector, keyword, hybrid，查询时可以单独指定
+			Mode string `default:"vector"`
+			// 倒数排名融合（RRF）的平滑常数
+			RrfK int `default:"60"`
+			// hybrid 模式下关键词检索的权重，向量检索的权重为 1 - KeywordWeight
+			KeywordWeight float32 `default:"0.5"`
 		}
 	}
 	Openai struct {
@@ -24,6 +60,8 @@ type Config struct {
 		Token          string
 		EmbeddingModel string
 		Model          string
+		// cross_encoder 重排使用的模型，通过 BaseUrl + /rerank 调用
+		RerankModel string
 	}
 	Db struct {
 		Dsn string
@@ -65,34 +65,196 @@ func (receiver Parameter) IParameterInstance() {
 }
 
 type FileDTO struct {
-	Id      uint   `json:"id" form:"id"`
-	Path    string `json:"path" form:"path"`
-	Content string `json:"content" form:"content"`
+	Id   uint   `json:"id" form:"id"`
+	KbId uint   `json:"kb_id" form:"kb_id"`
+	Name string `json:"name" form:"name"`
+	Path string `json:"path" form:"path"`
+	// 文件内容的 sha256
+	Hash    string `json:"hash" form:"hash"`
+	Version int    `json:"version" form:"version"`
+	// 是否为当前参与检索的版本
+	Current bool `json:"current" form:"current"`
+	// 为空时使用配置中的默认分割策略
+	ChunkStrategy string   `json:"chunk_strategy" form:"chunk_strategy"`
+	Tags          []string `json:"tags" form:"tags"`
+	CreatedAt     string   `json:"created_at" form:"created_at"`
+	Content       string   `json:"content" form:"content"`
+	// 同名文件的全部版本，按版本号倒序
+	Versions []FileVersionDTO `json:"versions" form:"versions"`
+}
+
+type FileVersionDTO struct {
+	Id        uint   `json:"id" form:"id"`
+	Hash      string `json:"hash" form:"hash"`
+	Version   int    `json:"version" form:"version"`
+	Current   bool   `json:"current" form:"current"`
+	CreatedAt string `json:"created_at" form:"created_at"`
 }
 
 type UploadResult struct {
+	Id   uint `json:"id" form:"id"`
+	KbId uint `json:"kb_id" form:"kb_id"`
+	// 入库任务ID，通过 /jobs/{id} 查询进度
+	JobId   uint `json:"job_id" form:"job_id"`
+	Version int  `json:"version" form:"version"`
+	// 内容与已上传的文件完全相同，直接返回已有的记录
+	Duplicate bool `json:"duplicate" form:"duplicate"`
+}
+
+// EmbeddingCacheStats 向量缓存统计，命中和未命中次数从服务启动时开始累计
+type EmbeddingCacheStats struct {
+	Model string `json:"model" form:"model"`
+	// 缓存的向量条数
+	Entries int64   `json:"entries" form:"entries"`
+	Hits    int64   `json:"hits" form:"hits"`
+	Misses  int64   `json:"misses" form:"misses"`
+	HitRate float64 `json:"hit_rate" form:"hit_rate"`
+}
+
+type JobDTO struct {
 	Id uint `json:"id" form:"id"`
+	// ingest 或 reembed
+	Kind string `json:"kind" form:"kind"`
+	// 仅 ingest 任务有值
+	FileId uint `json:"file_id" form:"file_id"`
+	// 仅 reembed 任务有值
+	KbId uint `json:"kb_id" form:"kb_id"`
+	// queued, running, succeeded, failed
+	Status string `json:"status" form:"status"`
+	// extracting, splitting, embedding, persisting, done
+	Stage          string `json:"stage" form:"stage"`
+	PagesTotal     int    `json:"pages_total" form:"pages_total"`
+	PagesExtracted int    `json:"pages_extracted" form:"pages_extracted"`
+	ImagesTotal    int    `json:"images_total" form:"images_total"`
+	ImagesAnalysed int    `json:"images_analysed" form:"images_analysed"`
+	ChunksTotal    int    `json:"chunks_total" form:"chunks_total"`
+	ChunksEmbedded int    `json:"chunks_embedded" form:"chunks_embedded"`
+	Error          string `json:"error" form:"error"`
+	CreatedAt      string `json:"created_at" form:"created_at"`
+	StartedAt      string `json:"started_at" form:"started_at"`
+	FinishedAt     string `json:"finished_at" form:"finished_at"`
+}
+
+type GetJobsReq struct {
+	// ingest 或 reembed，为空时不限
+	Kind   string `json:"kind" form:"kind"`
+	KbId   uint   `json:"kb_id" form:"kb_id"`
+	FileId uint   `json:"file_id" form:"file_id"`
+	// 多个值用英文逗号拼接
+	Status string `json:"status" form:"status"`
+	Limit  int    `json:"limit" form:"limit"`
 }
 
 type Rerank struct {
-	Strategy string  `json:"strategy" form:"strategy"`
-	Lambda   float32 `json:"lambda" form:"lambda"`
+	// mmr 或 cross_encoder
+	Strategy string `json:"strategy" form:"strategy"`
+	// mmr 中相关性的权重，取值 0 到 1，越小结果越多样，为 0 时取 0.5
+	Lambda float32 `json:"lambda" form:"lambda"`
+	// 重排后保留的结果数量，为 0 时保留全部
+	TopN int `json:"top_n" form:"top_n"`
 }
 
 type QueryReq struct {
-	Text                string  `json:"text" form:"text"`
-	RetrieveLimit       int     `json:"retrieve_limit" form:"retrieve_limit"`
+	// 在多个知识库中检索时合并各知识库的结果，为空时检索 Filter.FileIds 所在的知识库，都为空时检索默认知识库
+	KbIds         []uint `json:"kb_ids" form:"kb_ids"`
+	Text          string `json:"text" form:"text"`
+	RetrieveLimit int    `json:"retrieve_limit" form:"retrieve_limit"`
+	// 只作用于向量检索的结果
 	SimilarityThreshold float32 `json:"similarity_threshold" form:"similarity_threshold"`
+	// vector, keyword, hybrid，为空时使用配置中的默认模式
+	Mode string `json:"mode" form:"mode"`
+	// hybrid 模式下关键词检索在倒数排名融合中的权重，取值 0 到 1，为 0 时使用配置中的默认值
+	KeywordWeight float32 `json:"keyword_weight" form:"keyword_weight"`
+	// 为空时不重排
+	Rerank *Rerank `json:"rerank" form:"rerank"`
+	// 为空时检索全部文件
+	Filter *QueryFilter `json:"filter" form:"filter"`
+}
+
+// QueryFilter 检索范围，各条件之间是且的关系
+type QueryFilter struct {
+	// 文件ID，传入历史版本的ID时检索该文件的当前版本
+	FileIds []uint `json:"file_ids" form:"file_ids"`
+	// text 或 image
+	Type string `json:"type" form:"type"`
+	// 文件需要带有全部标签
+	Tags []string `json:"tags" form:"tags"`
+	// 上传时间范围，格式为 2006-01-02 或者 2006-01-02 15:04:05，包含两端
+	UploadedFrom string `json:"uploaded_from" form:"uploaded_from"`
+	UploadedTo   string `json:"uploaded_to" form:"uploaded_to"`
+	// 页码范围，从 0 开始，包含两端
+	PageFrom *int `json:"page_from,omitempty" form:"page_from"`
+	PageTo   *int `json:"page_to,omitempty" form:"page_to"`
+	// 分块元数据等值过滤，例如 chunk_strategy
+	Metadata map[string]string `json:"metadata" form:"metadata"`
+	// 分块元数据的值需要包含的文本，例如 file_name 包含“差旅”
+	MetadataContains map[string]string `json:"metadata_contains" form:"metadata_contains"`
+	// 分块内容需要包含的文本
+	Contains string `json:"contains" form:"contains"`
+	// 分块内容不能包含的文本
+	NotContains string `json:"not_contains" form:"not_contains"`
 }
 
 type QueryResult struct {
-	ID         string  `json:"id" form:"id"`
+	ID   string `json:"id" form:"id"`
+	KbId uint   `json:"kb_id" form:"kb_id"`
+	// 向量相似度，只由关键词检索命中时为 0
 	Similarity float32 `json:"similarity" form:"similarity"`
-	Content    string  `json:"content" form:"content"`
+	// 检索得分：vector 模式为向量相似度，keyword 模式为 BM25 得分，hybrid 模式为融合得分
+	Score float32 `json:"score" form:"score"`
+	// 重排得分，重排后结果按该得分排序，未重排时为 0
+	RerankScore float32 `json:"rerank_score" form:"rerank_score"`
+	Content     string  `json:"content" form:"content"`
+	FileId      uint    `json:"file_id" form:"file_id"`
+	FileName    string  `json:"file_name" form:"file_name"`
+	// 从 0 开始
+	Page       int `json:"page" form:"page"`
+	TotalPages int `json:"total_pages" form:"total_pages"`
+	// text 或 image
+	Type string `json:"type" form:"type"`
+	// 抽取出的图片路径，仅 type 为 image 时有值
+	Image string `json:"image" form:"image"`
+	// 分块在文件中的序号，从 0 开始，相邻的分块序号连续。记录序号之前入库的分块为 -1
+	ChunkIndex int `json:"chunk_index" form:"chunk_index"`
 }
 
 type GetListReq struct {
-	// 多个值用英文逗号拼接
+	// 为 0 时使用默认知识库，指定了 FileId 时忽略
+	KbId uint `json:"kb_id" form:"kb_id"`
+	// 多个值用英文逗号拼接，为空时返回每个文件的当前版本
 	FileId      string `json:"file_id" form:"file_id"`
 	WithContent bool   `json:"with_content" form:"with_content"`
 }
+
+type KbDTO struct {
+	Id          uint   `json:"id" form:"id"`
+	Name        string `json:"name" form:"name"`
+	Description string `json:"description" form:"description"`
+	IsDefault   bool   `json:"is_default" form:"is_default"`
+	// 以下配置为空时使用 moduleknowledge 配置中的默认值
+	EmbeddingModel string `json:"embedding_model" form:"embedding_model"`
+	ChunkStrategy  string `json:"chunk_strategy" form:"chunk_strategy"`
+	ChunkSize      int    `json:"chunk_size" form:"chunk_size"`
+	ChunkOverlap   int    `json:"chunk_overlap" form:"chunk_overlap"`
+	// 回答和解析图片使用的提示词模板名称，为空时使用 default 模板
+	PromptTemplate string `json:"prompt_template" form:"prompt_template"`
+	// 集合中已有向量实际使用的向量化模型和维度，还没有向量时为空
+	IndexedModel string `json:"indexed_model" form:"indexed_model"`
+	Dimension    int    `json:"dimension" form:"dimension"`
+	// 已有向量的模型与配置的模型不一致，需要通过 /kb/{id}/reembed 重新向量化，完成之前检索仍使用原来的模型
+	Stale     bool   `json:"stale" form:"stale"`
+	CreatedAt string `json:"created_at" form:"created_at"`
+}
+
+type SaveKbReq struct {
+	Name        string `json:"name" form:"name"`
+	Description string `json:"description" form:"description"`
+	// 知识库中已有文件时修改后需要重新向量化
+	EmbeddingModel string `json:"embedding_model" form:"embedding_model"`
+	// 修改分割配置只影响之后入库的文件
+	ChunkStrategy string `json:"chunk_strategy" form:"chunk_strategy"`
+	ChunkSize     int    `json:"chunk_size" form:"chunk_size"`
+	ChunkOverlap  int    `json:"chunk_overlap" form:"chunk_overlap"`
+	// 提示词模板名称，模板在 modulechat 的 /prompt 接口中维护，保存时模板必须已经存在，为空时使用 default 模板
+	PromptTemplate string `json:"prompt_template" form:"prompt_template"`
+}
@@ -0,0 +1,104 @@
+package embedding
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/philippgille/chromem-go"
+)
+
+const (
+	// ProviderOpenAI OpenAI 兼容的 /embeddings 接口，默认提供方
+	ProviderOpenAI = "openai"
+	// ProviderOllama Ollama 的 /api/embeddings 接口，BaseUrl 为空时使用 http://localhost:11434/api
+	ProviderOllama = "ollama"
+	// ProviderHash 本地确定性的哈希向量，不请求任何服务，用于离线开发和测试
+	ProviderHash = "hash"
+)
+
+// Options 各提供方自行决定使用哪些参数
+type Options struct {
+	BaseUrl string
+	Token   string
+	Model   string
+	// 只对 hash 提供方有效
+	Dimension int
+}
+
+// Factory 根据参数创建向量化函数
+type Factory func(opts Options) chromem.EmbeddingFunc
+
+var (
+	mu       sync.RWMutex
+	registry = make(map[string]Factory)
+)
+
+func init() {
+	Register(ProviderOpenAI, func(opts Options) chromem.EmbeddingFunc {
+		return chromem.NewEmbeddingFuncOpenAICompat(opts.BaseUrl, opts.Token, opts.Model, nil)
+	})
+	Register(ProviderOllama, func(opts Options) chromem.EmbeddingFunc {
+		return chromem.NewEmbeddingFuncOllama(opts.Model, opts.BaseUrl)
+	})
+	Register(ProviderHash, func(opts Options) chromem.EmbeddingFunc {
+		return NewHash(opts.Dimension)
+	})
+}
+
+// Register 注册一个向量化提供方，同名提供方后注册的覆盖先注册的
+func Register(name string, factory Factory) {
+	mu.Lock()
+	defer mu.Unlock()
+	registry[normalize(name)] = factory
+}
+
+// New 按提供方名称创建向量化函数
+func New(name string, opts Options) (chromem.EmbeddingFunc, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	factory, ok := registry[normalize(name)]
+	if !ok {
+		return nil, false
+	}
+	return factory(opts), true
+}
+
+// Names 返回已注册的全部提供方名称
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Qualify 返回带提供方前缀的模型名称，用于区分不同提供方的同名模型。
+// openai 不加前缀，与引入提供方之前记录的模型名称保持一致
+func Qualify(provider, model string) string {
+	provider = normalize(provider)
+	if provider == "" || provider == ProviderOpenAI {
+		return model
+	}
+	return provider + ":" + model
+}
+
+// Parse 是 Qualify 的逆操作，没有已注册提供方前缀的名称都属于 openai
+func Parse(qualified string) (provider, model string) {
+	if prefix, rest, ok := strings.Cut(qualified, ":"); ok {
+		mu.RLock()
+		_, registered := registry[normalize(prefix)]
+		mu.RUnlock()
+		if registered {
+			return normalize(prefix), rest
+		}
+	}
+	return ProviderOpenAI, qualified
+}
+
+func normalize(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
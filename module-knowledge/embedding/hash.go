@@ -0,0 +1,51 @@
+package embedding
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+
+	"github.com/philippgille/chromem-go"
+
+	"go-doudou-rag/module-knowledge/internal/keyword"
+)
+
+// DefaultDimension hash 提供方未配置维度时使用的维度
+const DefaultDimension = 256
+
+// NewHash 返回本地确定性的向量化函数：按关键词检索的分词结果做特征哈希，每个词哈希到一个维度，
+// 再由另一位哈希决定正负，最后归一化。相同的文本总是得到相同的向量，共有的词越多相似度越高，
+// 足以让检索测试稳定地命中，但不具备语义理解能力，不要用于生产环境
+func NewHash(dimension int) chromem.EmbeddingFunc {
+	if dimension <= 0 {
+		dimension = DefaultDimension
+	}
+	return func(ctx context.Context, text string) ([]float32, error) {
+		embedding := make([]float32, dimension)
+		for _, token := range keyword.Tokenize(text) {
+			h := fnv.New64a()
+			_, _ = h.Write([]byte(token))
+			sum := h.Sum64()
+			sign := float32(1)
+			if sum>>63 == 1 {
+				sign = -1
+			}
+			embedding[sum%uint64(dimension)] += sign
+		}
+
+		var norm float64
+		for _, item := range embedding {
+			norm += float64(item * item)
+		}
+		if norm == 0 {
+			// 没有任何词的文本给一个固定的单位向量，chromem 要求向量已经归一化
+			embedding[0] = 1
+			return embedding, nil
+		}
+		norm = math.Sqrt(norm)
+		for i := range embedding {
+			embedding[i] = float32(float64(embedding[i]) / norm)
+		}
+		return embedding, nil
+	}
+}
@@ -0,0 +1,89 @@
+package embedding
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+func cosine(a, b []float32) float64 {
+	var sum float64
+	for i := range a {
+		sum += float64(a[i] * b[i])
+	}
+	return sum
+}
+
+func TestNewHash(t *testing.T) {
+	ctx := context.Background()
+	embed := NewHash(128)
+
+	a, err := embed(ctx, "职工差旅费报销标准")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := embed(ctx, "职工差旅费报销标准")
+	similar, _ := embed(ctx, "差旅费怎么报销")
+	unrelated, _ := embed(ctx, "机房空调巡检记录")
+	empty, _ := embed(ctx, "，。")
+
+	if len(a) != 128 {
+		t.Fatalf("dimension = %d, want 128", len(a))
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("embedding is not deterministic at %d: %v != %v", i, a[i], b[i])
+		}
+	}
+	for _, item := range [][]float32{a, similar, unrelated, empty} {
+		if norm := math.Sqrt(cosine(item, item)); math.Abs(norm-1) > 1e-5 {
+			t.Fatalf("embedding is not normalized: %v", norm)
+		}
+	}
+	if cosine(a, similar) <= cosine(a, unrelated) {
+		t.Fatalf("similar text scores %v, unrelated text scores %v", cosine(a, similar), cosine(a, unrelated))
+	}
+}
+
+func TestQualify(t *testing.T) {
+	tests := []struct {
+		provider  string
+		model     string
+		qualified string
+	}{
+		{
+			provider:  ProviderOpenAI,
+			model:     "BAAI/bge-large-zh-v1.5",
+			qualified: "BAAI/bge-large-zh-v1.5",
+		},
+		{
+			provider:  "",
+			model:     "text-embedding-3-small",
+			qualified: "text-embedding-3-small",
+		},
+		{
+			provider:  ProviderOllama,
+			model:     "nomic-embed-text:latest",
+			qualified: "ollama:nomic-embed-text:latest",
+		},
+		{
+			provider:  ProviderHash,
+			model:     "test",
+			qualified: "hash:test",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.qualified, func(t *testing.T) {
+			if got := Qualify(tt.provider, tt.model); got != tt.qualified {
+				t.Fatalf("Qualify() = %v, want %v", got, tt.qualified)
+			}
+			want := tt.provider
+			if want == "" {
+				want = ProviderOpenAI
+			}
+			if provider, model := Parse(tt.qualified); provider != want || model != tt.model {
+				t.Fatalf("Parse() = %v, %v, want %v, %v", provider, model, want, tt.model)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"sync"
+
+	"github.com/philippgille/chromem-go"
+	"github.com/samber/lo"
+
+	"go-doudou-rag/module-knowledge/dto"
+	"go-doudou-rag/module-knowledge/internal/dao"
+)
+
+// cacheCounter 服务启动以来各向量化模型的缓存命中次数
+type cacheCounter struct {
+	mu     sync.Mutex
+	hits   map[string]int64
+	misses map[string]int64
+}
+
+func (receiver *cacheCounter) add(embeddingModel string, hit bool) {
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+
+	if receiver.hits == nil {
+		receiver.hits = make(map[string]int64)
+		receiver.misses = make(map[string]int64)
+	}
+	if hit {
+		receiver.hits[embeddingModel]++
+	} else {
+		receiver.misses[embeddingModel]++
+	}
+}
+
+func (receiver *cacheCounter) get(embeddingModel string) (hits, misses int64) {
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+
+	return receiver.hits[embeddingModel], receiver.misses[embeddingModel]
+}
+
+func (receiver *cacheCounter) models() []string {
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+
+	return lo.Uniq(append(lo.Keys(receiver.hits), lo.Keys(receiver.misses)...))
+}
+
+// cached 包装分块的向量化函数：先按 (向量化模型, 内容哈希) 查缓存，未命中时才请求模型并写入缓存。
+// 重新入库时只有内容变化了的分块需要向量化。检索的问题各不相同、缓存没有淘汰，不经过缓存
+func (receiver *ModuleKnowledgeImpl) cached(embeddingModel string, embeddingFunc chromem.EmbeddingFunc) chromem.EmbeddingFunc {
+	return func(ctx context.Context, text string) ([]float32, error) {
+		cacheRepo := dao.GetEmbeddingCacheRepo()
+		sum := sha256.Sum256([]byte(text))
+		hash := hex.EncodeToString(sum[:])
+
+		if embedding := cacheRepo.Get(ctx, embeddingModel, hash); embedding != nil {
+			receiver.cacheCounter.add(embeddingModel, true)
+			return embedding, nil
+		}
+		receiver.cacheCounter.add(embeddingModel, false)
+
+		embedding, err := embeddingFunc(ctx, text)
+		if err != nil {
+			return nil, err
+		}
+		cacheRepo.Save(ctx, embeddingModel, hash, embedding)
+		return embedding, nil
+	}
+}
+
+func (receiver *ModuleKnowledgeImpl) GetEmbeddingCache(ctx context.Context) (data []dto.EmbeddingCacheStats, err error) {
+	entries := make(map[string]int64)
+	for _, item := range dao.GetEmbeddingCacheRepo().CountByModel(ctx) {
+		entries[item.Model] = item.Count
+	}
+
+	embeddingModels := lo.Uniq(append(lo.Keys(entries), receiver.cacheCounter.models()...))
+	sort.Strings(embeddingModels)
+	for _, item := range embeddingModels {
+		hits, misses := receiver.cacheCounter.get(item)
+		stats := dto.EmbeddingCacheStats{
+			Model:   item,
+			Entries: entries[item],
+			Hits:    hits,
+			Misses:  misses,
+		}
+		if hits+misses > 0 {
+			stats.HitRate = float64(hits) / float64(hits+misses)
+		}
+		data = append(data, stats)
+	}
+
+	return data, nil
+}
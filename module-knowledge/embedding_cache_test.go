@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"go-doudou-rag/module-knowledge/dto"
+	"go-doudou-rag/toolkit/llm"
+)
+
+func cacheStats(t *testing.T, svc *ModuleKnowledgeImpl) dto.EmbeddingCacheStats {
+	data, err := svc.GetEmbeddingCache(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 1 || data[0].Model != "hash:test" {
+		t.Fatalf("stats = %+v", data)
+	}
+	return data[0]
+}
+
+func TestEmbeddingCache(t *testing.T) {
+	svc := newTestService(t, llm.NewFake())
+	ctx := context.Background()
+
+	// 每句话超过分块大小的一半，各自成为一个分块
+	first := "第一条 职工因公出差的住宿费按照城市类别分档报销，一类城市每人每天不超过五百元。"
+	second := "第二条 机房空调每周巡检一次，巡检记录需要由值班人员签字确认并保存三年以上。"
+	upload(t, svc, "制度.txt", first, "")
+	stats := cacheStats(t, svc)
+	if stats.Entries != 1 || stats.Hits != 0 || stats.Misses != 1 {
+		t.Fatalf("after first upload: %+v", stats)
+	}
+
+	// 新版本中没有变化的分块直接使用缓存
+	upload(t, svc, "制度.txt", first+second, "")
+	stats = cacheStats(t, svc)
+	if stats.Entries != 2 || stats.Hits != 1 || stats.Misses != 2 {
+		t.Fatalf("after second upload: %+v", stats)
+	}
+
+	// 检索的问题不写入缓存，也不计入命中统计
+	for _, mode := range []string{retrievalModeVector, retrievalModeHybrid} {
+		if _, err := svc.GetQuery(ctx, dto.QueryReq{
+			Text:          "出差住宿费怎么报销",
+			RetrieveLimit: 3,
+			Mode:          mode,
+			Rerank:        &dto.Rerank{Strategy: rerankStrategyMMR},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := cacheStats(t, svc); got != stats {
+		t.Fatalf("after query: %+v, want %+v", got, stats)
+	}
+}
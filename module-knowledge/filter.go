@@ -0,0 +1,149 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/unionj-cloud/toolkit/stringutils"
+
+	"go-doudou-rag/module-knowledge/dto"
+	"go-doudou-rag/module-knowledge/internal/dao"
+	"go-doudou-rag/module-knowledge/internal/model"
+	"go-doudou-rag/module-knowledge/vectorstore"
+)
+
+// scope 由 dto.QueryFilter 转换而来的检索范围。文件级条件（文件ID、标签、上传时间）先在数据库中解析成文件路径，
+// 分块级条件（元数据等值、元数据包含、内容包含、不包含、页码范围）下推到向量库，在取前 N 个之前过滤
+type scope struct {
+	// 为 nil 时不限制文件
+	files            []string
+	where            map[string]string
+	metadataContains map[string]string
+	contains         string
+	notContains      string
+	pageFrom         *int
+	pageTo           *int
+}
+
+// newScope 解析知识库中的检索范围，文件级条件没有匹配到任何文件时返回 nil
+func newScope(ctx context.Context, kbId uint, filter *dto.QueryFilter) *scope {
+	s := &scope{}
+	if filter == nil {
+		return s
+	}
+
+	if len(filter.FileIds) > 0 || len(filter.Tags) > 0 || stringutils.IsNotEmpty(filter.UploadedFrom) || stringutils.IsNotEmpty(filter.UploadedTo) {
+		files := findFiles(ctx, kbId, filter)
+		if len(files) == 0 {
+			return nil
+		}
+		s.files = lo.Map(files, func(item *model.File, index int) string {
+			return item.Path
+		})
+	}
+
+	if len(filter.Metadata) > 0 || stringutils.IsNotEmpty(filter.Type) {
+		s.where = make(map[string]string)
+		for key, value := range filter.Metadata {
+			s.where[key] = value
+		}
+		if stringutils.IsNotEmpty(filter.Type) {
+			s.where["type"] = filter.Type
+		}
+	}
+
+	if len(filter.MetadataContains) > 0 {
+		s.metadataContains = filter.MetadataContains
+	}
+	s.contains = filter.Contains
+	s.notContains = filter.NotContains
+	s.pageFrom = filter.PageFrom
+	s.pageTo = filter.PageTo
+
+	return s
+}
+
+// findFiles 查找知识库中满足文件级条件的当前版本。传入历史版本的ID时使用同名文件的当前版本，其他知识库的文件ID忽略
+func findFiles(ctx context.Context, kbId uint, filter *dto.QueryFilter) []*model.File {
+	fileRepo := dao.GetFileRepo()
+
+	req := dao.FindCurrentReq{
+		KbId:        kbId,
+		CreatedFrom: parseTime(filter.UploadedFrom, false),
+		CreatedTo:   parseTime(filter.UploadedTo, true),
+	}
+	if len(filter.FileIds) > 0 {
+		for _, id := range lo.Uniq(filter.FileIds) {
+			if file := fileRepo.Get(ctx, id); file != nil && file.KbID == kbId {
+				req.Names = append(req.Names, file.Name)
+			}
+		}
+		if len(req.Names) == 0 {
+			return nil
+		}
+	}
+
+	return lo.Filter(fileRepo.FindCurrent(ctx, req), func(item *model.File, index int) bool {
+		return lo.Every(item.Tags, filter.Tags)
+	})
+}
+
+// parseTime 解析日期或者日期时间，只有日期时 end 为 true 表示当天结束
+func parseTime(value string, end bool) *time.Time {
+	if stringutils.IsEmpty(value) {
+		return nil
+	}
+	if t, err := time.ParseInLocation(time.DateTime, value, time.Local); err == nil {
+		return &t
+	}
+	t, err := time.ParseInLocation(time.DateOnly, value, time.Local)
+	if err != nil {
+		panic("invalid date: " + value)
+	}
+	if end {
+		t = t.Add(24*time.Hour - time.Nanosecond)
+	}
+	return &t
+}
+
+// filters 返回下推给向量库的条件，向量库的等值条件只支持且，多个文件时每个文件一个条件
+func (receiver *scope) filters() []vectorstore.Filter {
+	filter := receiver.filter(receiver.where)
+	if receiver.files == nil {
+		return []vectorstore.Filter{filter}
+	}
+	return lo.Map(receiver.files, func(file string, index int) vectorstore.Filter {
+		where := map[string]string{
+			"file": file,
+		}
+		for key, value := range receiver.where {
+			where[key] = value
+		}
+		filter.Where = where
+		return filter
+	})
+}
+
+func (receiver *scope) filter(where map[string]string) vectorstore.Filter {
+	filter := vectorstore.Filter{
+		Where:            where,
+		Contains:         receiver.contains,
+		NotContains:      receiver.notContains,
+		MetadataContains: receiver.metadataContains,
+	}
+	if receiver.pageFrom != nil || receiver.pageTo != nil {
+		filter.Ranges = map[string]vectorstore.Range{
+			"page": {From: receiver.pageFrom, To: receiver.pageTo},
+		}
+	}
+	return filter
+}
+
+// match 判断分块是否在检索范围内，用于关键词检索
+func (receiver *scope) match(metadata map[string]string, content string) bool {
+	if receiver.files != nil && !lo.Contains(receiver.files, metadata["file"]) {
+		return false
+	}
+	return receiver.filter(receiver.where).Match(metadata, content)
+}
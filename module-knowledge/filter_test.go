@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	v3 "github.com/unionj-cloud/toolkit/openapi/v3"
+
+	"go-doudou-rag/module-knowledge/dto"
+	"go-doudou-rag/toolkit/llm"
+)
+
+func upload(t *testing.T, svc *ModuleKnowledgeImpl, name, content string, tags string) dto.UploadResult {
+	uploaded, err := svc.Upload(context.Background(), v3.FileModel{
+		Filename: name,
+		Reader:   io.NopCloser(strings.NewReader(content)),
+	}, nil, nil, &tags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitJob(t, svc, uploaded.JobId)
+	return uploaded
+}
+
+func TestQueryFilter(t *testing.T) {
+	svc := newTestService(t, llm.NewFake())
+	ctx := context.Background()
+
+	travel := upload(t, svc, "差旅制度.txt", "出差住宿费一类城市每天不超过五百元。", "finance")
+	upload(t, svc, "机房管理.txt", "机房每周巡检一次，出差期间由值班人员代为巡检。", "it")
+	// 新版本替换旧版本，按旧版本ID过滤时检索当前版本
+	current := upload(t, svc, "差旅制度.txt", "出差住宿费一类城市每天不超过六百元。", "finance,2024")
+
+	pageFrom := 1
+	tests := []struct {
+		name   string
+		filter *dto.QueryFilter
+		want   []string
+	}{
+		{
+			name: "不过滤",
+			want: []string{"出差住宿费一类城市每天不超过六百元。", "机房每周巡检一次，出差期间由值班人员代为巡检。"},
+		},
+		{
+			name:   "历史版本的文件ID",
+			filter: &dto.QueryFilter{FileIds: []uint{travel.Id}},
+			want:   []string{"出差住宿费一类城市每天不超过六百元。"},
+		},
+		{
+			name:   "标签",
+			filter: &dto.QueryFilter{Tags: []string{"finance", "2024"}},
+			want:   []string{"出差住宿费一类城市每天不超过六百元。"},
+		},
+		{
+			name:   "元数据包含",
+			filter: &dto.QueryFilter{MetadataContains: map[string]string{"file_name": "机房"}},
+			want:   []string{"机房每周巡检一次，出差期间由值班人员代为巡检。"},
+		},
+		{
+			name:   "元数据等值和内容不包含",
+			filter: &dto.QueryFilter{Metadata: map[string]string{"type": "text"}, NotContains: "住宿"},
+			want:   []string{"机房每周巡检一次，出差期间由值班人员代为巡检。"},
+		},
+		{
+			name:   "页码范围",
+			filter: &dto.QueryFilter{PageFrom: &pageFrom},
+		},
+		{
+			name:   "没有匹配的文件",
+			filter: &dto.QueryFilter{Tags: []string{"hr"}},
+		},
+	}
+	for _, mode := range []string{retrievalModeVector, retrievalModeKeyword} {
+		for _, tt := range tests {
+			t.Run(mode+"/"+tt.name, func(t *testing.T) {
+				// 只取一个结果，过滤必须发生在取前 N 个之前
+				for _, limit := range []int{1, 10} {
+					results, err := svc.GetQuery(ctx, dto.QueryReq{
+						Text:          "出差",
+						RetrieveLimit: limit,
+						Mode:          mode,
+						Filter:        tt.filter,
+					})
+					if err != nil {
+						t.Fatal(err)
+					}
+					var got []string
+					for _, item := range results {
+						got = append(got, item.Content)
+						if strings.Contains(item.Content, "住宿费") && item.FileId != current.Id {
+							t.Fatalf("result from an old version: %+v", item)
+						}
+					}
+					sort.Strings(got)
+					want := tt.want
+					if len(want) > limit {
+						if len(got) != limit || !strings.Contains(strings.Join(want, ","), got[0]) {
+							t.Fatalf("limit %d: results = %v, want one of %v", limit, got, want)
+						}
+						continue
+					}
+					if !reflect.DeepEqual(got, want) {
+						t.Fatalf("limit %d: results = %v, want %v", limit, got, want)
+					}
+				}
+			})
+		}
+	}
+}
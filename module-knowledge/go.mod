@@ -5,6 +5,7 @@ go 1.24.2
 require (
 	github.com/bytedance/sonic v1.13.2
 	github.com/glebarez/sqlite v1.11.0
+	github.com/go-ego/gse v0.80.3
 	github.com/klippa-app/go-pdfium v1.14.1
 	github.com/pdfcpu/pdfcpu v0.10.2
 	github.com/philippgille/chromem-go v0.7.0
@@ -222,6 +223,7 @@ require (
 	github.com/uber/jaeger-lib v2.4.1+incompatible // indirect
 	github.com/ucarion/urlpath v0.0.0-20200424170820-7ccc79b76bbb // indirect
 	github.com/ulikunitz/xz v0.5.12 // indirect
+	github.com/vcaesar/cedar v0.20.2 // indirect
 	github.com/vmihailenco/go-tinylfu v0.2.2 // indirect
 	github.com/vmihailenco/msgpack/v5 v5.3.5 // indirect
 	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
@@ -0,0 +1,100 @@
+package dao
+
+import (
+	"context"
+	"go-doudou-rag/module-knowledge/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var chunkRepo *ChunkRepo
+
+func init() {
+	chunkRepo = &ChunkRepo{}
+}
+
+type ChunkRepo struct {
+	db *gorm.DB
+}
+
+func (cr *ChunkRepo) Use(db *gorm.DB) {
+	cr.db = db
+}
+
+// WithTx 返回在事务 tx 中读写的仓库
+func (cr *ChunkRepo) WithTx(tx *gorm.DB) *ChunkRepo {
+	return &ChunkRepo{db: tx}
+}
+
+// Replace 在一个事务中删除 files 对应的全部分块并写入新的分块，ID 相同的分块直接覆盖
+func (cr *ChunkRepo) Replace(ctx context.Context, files []string, chunks []*model.Chunk) {
+	if err := cr.db.Transaction(func(tx *gorm.DB) error {
+		if len(files) > 0 {
+			if err := tx.Where("file in (?)", files).Delete(&model.Chunk{}).Error; err != nil {
+				return err
+			}
+		}
+		if len(chunks) == 0 {
+			return nil
+		}
+		return tx.Clauses(clause.OnConflict{UpdateAll: true}).CreateInBatches(chunks, 100).Error
+	}); err != nil {
+		panic(err)
+	}
+}
+
+// DeleteByKb 删除知识库的全部分块
+func (cr *ChunkRepo) DeleteByKb(ctx context.Context, kbId uint) {
+	if err := cr.db.Where("kb_id = ?", kbId).Delete(&model.Chunk{}).Error; err != nil {
+		panic(err)
+	}
+}
+
+// ListByKb 返回知识库的全部分块
+func (cr *ChunkRepo) ListByKb(ctx context.Context, kbId uint) []*model.Chunk {
+	var chunks []*model.Chunk
+	if err := cr.db.Where("kb_id = ?", kbId).Order("file, id").Find(&chunks).Error; err != nil {
+		panic(err)
+	}
+
+	return chunks
+}
+
+// ListByFiles 返回这些文件路径的全部分块
+func (cr *ChunkRepo) ListByFiles(ctx context.Context, files []string) []*model.Chunk {
+	var chunks []*model.Chunk
+	if len(files) == 0 {
+		return chunks
+	}
+	if err := cr.db.Where("file in (?)", files).Order("file, id").Find(&chunks).Error; err != nil {
+		panic(err)
+	}
+
+	return chunks
+}
+
+// FirstByKb 返回知识库的任意一个分块，没有分块时返回 nil
+func (cr *ChunkRepo) FirstByKb(ctx context.Context, kbId uint) *model.Chunk {
+	var chunks []*model.Chunk
+	if err := cr.db.Where("kb_id = ?", kbId).Limit(1).Find(&chunks).Error; err != nil {
+		panic(err)
+	}
+
+	if len(chunks) == 0 {
+		return nil
+	}
+	return chunks[0]
+}
+
+// Each 分批遍历全部分块
+func (cr *ChunkRepo) Each(ctx context.Context, fn func(chunk *model.Chunk)) {
+	var chunks []*model.Chunk
+	if err := cr.db.FindInBatches(&chunks, 500, func(tx *gorm.DB, batch int) error {
+		for _, item := range chunks {
+			fn(item)
+		}
+		return nil
+	}).Error; err != nil {
+		panic(err)
+	}
+}
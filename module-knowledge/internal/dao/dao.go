@@ -1,13 +1,50 @@
 package dao
 
 import (
+	"context"
+
 	"gorm.io/gorm"
 )
 
 func Use(db *gorm.DB) {
 	fileRepo.Use(db)
+	jobRepo.Use(db)
+	chunkRepo.Use(db)
+	knowledgeBaseRepo.Use(db)
+	embeddingCacheRepo.Use(db)
+}
+
+// DB 返回当前使用的数据库，还没有调用 Use 时返回 nil
+func DB() *gorm.DB {
+	return fileRepo.db
+}
+
+// Transaction 在一个事务中执行 fn，fn 中通过各仓库的 WithTx 读写同一个事务，fn panic 时回滚
+func Transaction(ctx context.Context, fn func(tx *gorm.DB)) {
+	if err := DB().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		fn(tx)
+		return nil
+	}); err != nil {
+		panic(err)
+	}
 }
 
 func GetFileRepo() *FileRepo {
 	return fileRepo
 }
+
+func GetJobRepo() *JobRepo {
+	return jobRepo
+}
+
+func GetChunkRepo() *ChunkRepo {
+	return chunkRepo
+}
+
+func GetKnowledgeBaseRepo() *KnowledgeBaseRepo {
+	return knowledgeBaseRepo
+}
+
+func GetEmbeddingCacheRepo() *EmbeddingCacheRepo {
+	return embeddingCacheRepo
+}
@@ -0,0 +1,60 @@
+package dao
+
+import (
+	"context"
+	"go-doudou-rag/module-knowledge/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var embeddingCacheRepo *EmbeddingCacheRepo
+
+func init() {
+	embeddingCacheRepo = &EmbeddingCacheRepo{}
+}
+
+type EmbeddingCacheRepo struct {
+	db *gorm.DB
+}
+
+func (er *EmbeddingCacheRepo) Use(db *gorm.DB) {
+	er.db = db
+}
+
+// Get 未命中时返回 nil
+func (er *EmbeddingCacheRepo) Get(ctx context.Context, embeddingModel, hash string) []float32 {
+	var caches []*model.EmbeddingCache
+	if err := er.db.Where("model = ? and hash = ?", embeddingModel, hash).Find(&caches).Error; err != nil {
+		panic(err)
+	}
+
+	if len(caches) == 0 {
+		return nil
+	}
+	return caches[0].Embedding
+}
+
+func (er *EmbeddingCacheRepo) Save(ctx context.Context, embeddingModel, hash string, embedding []float32) {
+	if err := er.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&model.EmbeddingCache{
+		Model:     embeddingModel,
+		Hash:      hash,
+		Embedding: embedding,
+	}).Error; err != nil {
+		panic(err)
+	}
+}
+
+type EmbeddingCacheCount struct {
+	Model string
+	Count int64
+}
+
+// CountByModel 按模型统计缓存条数
+func (er *EmbeddingCacheRepo) CountByModel(ctx context.Context) []EmbeddingCacheCount {
+	var counts []EmbeddingCacheCount
+	if err := er.db.Model(&model.EmbeddingCache{}).Select("model, count(*) as count").Group("model").Order("model").Scan(&counts).Error; err != nil {
+		panic(err)
+	}
+
+	return counts
+}
@@ -7,6 +7,8 @@ import (
 	"go-doudou-rag/module-knowledge/dto"
 	"go-doudou-rag/module-knowledge/internal/model"
 	"gorm.io/gorm"
+	"path/filepath"
+	"time"
 )
 
 var fileRepo *FileRepo
@@ -23,9 +25,20 @@ func (fr *FileRepo) Use(db *gorm.DB) {
 	fr.db = db
 }
 
+// WithTx 返回在事务 tx 中读写的仓库
+func (fr *FileRepo) WithTx(tx *gorm.DB) *FileRepo {
+	return &FileRepo{db: tx}
+}
+
 func (fr *FileRepo) Save(ctx context.Context, file dto.FileDTO) uint {
 	fileModel := model.File{
-		Path: file.Path,
+		KbID:          file.KbId,
+		Name:          file.Name,
+		Hash:          file.Hash,
+		Version:       file.Version,
+		ChunkStrategy: file.ChunkStrategy,
+		Tags:          file.Tags,
+		Path:          file.Path,
 	}
 
 	if err := fr.db.Create(&fileModel).Error; err != nil {
@@ -35,7 +48,182 @@ func (fr *FileRepo) Save(ctx context.Context, file dto.FileDTO) uint {
 	return fileModel.ID
 }
 
+func (fr *FileRepo) Get(ctx context.Context, id uint) *model.File {
+	var files []*model.File
+	if err := fr.db.Where("id = ?", id).Find(&files).Error; err != nil {
+		panic(err)
+	}
+
+	if len(files) == 0 {
+		return nil
+	}
+	return files[0]
+}
+
+// GetByHash 按文件内容的 sha256 查找知识库中已上传的版本
+func (fr *FileRepo) GetByHash(ctx context.Context, kbId uint, hash string) *model.File {
+	var files []*model.File
+	if err := fr.db.Where("kb_id = ? and hash = ?", kbId, hash).Order("id desc").Limit(1).Find(&files).Error; err != nil {
+		panic(err)
+	}
+
+	if len(files) == 0 {
+		return nil
+	}
+	return files[0]
+}
+
+// GetByPath 按保存路径查找文件
+func (fr *FileRepo) GetByPath(ctx context.Context, path string) *model.File {
+	var files []*model.File
+	if err := fr.db.Where("path = ?", path).Order("id desc").Limit(1).Find(&files).Error; err != nil {
+		panic(err)
+	}
+
+	if len(files) == 0 {
+		return nil
+	}
+	return files[0]
+}
+
+// ListVersions 返回知识库中同名文件的全部版本，按版本号倒序
+func (fr *FileRepo) ListVersions(ctx context.Context, kbId uint, name string) []*model.File {
+	var files []*model.File
+	if err := fr.db.Where("kb_id = ? and name = ?", kbId, name).Order("version desc").Find(&files).Error; err != nil {
+		panic(err)
+	}
+
+	return files
+}
+
+// LatestVersion 返回知识库中同名文件当前最大的版本号，没有时返回 0
+func (fr *FileRepo) LatestVersion(ctx context.Context, kbId uint, name string) int {
+	var version int
+	if err := fr.db.Model(&model.File{}).Where("kb_id = ? and name = ?", kbId, name).Select("coalesce(max(version), 0)").Scan(&version).Error; err != nil {
+		panic(err)
+	}
+
+	return version
+}
+
+// Promote 在一个事务中把 id 对应的版本设为当前版本，同一知识库中同名的其他版本全部取消
+func (fr *FileRepo) Promote(ctx context.Context, id uint, kbId uint, name string) {
+	if err := fr.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.File{}).Where("kb_id = ? and name = ? and id <> ?", kbId, name, id).Update("current", false).Error; err != nil {
+			return err
+		}
+		return tx.Model(&model.File{}).Where("id = ?", id).Update("current", true).Error
+	}); err != nil {
+		panic(err)
+	}
+}
+
+// Backfill 为引入版本管理之前上传的文件补齐名称和版本号，同名文件按上传顺序编号，最后一个作为当前版本；
+// 引入多知识库之前上传的文件和分块归入默认知识库
+func (fr *FileRepo) Backfill(ctx context.Context, defaultKbId uint) {
+	if err := fr.db.Unscoped().Model(&model.File{}).Where("kb_id = 0 or kb_id is null").Update("kb_id", defaultKbId).Error; err != nil {
+		panic(err)
+	}
+	if err := fr.db.Model(&model.Chunk{}).Where("kb_id = 0 or kb_id is null").Update("kb_id", defaultKbId).Error; err != nil {
+		panic(err)
+	}
+
+	var files []*model.File
+	if err := fr.db.Where("version = 0 or version is null").Order("id").Find(&files).Error; err != nil {
+		panic(err)
+	}
+
+	if len(files) == 0 {
+		return
+	}
+
+	latest := make(map[string]uint)
+	for _, item := range files {
+		latest[filepath.Base(item.Path)] = item.ID
+	}
+
+	if err := fr.db.Transaction(func(tx *gorm.DB) error {
+		versions := make(map[string]int)
+		for _, item := range files {
+			name := filepath.Base(item.Path)
+			versions[name]++
+			if err := tx.Model(&model.File{}).Where("id = ?", item.ID).Updates(map[string]any{
+				"name":    name,
+				"version": versions[name],
+				"current": latest[name] == item.ID,
+			}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		panic(err)
+	}
+}
+
+// UpdateChunkStrategy 修改分割策略，重新入库后生效
+func (fr *FileRepo) UpdateChunkStrategy(ctx context.Context, id uint, strategy string) {
+	if err := fr.db.Model(&model.File{}).Where("id = ?", id).Update("chunk_strategy", strategy).Error; err != nil {
+		panic(err)
+	}
+}
+
+// UpdateTags 修改标签，标签只用于检索时筛选文件，不需要重新入库
+func (fr *FileRepo) UpdateTags(ctx context.Context, id uint, tags []string) {
+	if err := fr.db.Model(&model.File{ID: id}).Select("tags").Updates(&model.File{Tags: tags}).Error; err != nil {
+		panic(err)
+	}
+}
+
+type FindCurrentReq struct {
+	KbId        uint
+	Names       []string
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+}
+
+// FindCurrent 查找当前版本的文件，Names 为空时不按文件名过滤
+func (fr *FileRepo) FindCurrent(ctx context.Context, req FindCurrentReq) []*model.File {
+	var files []*model.File
+
+	tx := fr.db.Where("kb_id = ? and current = ?", req.KbId, true)
+	if len(req.Names) > 0 {
+		tx = tx.Where("name in (?)", req.Names)
+	}
+	if req.CreatedFrom != nil {
+		tx = tx.Where("created_at >= ?", *req.CreatedFrom)
+	}
+	if req.CreatedTo != nil {
+		tx = tx.Where("created_at <= ?", *req.CreatedTo)
+	}
+
+	if err := tx.Find(&files).Error; err != nil {
+		panic(err)
+	}
+
+	return files
+}
+
+// UpdateImages 记录从文件中抽取出的图片路径
+func (fr *FileRepo) UpdateImages(ctx context.Context, id uint, images []string) {
+	if err := fr.db.Model(&model.File{ID: id}).Select("images").Updates(&model.File{Images: images}).Error; err != nil {
+		panic(err)
+	}
+}
+
+// Delete 软删除，依赖 gorm.DeletedAt
+func (fr *FileRepo) Delete(ctx context.Context, ids ...uint) {
+	if len(ids) == 0 {
+		return
+	}
+	if err := fr.db.Delete(&model.File{}, ids).Error; err != nil {
+		panic(err)
+	}
+}
+
 type ListReq struct {
+	// 为 0 时不限制知识库
+	KbId   uint
 	FileId string
 }
 
@@ -43,6 +231,9 @@ func (fr *FileRepo) List(ctx context.Context, listReq ListReq) []*model.File {
 	var files []*model.File
 
 	tx := fr.db
+	if listReq.KbId > 0 {
+		tx = tx.Where("kb_id = ?", listReq.KbId)
+	}
 	if stringutils.IsNotEmpty(listReq.FileId) {
 		fileIds := stringutils.Split(listReq.FileId, ",")
 		fileIdList := sliceutils.StringSlice2InterfaceSlice(fileIds)
@@ -0,0 +1,83 @@
+package dao
+
+import (
+	"context"
+	"go-doudou-rag/module-knowledge/internal/model"
+	"gorm.io/gorm"
+)
+
+var jobRepo *JobRepo
+
+func init() {
+	jobRepo = &JobRepo{}
+}
+
+type JobRepo struct {
+	db *gorm.DB
+}
+
+func (jr *JobRepo) Use(db *gorm.DB) {
+	jr.db = db
+}
+
+func (jr *JobRepo) Save(ctx context.Context, job *model.Job) uint {
+	if err := jr.db.Create(job).Error; err != nil {
+		panic(err)
+	}
+
+	return job.ID
+}
+
+func (jr *JobRepo) Get(ctx context.Context, id uint) *model.Job {
+	var jobs []*model.Job
+	if err := jr.db.Where("id = ?", id).Find(&jobs).Error; err != nil {
+		panic(err)
+	}
+
+	if len(jobs) == 0 {
+		return nil
+	}
+	return jobs[0]
+}
+
+// Update 只更新 fields 中给出的列
+func (jr *JobRepo) Update(ctx context.Context, id uint, fields map[string]any) {
+	if err := jr.db.Model(&model.Job{}).Where("id = ?", id).Updates(fields).Error; err != nil {
+		panic(err)
+	}
+}
+
+type ListJobReq struct {
+	Kind   string
+	KbId   uint
+	FileId uint
+	Status []string
+	Limit  int
+}
+
+func (jr *JobRepo) List(ctx context.Context, listReq ListJobReq) []*model.Job {
+	var jobs []*model.Job
+
+	tx := jr.db.Order("id desc")
+	if listReq.Kind != "" {
+		tx = tx.Where("kind = ?", listReq.Kind)
+	}
+	if listReq.KbId > 0 {
+		tx = tx.Where("kb_id = ?", listReq.KbId)
+	}
+	if listReq.FileId > 0 {
+		tx = tx.Where("file_id = ?", listReq.FileId)
+	}
+	if len(listReq.Status) > 0 {
+		tx = tx.Where("status in (?)", listReq.Status)
+	}
+	if listReq.Limit > 0 {
+		tx = tx.Limit(listReq.Limit)
+	}
+
+	if err := tx.Find(&jobs).Error; err != nil {
+		panic(err)
+	}
+
+	return jobs
+}
@@ -0,0 +1,90 @@
+package dao
+
+import (
+	"context"
+	"go-doudou-rag/module-knowledge/internal/model"
+	"gorm.io/gorm"
+)
+
+var knowledgeBaseRepo *KnowledgeBaseRepo
+
+func init() {
+	knowledgeBaseRepo = &KnowledgeBaseRepo{}
+}
+
+type KnowledgeBaseRepo struct {
+	db *gorm.DB
+}
+
+func (kr *KnowledgeBaseRepo) Use(db *gorm.DB) {
+	kr.db = db
+}
+
+func (kr *KnowledgeBaseRepo) Save(ctx context.Context, kb *model.KnowledgeBase) uint {
+	if err := kr.db.Save(kb).Error; err != nil {
+		panic(err)
+	}
+
+	return kb.ID
+}
+
+func (kr *KnowledgeBaseRepo) Get(ctx context.Context, id uint) *model.KnowledgeBase {
+	var kbs []*model.KnowledgeBase
+	if err := kr.db.Where("id = ?", id).Find(&kbs).Error; err != nil {
+		panic(err)
+	}
+
+	if len(kbs) == 0 {
+		return nil
+	}
+	return kbs[0]
+}
+
+func (kr *KnowledgeBaseRepo) GetByName(ctx context.Context, name string) *model.KnowledgeBase {
+	var kbs []*model.KnowledgeBase
+	if err := kr.db.Where("name = ?", name).Find(&kbs).Error; err != nil {
+		panic(err)
+	}
+
+	if len(kbs) == 0 {
+		return nil
+	}
+	return kbs[0]
+}
+
+func (kr *KnowledgeBaseRepo) List(ctx context.Context) []*model.KnowledgeBase {
+	var kbs []*model.KnowledgeBase
+	if err := kr.db.Order("id").Find(&kbs).Error; err != nil {
+		panic(err)
+	}
+
+	return kbs
+}
+
+// EnsureDefault 返回默认知识库，不存在时创建
+func (kr *KnowledgeBaseRepo) EnsureDefault(ctx context.Context) *model.KnowledgeBase {
+	var kbs []*model.KnowledgeBase
+	if err := kr.db.Where("is_default = ?", true).Find(&kbs).Error; err != nil {
+		panic(err)
+	}
+
+	if len(kbs) > 0 {
+		return kbs[0]
+	}
+
+	kb := &model.KnowledgeBase{
+		Name:        "default",
+		Description: "默认知识库",
+		Collection:  model.DefaultCollection,
+		IsDefault:   true,
+	}
+	kr.Save(ctx, kb)
+	return kb
+}
+
+// Delete 软删除，依赖 gorm.DeletedAt
+func (kr *KnowledgeBaseRepo) Delete(ctx context.Context, id uint) {
+	if err := kr.db.Delete(&model.KnowledgeBase{}, id).Error; err != nil {
+		panic(err)
+	}
+}
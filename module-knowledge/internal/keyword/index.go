@@ -0,0 +1,168 @@
+package keyword
+
+import (
+	"math"
+	"sort"
+	"sync"
+)
+
+// BM25 参数
+const (
+	k1 = 1.2
+	b  = 0.75
+)
+
+type document struct {
+	content  string
+	metadata map[string]string
+	length   int
+}
+
+// Hit 关键词检索命中的分块
+type Hit struct {
+	ID       string
+	Content  string
+	Metadata map[string]string
+	Score    float32
+}
+
+// Index 内存中的 BM25 倒排索引，并发安全
+type Index struct {
+	mu        sync.RWMutex
+	documents map[string]*document
+	// 检索词 -> 分块ID -> 词频
+	postings    map[string]map[string]int
+	totalLength int
+}
+
+func NewIndex() *Index {
+	return &Index{
+		documents: make(map[string]*document),
+		postings:  make(map[string]map[string]int),
+	}
+}
+
+// Add 添加分块，ID 已存在时覆盖
+func (receiver *Index) Add(id, content string, metadata map[string]string) {
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+
+	receiver.deleteLocked(id)
+
+	tokens := Tokenize(content)
+	for _, token := range tokens {
+		if receiver.postings[token] == nil {
+			receiver.postings[token] = make(map[string]int)
+		}
+		receiver.postings[token][id]++
+	}
+	receiver.documents[id] = &document{
+		content:  content,
+		metadata: metadata,
+		length:   len(tokens),
+	}
+	receiver.totalLength += len(tokens)
+}
+
+// Delete 删除元数据与 where 全部相等的分块
+func (receiver *Index) Delete(where map[string]string) {
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+
+	for id, doc := range receiver.documents {
+		if match(doc.metadata, where) {
+			receiver.deleteLocked(id)
+		}
+	}
+}
+
+func (receiver *Index) deleteLocked(id string) {
+	doc, ok := receiver.documents[id]
+	if !ok {
+		return
+	}
+	for _, token := range Tokenize(doc.content) {
+		if postings, ok := receiver.postings[token]; ok {
+			delete(postings, id)
+			if len(postings) == 0 {
+				delete(receiver.postings, token)
+			}
+		}
+	}
+	receiver.totalLength -= doc.length
+	delete(receiver.documents, id)
+}
+
+// Count 返回分块数量
+func (receiver *Index) Count() int {
+	receiver.mu.RLock()
+	defer receiver.mu.RUnlock()
+	return len(receiver.documents)
+}
+
+// Search 返回 BM25 得分最高的 n 个分块，filter 不为空时只检索 filter 返回 true 的分块
+func (receiver *Index) Search(query string, n int, filter func(metadata map[string]string, content string) bool) []Hit {
+	receiver.mu.RLock()
+	defer receiver.mu.RUnlock()
+
+	if n <= 0 || len(receiver.documents) == 0 {
+		return nil
+	}
+
+	total := float64(len(receiver.documents))
+	avgLength := float64(receiver.totalLength) / total
+
+	scores := make(map[string]float64)
+	seen := make(map[string]struct{})
+	for _, token := range Tokenize(query) {
+		if _, ok := seen[token]; ok {
+			continue
+		}
+		seen[token] = struct{}{}
+
+		postings := receiver.postings[token]
+		if len(postings) == 0 {
+			continue
+		}
+		idf := math.Log(1 + (total-float64(len(postings))+0.5)/(float64(len(postings))+0.5))
+		for id, tf := range postings {
+			doc := receiver.documents[id]
+			if filter != nil && !filter(doc.metadata, doc.content) {
+				continue
+			}
+			freq := float64(tf)
+			scores[id] += idf * freq * (k1 + 1) / (freq + k1*(1-b+b*float64(doc.length)/avgLength))
+		}
+	}
+
+	hits := make([]Hit, 0, len(scores))
+	for id, score := range scores {
+		doc := receiver.documents[id]
+		hits = append(hits, Hit{
+			ID:       id,
+			Content:  doc.content,
+			Metadata: doc.metadata,
+			Score:    float32(score),
+		})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].ID < hits[j].ID
+	})
+	if len(hits) > n {
+		hits = hits[:n]
+	}
+
+	return hits
+}
+
+func match(metadata, where map[string]string) bool {
+	for key, value := range where {
+		if metadata[key] != value {
+			return false
+		}
+	}
+	return true
+}
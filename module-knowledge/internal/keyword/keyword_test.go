@@ -0,0 +1,121 @@
+package keyword
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{
+			name: "长词同时输出短词",
+			text: "出差住宿费标准",
+			want: []string{"出差", "住宿", "宿费", "住宿费", "标准"},
+		},
+		{
+			name: "词典外的文号简称",
+			text: "杭政办函〔2024〕12号",
+			want: []string{"杭政办", "函", "2024", "12", "号"},
+		},
+		{
+			name: "字母转小写，数字保留小数点",
+			text: "GPT-4o 单价0.5元/千Token.",
+			want: []string{"gpt", "4o", "单价", "0.5", "元", "千", "token"},
+		},
+		{
+			name: "只有标点和空白",
+			text: " ，。\n\t",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Tokenize(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Tokenize() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIndexSearch(t *testing.T) {
+	index := NewIndex()
+	index.Add("1", "出差住宿费一类城市每天不超过五百元", map[string]string{"file_id": "1"})
+	index.Add("2", "出差交通费乘坐高铁二等座", map[string]string{"file_id": "1"})
+	index.Add("3", "住宿费住宿费住宿费", map[string]string{"file_id": "2"})
+	index.Add("4", "机房空调巡检记录", map[string]string{"file_id": "3"})
+
+	ids := func(hits []Hit) []string {
+		var result []string
+		for _, item := range hits {
+			result = append(result, item.ID)
+		}
+		return result
+	}
+
+	tests := []struct {
+		name   string
+		query  string
+		n      int
+		filter func(metadata map[string]string, content string) bool
+		want   []string
+	}{
+		{
+			name:  "词频高的分块排在前面",
+			query: "住宿费",
+			n:     10,
+			want:  []string{"3", "1"},
+		},
+		{
+			name:  "命中的词越多得分越高",
+			query: "住宿费五百元",
+			n:     10,
+			want:  []string{"1", "3"},
+		},
+		{
+			name:  "词频相同时短的分块排在前面",
+			query: "出差",
+			n:     10,
+			want:  []string{"2", "1"},
+		},
+		{
+			name:  "数量限制",
+			query: "住宿费",
+			n:     1,
+			want:  []string{"3"},
+		},
+		{
+			name:  "过滤",
+			query: "住宿费",
+			n:     10,
+			filter: func(metadata map[string]string, content string) bool {
+				return metadata["file_id"] == "1"
+			},
+			want: []string{"1"},
+		},
+		{
+			name:  "没有命中",
+			query: "报销流程",
+			n:     10,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ids(index.Search(tt.query, tt.n, tt.filter)); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Search() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// 覆盖和删除后倒排索引同步更新
+	index.Add("3", "机房巡检", map[string]string{"file_id": "2"})
+	index.Delete(map[string]string{"file_id": "3"})
+	if got := ids(index.Search("住宿费", 10, nil)); !reflect.DeepEqual(got, []string{"1"}) || index.Count() != 3 {
+		t.Fatalf("after update: hits = %v, count = %d", got, index.Count())
+	}
+	if got := ids(index.Search("空调", 10, nil)); got != nil {
+		t.Fatalf("deleted chunk still found: %v", got)
+	}
+}
@@ -0,0 +1,73 @@
+package keyword
+
+import (
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/go-ego/gse"
+)
+
+var (
+	segmenter     gse.Segmenter
+	segmenterOnce sync.Once
+)
+
+// loadSegmenter 第一次分词时加载内嵌的简体中文词典，加载需要几秒钟
+func loadSegmenter() {
+	segmenterOnce.Do(func() {
+		segmenter.SkipLog = true
+		if err := segmenter.LoadDictEmbed("zh_s"); err != nil {
+			panic(err)
+		}
+	})
+}
+
+// Tokenize 把文本切分成检索词。连续的汉字用 gse 按词典以搜索引擎模式分词，长词同时输出其中的短词，
+// 例如“住宿费”切分为 住宿 宿费 住宿费；词典里没有的词（如“杭政办函”这类文号简称）由 HMM 识别新词。
+// 连续的字母、数字作为一个词，数字中的小数点保留，标点和空白丢弃。
+// 例如“杭政办函〔2024〕12号”切分为 杭政办 函 2024 12 号
+func Tokenize(text string) []string {
+	var tokens []string
+	var han []rune
+	var word []rune
+
+	flushHan := func() {
+		if len(han) > 0 {
+			loadSegmenter()
+			for _, token := range segmenter.CutSearch(string(han), true) {
+				if token = strings.TrimSpace(token); token != "" {
+					tokens = append(tokens, token)
+				}
+			}
+		}
+		han = han[:0]
+	}
+	flushWord := func() {
+		if len(word) > 0 {
+			tokens = append(tokens, string(word))
+		}
+		word = word[:0]
+	}
+
+	runes := []rune(strings.ToLower(text))
+	for i, r := range runes {
+		switch {
+		case unicode.Is(unicode.Han, r):
+			flushWord()
+			han = append(han, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			flushHan()
+			word = append(word, r)
+		case r == '.' && len(word) > 0 && unicode.IsDigit(word[len(word)-1]) && i+1 < len(runes) && unicode.IsDigit(runes[i+1]):
+			word = append(word, r)
+		default:
+			flushHan()
+			flushWord()
+		}
+	}
+	flushHan()
+	flushWord()
+
+	return tokens
+}
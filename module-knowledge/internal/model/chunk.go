@@ -0,0 +1,16 @@
+package model
+
+import (
+	"time"
+)
+
+// Chunk 保存分块原文，用于启动时重建关键词索引。分块是可以重新生成的派生数据，直接物理删除
+type Chunk struct {
+	ID        string            `gorm:"primarykey" json:"id"`
+	KbID      uint              `gorm:"index" json:"kb_id"`
+	File      string            `gorm:"index" json:"file"`
+	Content   string            `json:"content"`
+	Metadata  map[string]string `gorm:"serializer:json" json:"metadata"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
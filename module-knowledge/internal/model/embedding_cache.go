@@ -0,0 +1,13 @@
+package model
+
+import (
+	"time"
+)
+
+// EmbeddingCache 向量缓存，相同模型下内容相同的文本只向量化一次。缓存可以随时清空，直接物理删除
+type EmbeddingCache struct {
+	Model     string    `gorm:"primarykey" json:"model"`
+	Hash      string    `gorm:"primarykey" json:"hash"`
+	Embedding []float32 `gorm:"serializer:json" json:"embedding"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -5,10 +5,20 @@ import (
 	"time"
 )
 
+// File 每上传一个新版本就新增一行，Name 相同的记录构成版本历史，
+// 同一时刻只有 Current 为 true 的版本的分块存在于向量库中
 type File struct {
-	ID        uint           `gorm:"primarykey" json:"id"`
-	Path      string         `json:"path"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at"`
+	ID            uint           `gorm:"primarykey" json:"id"`
+	KbID          uint           `gorm:"index" json:"kb_id"`
+	Name          string         `gorm:"index" json:"name"`
+	Hash          string         `gorm:"index" json:"hash"`
+	Version       int            `json:"version"`
+	Current       bool           `json:"current"`
+	ChunkStrategy string         `json:"chunk_strategy"`
+	Tags          []string       `gorm:"serializer:json" json:"tags"`
+	Path          string         `json:"path"`
+	Images        []string       `gorm:"serializer:json" json:"images"`
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+	DeletedAt     gorm.DeletedAt `gorm:"index" json:"deleted_at"`
 }
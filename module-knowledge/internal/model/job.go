@@ -0,0 +1,48 @@
+package model
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+const (
+	JobStatusQueued    = "queued"
+	JobStatusRunning   = "running"
+	JobStatusSucceeded = "succeeded"
+	JobStatusFailed    = "failed"
+)
+
+const (
+	JobKindIngest  = "ingest"
+	JobKindReembed = "reembed"
+)
+
+const (
+	JobStageExtracting = "extracting"
+	JobStageSplitting  = "splitting"
+	JobStageEmbedding  = "embedding"
+	JobStagePersisting = "persisting"
+	JobStageDone       = "done"
+)
+
+// Job 记录一个文件的异步入库任务或者一个知识库的重新向量化任务及各阶段进度
+type Job struct {
+	ID             uint           `gorm:"primarykey" json:"id"`
+	Kind           string         `gorm:"index;default:ingest" json:"kind"`
+	FileID         uint           `gorm:"index" json:"file_id"`
+	KbID           uint           `gorm:"index" json:"kb_id"`
+	Status         string         `gorm:"index" json:"status"`
+	Stage          string         `json:"stage"`
+	PagesTotal     int            `json:"pages_total"`
+	PagesExtracted int            `json:"pages_extracted"`
+	ImagesTotal    int            `json:"images_total"`
+	ImagesAnalysed int            `json:"images_analysed"`
+	ChunksTotal    int            `json:"chunks_total"`
+	ChunksEmbedded int            `json:"chunks_embedded"`
+	Error          string         `json:"error"`
+	StartedAt      *time.Time     `json:"started_at"`
+	FinishedAt     *time.Time     `json:"finished_at"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	DeletedAt      gorm.DeletedAt `gorm:"index" json:"deleted_at"`
+}
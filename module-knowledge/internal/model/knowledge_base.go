@@ -0,0 +1,29 @@
+package model
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// DefaultCollection 默认知识库使用的 chromem 集合，沿用引入多知识库之前的集合名称
+const DefaultCollection = "knowledge-base"
+
+// KnowledgeBase 每个知识库对应一个向量集合，为空的配置项使用 moduleknowledge 配置中的默认值。
+// IndexedModel 和 Dimension 记录集合中已有向量实际使用的向量化模型和维度，与配置的模型不一致时需要重新向量化
+type KnowledgeBase struct {
+	ID             uint           `gorm:"primarykey" json:"id"`
+	Name           string         `gorm:"index" json:"name"`
+	Description    string         `json:"description"`
+	Collection     string         `json:"collection"`
+	IsDefault      bool           `json:"is_default"`
+	EmbeddingModel string         `json:"embedding_model"`
+	ChunkStrategy  string         `json:"chunk_strategy"`
+	ChunkSize      int            `json:"chunk_size"`
+	ChunkOverlap   int            `json:"chunk_overlap"`
+	PromptTemplate string         `json:"prompt_template"`
+	IndexedModel   string         `json:"indexed_model"`
+	Dimension      int            `json:"dimension"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	DeletedAt      gorm.DeletedAt `gorm:"index" json:"deleted_at"`
+}
@@ -0,0 +1,498 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/philippgille/chromem-go"
+	"github.com/samber/lo"
+	concpool "github.com/sourcegraph/conc/pool"
+	"github.com/unionj-cloud/toolkit/stringutils"
+	"github.com/unionj-cloud/toolkit/zlogger"
+	"gorm.io/gorm"
+
+	"go-doudou-rag/module-knowledge/dto"
+	"go-doudou-rag/module-knowledge/internal/dao"
+	"go-doudou-rag/module-knowledge/internal/model"
+	"go-doudou-rag/module-knowledge/loader"
+	"go-doudou-rag/module-knowledge/vectorstore"
+)
+
+// 每批向量化的分块数量，每完成一批更新一次任务进度
+const embeddingBatchSize = 32
+
+// 进度写回数据库的最小间隔，阶段切换和任务结束时会立即写回
+const progressFlushInterval = time.Second
+
+var _ loader.Progress = (*jobProgress)(nil)
+
+// jobProgress 在内存中累计入库任务的进度并节流写回数据库
+type jobProgress struct {
+	mu        sync.Mutex
+	jobId     uint
+	lastFlush time.Time
+
+	pagesTotal     int
+	pagesExtracted int
+	imagesTotal    int
+	imagesAnalysed int
+	chunksTotal    int
+	chunksEmbedded int
+
+	images []string
+}
+
+func newJobProgress(jobId uint) *jobProgress {
+	return &jobProgress{
+		jobId: jobId,
+	}
+}
+
+func (receiver *jobProgress) PagesFound(n int) {
+	receiver.add(&receiver.pagesTotal, n)
+}
+
+func (receiver *jobProgress) PageExtracted() {
+	receiver.add(&receiver.pagesExtracted, 1)
+}
+
+func (receiver *jobProgress) ImageExtracted(file string) {
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+	receiver.images = append(receiver.images, file)
+}
+
+// extractedImages 返回本次任务写出的全部图片文件，删除文档时一并清理
+func (receiver *jobProgress) extractedImages() []string {
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+	return append([]string(nil), receiver.images...)
+}
+
+func (receiver *jobProgress) ImagesFound(n int) {
+	receiver.add(&receiver.imagesTotal, n)
+}
+
+func (receiver *jobProgress) ImageAnalysed() {
+	receiver.add(&receiver.imagesAnalysed, 1)
+}
+
+func (receiver *jobProgress) ChunksFound(n int) {
+	receiver.add(&receiver.chunksTotal, n)
+}
+
+func (receiver *jobProgress) ChunksEmbedded(n int) {
+	receiver.add(&receiver.chunksEmbedded, n)
+}
+
+func (receiver *jobProgress) add(counter *int, n int) {
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+	*counter += n
+	if time.Since(receiver.lastFlush) >= progressFlushInterval {
+		receiver.flushLocked(nil)
+	}
+}
+
+func (receiver *jobProgress) start() {
+	now := time.Now()
+	receiver.flush(map[string]any{
+		"status":     model.JobStatusRunning,
+		"stage":      model.JobStageExtracting,
+		"error":      "",
+		"started_at": &now,
+	})
+}
+
+func (receiver *jobProgress) stage(stage string) {
+	receiver.flush(map[string]any{
+		"stage": stage,
+	})
+}
+
+func (receiver *jobProgress) succeed() {
+	now := time.Now()
+	receiver.flush(map[string]any{
+		"status":      model.JobStatusSucceeded,
+		"stage":       model.JobStageDone,
+		"finished_at": &now,
+	})
+}
+
+func (receiver *jobProgress) fail(reason string) {
+	now := time.Now()
+	receiver.flush(map[string]any{
+		"status":      model.JobStatusFailed,
+		"error":       reason,
+		"finished_at": &now,
+	})
+}
+
+func (receiver *jobProgress) flush(fields map[string]any) {
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+	receiver.flushLocked(fields)
+}
+
+func (receiver *jobProgress) flushLocked(fields map[string]any) {
+	if fields == nil {
+		fields = make(map[string]any)
+	}
+	fields["pages_total"] = receiver.pagesTotal
+	fields["pages_extracted"] = receiver.pagesExtracted
+	fields["images_total"] = receiver.imagesTotal
+	fields["images_analysed"] = receiver.imagesAnalysed
+	fields["chunks_total"] = receiver.chunksTotal
+	fields["chunks_embedded"] = receiver.chunksEmbedded
+	dao.GetJobRepo().Update(context.Background(), receiver.jobId, fields)
+	receiver.lastFlush = time.Now()
+}
+
+// startWorkers 启动入库 worker，并把上次退出时还没有完成的任务重新放回队列
+func (receiver *ModuleKnowledgeImpl) startWorkers() {
+	workers := receiver.conf.Biz.Ingest.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		receiver.workers.Add(1)
+		go func() {
+			defer receiver.workers.Done()
+			for {
+				select {
+				case jobId := <-receiver.jobs:
+					receiver.runJob(jobId)
+				case <-receiver.stop:
+					return
+				}
+			}
+		}()
+	}
+
+	unfinished := dao.GetJobRepo().List(context.Background(), dao.ListJobReq{
+		Status: []string{model.JobStatusQueued, model.JobStatusRunning},
+	})
+	if len(unfinished) == 0 {
+		return
+	}
+	go func() {
+		// List 按 id 倒序返回，先提交的任务先执行
+		for i := len(unfinished) - 1; i >= 0; i-- {
+			zlogger.Info().Msgf("Resume ingestion job %d", unfinished[i].ID)
+			select {
+			case receiver.jobs <- unfinished[i].ID:
+			case <-receiver.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Close 停止入库 worker，等待正在执行的任务结束。队列中还没有开始的任务保持排队状态，下次启动时继续执行
+func (receiver *ModuleKnowledgeImpl) Close() {
+	receiver.stopOnce.Do(func() {
+		close(receiver.stop)
+	})
+	receiver.workers.Wait()
+}
+
+// submitJob 为文件创建入库任务并放入队列
+func (receiver *ModuleKnowledgeImpl) submitJob(ctx context.Context, fileId uint) uint {
+	return receiver.enqueue(ctx, &model.Job{
+		Kind:   model.JobKindIngest,
+		FileID: fileId,
+	})
+}
+
+// enqueue 保存任务并放入队列，队列已满时任务直接失败
+func (receiver *ModuleKnowledgeImpl) enqueue(ctx context.Context, job *model.Job) uint {
+	job.Status = model.JobStatusQueued
+	jobId := dao.GetJobRepo().Save(ctx, job)
+
+	select {
+	case receiver.jobs <- jobId:
+	default:
+		newJobProgress(jobId).fail("ingestion queue is full")
+		panic("ingestion queue is full, please retry later")
+	}
+
+	return jobId
+}
+
+func (receiver *ModuleKnowledgeImpl) runJob(jobId uint) {
+	ctx := context.Background()
+
+	job := dao.GetJobRepo().Get(ctx, jobId)
+	if job == nil {
+		return
+	}
+
+	progress := newJobProgress(jobId)
+	defer func() {
+		if r := recover(); r != nil {
+			zlogger.Error().Msgf("Job %d failed: %v", jobId, r)
+			progress.fail(fmt.Sprint(r))
+		}
+	}()
+
+	if job.Kind == model.JobKindReembed {
+		kb := receiver.base(job.KbID)
+		progress.start()
+		receiver.reembed(ctx, kb, progress)
+		progress.succeed()
+		return
+	}
+
+	file := dao.GetFileRepo().Get(ctx, job.FileID)
+	if file == nil {
+		panic(fmt.Sprintf("file %d not found", job.FileID))
+	}
+
+	kb := receiver.base(file.KbID)
+
+	progress.start()
+	receiver.ingest(ctx, kb, file, progress)
+	progress.succeed()
+}
+
+// ingest 抽取、分割、向量化文件内容，替换知识库中同名文件旧版本的分块并持久化向量库
+func (receiver *ModuleKnowledgeImpl) ingest(ctx context.Context, kb *knowledgeBase, file *model.File, progress *jobProgress) {
+	docs := receiver.load(ctx, file.Path, kb.PromptTemplate, progress)
+	dao.GetFileRepo().UpdateImages(ctx, file.ID, progress.extractedImages())
+	if len(docs) == 0 {
+		panic("内容为空")
+	}
+
+	progress.stage(model.JobStageSplitting)
+	documents := receiver.split(kb, file, docs)
+	progress.ChunksFound(len(documents))
+
+	// 先计算好全部向量，替换时不再请求模型，检索不会看到新旧版本混在一起的中间状态
+	progress.stage(model.JobStageEmbedding)
+	embed(ctx, kb.embeddingFunc, documents, progress.ChunksEmbedded)
+
+	progress.stage(model.JobStagePersisting)
+	for !receiver.replace(ctx, kb, file, documents) {
+		// 向量化期间知识库完成了重新向量化，按新的模型再算一次
+		kb = receiver.base(kb.ID)
+		embed(ctx, kb.embeddingFunc, documents, func(int) {})
+	}
+	receiver.persist()
+}
+
+// embed 按批并发计算分块的向量，每完成一批调用一次 done
+func embed(ctx context.Context, embeddingFunc chromem.EmbeddingFunc, documents []vectorstore.Document, done func(n int)) {
+	for start := 0; start < len(documents); start += embeddingBatchSize {
+		end := min(start+embeddingBatchSize, len(documents))
+		g := concpool.New().WithContext(ctx).WithCancelOnError().WithMaxGoroutines(runtime.NumCPU())
+		for i := start; i < end; i++ {
+			g.Go(func(ctx context.Context) error {
+				embedding, err := embeddingFunc(ctx, documents[i].Content)
+				if err != nil {
+					return err
+				}
+				documents[i].Embedding = embedding
+				return nil
+			})
+		}
+		if err := g.Wait(); err != nil {
+			panic(err)
+		}
+		done(end - start)
+	}
+}
+
+// replace 在向量库和关键词索引中删除同名文件当前版本的分块、写入新版本的分块，并把新版本设为当前版本。
+// 向量库与知识库数据库是同一个库时，向量、分块记录和当前版本的切换在一个事务中完成；
+// 否则分块记录和当前版本的切换在一个事务中完成，向量写了一半时由启动时的 recoverVectors 修复。
+// 知识库已经换成了新的集合（重新向量化）时什么也不做，返回 false
+func (receiver *ModuleKnowledgeImpl) replace(ctx context.Context, kb *knowledgeBase, file *model.File, documents []vectorstore.Document) bool {
+	receiver.swapMu.Lock()
+	defer receiver.swapMu.Unlock()
+
+	current := receiver.base(kb.ID)
+	if current.Collection != kb.Collection {
+		return false
+	}
+	kb = current
+
+	var replaced []string
+	for _, item := range dao.GetFileRepo().ListVersions(ctx, file.KbID, file.Name) {
+		if item.Current || item.ID == file.ID {
+			replaced = append(replaced, item.Path)
+		}
+	}
+
+	chunks := make([]*model.Chunk, 0, len(documents))
+	for _, item := range documents {
+		chunks = append(chunks, &model.Chunk{
+			ID:       item.ID,
+			KbID:     file.KbID,
+			File:     item.Metadata["file"],
+			Content:  item.Content,
+			Metadata: item.Metadata,
+		})
+	}
+
+	if txStore, ok := receiver.vectorStore.(vectorstore.TxStore); ok {
+		dao.Transaction(ctx, func(tx *gorm.DB) {
+			collection, err := txStore.WithTx(tx).Collection(kb.Collection)
+			if err != nil {
+				panic(err)
+			}
+			replaceVectors(ctx, collection, replaced, documents)
+			dao.GetChunkRepo().WithTx(tx).Replace(ctx, replaced, chunks)
+			dao.GetFileRepo().WithTx(tx).Promote(ctx, file.ID, file.KbID, file.Name)
+		})
+	} else {
+		replaceVectors(ctx, kb.collection, replaced, documents)
+		dao.Transaction(ctx, func(tx *gorm.DB) {
+			dao.GetChunkRepo().WithTx(tx).Replace(ctx, replaced, chunks)
+			dao.GetFileRepo().WithTx(tx).Promote(ctx, file.ID, file.KbID, file.Name)
+		})
+	}
+
+	// 提交之后再更新内存中的关键词索引，事务回滚时索引保持不变
+	for _, path := range replaced {
+		kb.keywords.Delete(map[string]string{
+			"file": path,
+		})
+	}
+	for _, item := range documents {
+		kb.keywords.Add(item.ID, item.Content, item.Metadata)
+	}
+
+	// 第一次写入向量时记录模型和维度
+	if stringutils.IsEmpty(kb.IndexedModel) && len(documents) > 0 {
+		receiver.recordIndex(ctx, kb, kb.embeddingModel, len(documents[0].Embedding))
+	}
+	return true
+}
+
+// replaceVectors 删除 files 的全部向量并写入 documents
+func replaceVectors(ctx context.Context, collection vectorstore.Collection, files []string, documents []vectorstore.Document) {
+	for _, path := range files {
+		if err := collection.Delete(ctx, map[string]string{
+			"file": path,
+		}); err != nil {
+			panic(err)
+		}
+	}
+	if err := collection.Add(ctx, documents); err != nil {
+		panic(err)
+	}
+}
+
+// recoverVectors 修复上次退出时停在写入阶段的入库任务留下的向量。向量库不支持事务时，向量的删除和写入
+// 与分块记录不在一个事务中，中途退出会让同名文件的向量少了或者混着新旧版本。这里按数据库中当前版本的分块
+// 重建这些文件的向量，重建后任务照常重新执行。需要在 worker 启动之前调用
+func (receiver *ModuleKnowledgeImpl) recoverVectors(ctx context.Context) {
+	if _, ok := receiver.vectorStore.(vectorstore.TxStore); ok {
+		return
+	}
+
+	fileRepo := dao.GetFileRepo()
+	for _, job := range dao.GetJobRepo().List(ctx, dao.ListJobReq{
+		Kind:   model.JobKindIngest,
+		Status: []string{model.JobStatusRunning},
+	}) {
+		if job.Stage != model.JobStagePersisting {
+			continue
+		}
+		file := fileRepo.Get(ctx, job.FileID)
+		if file == nil {
+			continue
+		}
+		kb, ok := receiver.bases[file.KbID]
+		if !ok {
+			continue
+		}
+
+		zlogger.Info().Msgf("Recover vectors of file %s in knowledge base %s", file.Name, kb.Name)
+		versions := fileRepo.ListVersions(ctx, file.KbID, file.Name)
+		var current []string
+		for _, item := range versions {
+			if item.Current {
+				current = append(current, item.Path)
+			}
+		}
+		documents := lo.Map(dao.GetChunkRepo().ListByFiles(ctx, current), func(item *model.Chunk, index int) vectorstore.Document {
+			return vectorstore.Document{
+				ID:       item.ID,
+				Content:  item.Content,
+				Metadata: item.Metadata,
+			}
+		})
+		// 分块的向量在中断前已经计算过，一般都能从向量缓存中取到
+		embed(ctx, kb.embeddingFunc, documents, func(int) {})
+		replaceVectors(ctx, kb.collection, lo.Map(versions, func(item *model.File, index int) string {
+			return item.Path
+		}), documents)
+	}
+	receiver.persist()
+}
+
+// persist 写操作在执行时已经落盘，这里只是按需合并，失败时下次再合并，不影响本次操作的结果
+func (receiver *ModuleKnowledgeImpl) persist() {
+	if err := receiver.vectorStore.Persist(); err != nil {
+		zlogger.Error().Msgf("Persist vector store failed: %v", err)
+	}
+}
+
+func (receiver *ModuleKnowledgeImpl) GetJobs(ctx context.Context, req dto.GetJobsReq) (data []dto.JobDTO, err error) {
+	listReq := dao.ListJobReq{
+		Kind:   req.Kind,
+		KbId:   req.KbId,
+		FileId: req.FileId,
+		Limit:  req.Limit,
+	}
+	if stringutils.IsNotEmpty(req.Status) {
+		listReq.Status = stringutils.Split(req.Status, ",")
+	}
+
+	for _, item := range dao.GetJobRepo().List(ctx, listReq) {
+		data = append(data, newJobDTO(item))
+	}
+
+	return data, nil
+}
+
+func (receiver *ModuleKnowledgeImpl) GetJobs_Id(ctx context.Context, id uint) (data dto.JobDTO, err error) {
+	job := dao.GetJobRepo().Get(ctx, id)
+	if job == nil {
+		panic("job not found")
+	}
+
+	return newJobDTO(job), nil
+}
+
+func newJobDTO(job *model.Job) dto.JobDTO {
+	formatTime := func(t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return t.Format(time.DateTime)
+	}
+
+	return dto.JobDTO{
+		Id:             job.ID,
+		Kind:           job.Kind,
+		FileId:         job.FileID,
+		KbId:           job.KbID,
+		Status:         job.Status,
+		Stage:          job.Stage,
+		PagesTotal:     job.PagesTotal,
+		PagesExtracted: job.PagesExtracted,
+		ImagesTotal:    job.ImagesTotal,
+		ImagesAnalysed: job.ImagesAnalysed,
+		ChunksTotal:    job.ChunksTotal,
+		ChunksEmbedded: job.ChunksEmbedded,
+		Error:          job.Error,
+		CreatedAt:      job.CreatedAt.Format(time.DateTime),
+		StartedAt:      formatTime(job.StartedAt),
+		FinishedAt:     formatTime(job.FinishedAt),
+	}
+}
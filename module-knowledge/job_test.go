@@ -0,0 +1,230 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	v3 "github.com/unionj-cloud/toolkit/openapi/v3"
+
+	"go-doudou-rag/module-knowledge/dto"
+	"go-doudou-rag/module-knowledge/internal/dao"
+	"go-doudou-rag/module-knowledge/internal/model"
+	"go-doudou-rag/module-knowledge/vectorstore"
+	"go-doudou-rag/toolkit/llm"
+)
+
+func countVectors(t *testing.T, kb *knowledgeBase) int {
+	count, err := kb.collection.Count(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func TestReplaceRollback(t *testing.T) {
+	svc := newTestService(t, llm.NewFake())
+	ctx := context.Background()
+
+	uploaded := upload(t, svc, "差旅制度.txt", "出差住宿费一类城市每天不超过五百元。", "")
+	kb := svc.base(svc.defaultKbId)
+	file := dao.GetFileRepo().Get(ctx, uploaded.Id)
+	vectors := countVectors(t, kb)
+	chunks := len(dao.GetChunkRepo().ListByKb(ctx, kb.ID))
+
+	// 删除旧向量之后写入新向量失败，整个替换回滚
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("replace should fail for documents without embedding")
+			}
+		}()
+		svc.replace(ctx, kb, file, []vectorstore.Document{{
+			ID:       "broken",
+			Content:  "出差住宿费一类城市每天不超过六百元。",
+			Metadata: map[string]string{"file": file.Path},
+		}})
+	}()
+
+	if got := countVectors(t, kb); got != vectors {
+		t.Fatalf("vectors = %d, want %d", got, vectors)
+	}
+	if got := len(dao.GetChunkRepo().ListByKb(ctx, kb.ID)); got != chunks {
+		t.Fatalf("chunks = %d, want %d", got, chunks)
+	}
+	for _, mode := range []string{retrievalModeVector, retrievalModeKeyword} {
+		results, err := svc.GetQuery(ctx, dto.QueryReq{Text: "住宿费", RetrieveLimit: 3, Mode: mode})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 1 || !strings.Contains(results[0].Content, "五百元") {
+			t.Fatalf("%s results = %+v", mode, results)
+		}
+	}
+}
+
+func TestRecoverVectors(t *testing.T) {
+	dir := t.TempDir()
+	newTestDB(t, dir)
+	conf := newTestConfig(dir)
+	storeFile := filepath.Join(dir, "vectors.gob")
+	openStore := func() *vectorstore.ChromemStore {
+		store, err := vectorstore.NewChromem(vectorstore.ChromemOptions{File: storeFile})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return store
+	}
+	ctx := context.Background()
+
+	svc := startTestService(t, conf, openStore(), llm.NewFake())
+	old := upload(t, svc, "差旅制度.txt", "出差住宿费一类城市每天不超过五百元。", "")
+	current := upload(t, svc, "差旅制度.txt", "出差住宿费一类城市每天不超过六百元。会议室需要提前预约。", "")
+	kb := svc.base(svc.defaultKbId)
+	oldFile := dao.GetFileRepo().Get(ctx, old.Id)
+	currentFile := dao.GetFileRepo().Get(ctx, current.Id)
+	chunks := dao.GetChunkRepo().ListByFiles(ctx, []string{currentFile.Path})
+
+	// 模拟写入向量时进程退出：当前版本的向量删了一半，旧版本的向量还在
+	if err := kb.collection.Delete(ctx, map[string]string{"file": currentFile.Path}); err != nil {
+		t.Fatal(err)
+	}
+	if err := kb.collection.Add(ctx, []vectorstore.Document{{
+		ID:        "stale",
+		Content:   "出差住宿费一类城市每天不超过五百元。",
+		Metadata:  map[string]string{"file": oldFile.Path},
+		Embedding: []float32{1},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	dao.GetJobRepo().Update(ctx, current.JobId, map[string]any{
+		"status": model.JobStatusRunning,
+		"stage":  model.JobStagePersisting,
+	})
+	svc.Close()
+	// 重新执行任务时文件已经不在了，只能依靠启动时的修复
+	if err := os.Remove(currentFile.Path); err != nil {
+		t.Fatal(err)
+	}
+
+	svc = startTestService(t, conf, openStore(), llm.NewFake())
+	kb = svc.base(svc.defaultKbId)
+	if got := countVectors(t, kb); got != len(chunks) {
+		t.Fatalf("vectors = %d, want %d", got, len(chunks))
+	}
+	for _, item := range chunks {
+		doc, err := kb.collection.Get(ctx, item.ID)
+		if err != nil || doc == nil || doc.Content != item.Content || len(doc.Embedding) != conf.Biz.Embedding.Dimension {
+			t.Fatalf("chunk %s = %+v, %v", item.ID, doc, err)
+		}
+	}
+	results, err := svc.GetQuery(ctx, dto.QueryReq{Text: "住宿费", RetrieveLimit: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) == 0 || results[0].FileId != current.Id {
+		t.Fatalf("results = %+v", results)
+	}
+}
+
+func TestJobProgress(t *testing.T) {
+	svc := newTestService(t, llm.NewFake())
+	ctx := context.Background()
+
+	uploaded := upload(t, svc, "制度.txt", "第一条 职工因公出差的住宿费按照城市类别分档报销，一类城市每人每天不超过五百元。"+
+		"第二条 机房空调每周巡检一次，巡检记录需要由值班人员签字确认并保存三年以上。", "")
+	job, err := svc.GetJobs_Id(ctx, uploaded.JobId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Kind != model.JobKindIngest || job.FileId != uploaded.Id || job.Stage != model.JobStageDone ||
+		job.PagesTotal != 1 || job.PagesExtracted != 1 ||
+		job.ChunksTotal < 2 || job.ChunksEmbedded != job.ChunksTotal ||
+		job.StartedAt == "" || job.FinishedAt == "" || job.Error != "" {
+		t.Fatalf("job = %+v", job)
+	}
+
+	// 内容无法解析时任务失败并记录原因，不影响后面的任务
+	broken, err := svc.Upload(ctx, v3.FileModel{
+		Filename: "损坏.docx",
+		Reader:   io.NopCloser(strings.NewReader("not a zip file")),
+	}, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job = waitFinished(t, svc, broken.JobId); job.Status != model.JobStatusFailed || job.Error == "" || job.FinishedAt == "" {
+		t.Fatalf("broken job = %+v", job)
+	}
+	upload(t, svc, "会议室.txt", "会议室需要提前一天预约。", "")
+
+	failed, err := svc.GetJobs(ctx, dto.GetJobsReq{Status: model.JobStatusFailed + "," + model.JobStatusRunning})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failed) != 1 || failed[0].Id != broken.JobId {
+		t.Fatalf("failed jobs = %+v", failed)
+	}
+	jobs, err := svc.GetJobs(ctx, dto.GetJobsReq{FileId: uploaded.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 || jobs[0].Id != uploaded.JobId {
+		t.Fatalf("jobs of file %d = %+v", uploaded.Id, jobs)
+	}
+}
+
+func TestResumeJobs(t *testing.T) {
+	dir := t.TempDir()
+	db := newTestDB(t, dir)
+	vectorStore, err := vectorstore.NewSQLite(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := newTestConfig(dir)
+	conf.Biz.Ingest.QueueSize = 1
+	ctx := context.Background()
+
+	// worker 停掉之后提交的任务留在队列中，队列满了之后提交的任务直接失败
+	svc := startTestService(t, conf, vectorStore, llm.NewFake())
+	svc.Close()
+	queued, err := svc.Upload(ctx, v3.FileModel{
+		Filename: "差旅制度.txt",
+		Reader:   io.NopCloser(strings.NewReader("出差住宿费一类城市每天不超过五百元。")),
+	}, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	func() {
+		defer func() {
+			if r := recover(); r == nil || !strings.Contains(fmt.Sprint(r), "queue is full") {
+				t.Fatalf("recovered = %v", r)
+			}
+		}()
+		_, _ = svc.Upload(ctx, v3.FileModel{
+			Filename: "会议室.txt",
+			Reader:   io.NopCloser(strings.NewReader("会议室需要提前一天预约。")),
+		}, nil, nil, nil)
+	}()
+	rejected, err := svc.GetJobs(ctx, dto.GetJobsReq{Status: model.JobStatusFailed})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rejected) != 1 || !strings.Contains(rejected[0].Error, "queue is full") {
+		t.Fatalf("rejected jobs = %+v", rejected)
+	}
+
+	// 重新启动时继续执行还在排队的任务
+	svc = startTestService(t, conf, vectorStore, llm.NewFake())
+	waitJob(t, svc, queued.JobId)
+	results, err := svc.GetQuery(ctx, dto.QueryReq{Text: "住宿费", RetrieveLimit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].FileId != queued.Id {
+		t.Fatalf("results = %+v", results)
+	}
+}
@@ -0,0 +1,252 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/philippgille/chromem-go"
+	"github.com/samber/do"
+	"github.com/samber/lo"
+	"github.com/unionj-cloud/toolkit/stringutils"
+	"github.com/unionj-cloud/toolkit/zlogger"
+
+	"go-doudou-rag/module-knowledge/chunker"
+	"go-doudou-rag/module-knowledge/dto"
+	"go-doudou-rag/module-knowledge/embedding"
+	"go-doudou-rag/module-knowledge/internal/dao"
+	"go-doudou-rag/module-knowledge/internal/keyword"
+	"go-doudou-rag/module-knowledge/internal/model"
+	"go-doudou-rag/module-knowledge/vectorstore"
+	"go-doudou-rag/toolkit/prompt"
+)
+
+// knowledgeBase 知识库的运行时状态
+type knowledgeBase struct {
+	*model.KnowledgeBase
+	collection vectorstore.Collection
+	// 生成集合中向量的模型，用于在替换旧版本之前先计算好新版本分块的向量
+	embeddingModel string
+	// 向量化分块，结果经过向量缓存，只在入库和重新向量化时使用
+	embeddingFunc chromem.EmbeddingFunc
+	// 向量化检索的问题，不经过向量缓存
+	queryFunc chromem.EmbeddingFunc
+	// BM25 关键词索引，启动时从数据库中的分块原文重建
+	keywords *keyword.Index
+}
+
+// openBase 打开知识库对应的向量集合。集合中已有向量时继续使用生成这些向量的模型，切换模型需要重新向量化
+func (receiver *ModuleKnowledgeImpl) openBase(kb *model.KnowledgeBase) *knowledgeBase {
+	embeddingModel := lo.Ternary(stringutils.IsNotEmpty(kb.IndexedModel), kb.IndexedModel, receiver.embeddingModel(kb))
+	c, err := receiver.vectorStore.Collection(kb.Collection)
+	if err != nil {
+		panic(err)
+	}
+
+	embeddingFunc := receiver.newEmbeddingFunc(embeddingModel)
+	return &knowledgeBase{
+		KnowledgeBase:  kb,
+		collection:     c,
+		embeddingModel: embeddingModel,
+		embeddingFunc:  receiver.cached(embeddingModel, embeddingFunc),
+		queryFunc:      embeddingFunc,
+		keywords:       keyword.NewIndex(),
+	}
+}
+
+// embeddingModel 返回知识库配置的向量化模型，openai 以外的提供方带有提供方前缀，例如 ollama:nomic-embed-text
+func (receiver *ModuleKnowledgeImpl) embeddingModel(kb *model.KnowledgeBase) string {
+	return embedding.Qualify(receiver.conf.Biz.Embedding.Provider,
+		lo.Ternary(stringutils.IsNotEmpty(kb.EmbeddingModel), kb.EmbeddingModel, receiver.conf.Openai.EmbeddingModel))
+}
+
+// newEmbeddingFunc 按带提供方前缀的模型名称创建向量化函数，不经过向量缓存
+func (receiver *ModuleKnowledgeImpl) newEmbeddingFunc(embeddingModel string) chromem.EmbeddingFunc {
+	provider, name := embedding.Parse(embeddingModel)
+	baseUrl := receiver.conf.Biz.Embedding.BaseUrl
+	if stringutils.IsEmpty(baseUrl) && provider == embedding.ProviderOpenAI {
+		baseUrl = receiver.conf.Openai.BaseUrl
+	}
+	embeddingFunc, ok := embedding.New(provider, embedding.Options{
+		BaseUrl:   baseUrl,
+		Token:     lo.Ternary(stringutils.IsNotEmpty(receiver.conf.Openai.Token), receiver.conf.Openai.Token, os.Getenv("OPENAI_API_KEY")),
+		Model:     name,
+		Dimension: receiver.conf.Biz.Embedding.Dimension,
+	})
+	if !ok {
+		panic(fmt.Sprintf("unsupported embedding provider %s, supported providers: %s", provider, strings.Join(embedding.Names(), ", ")))
+	}
+	return embeddingFunc
+}
+
+// stale 集合中已有向量的模型与配置的模型不一致
+func (receiver *ModuleKnowledgeImpl) stale(kb *model.KnowledgeBase) bool {
+	return stringutils.IsNotEmpty(kb.IndexedModel) && kb.IndexedModel != receiver.embeddingModel(kb)
+}
+
+// setBase 替换知识库的运行时状态，知识库的记录修改后都生成新的 knowledgeBase，不修改原来的
+func (receiver *ModuleKnowledgeImpl) setBase(kb *knowledgeBase) {
+	receiver.basesMu.Lock()
+	defer receiver.basesMu.Unlock()
+
+	receiver.bases[kb.ID] = kb
+}
+
+// base 返回知识库，id 为 0 时返回默认知识库
+func (receiver *ModuleKnowledgeImpl) base(id uint) *knowledgeBase {
+	receiver.basesMu.RLock()
+	defer receiver.basesMu.RUnlock()
+
+	kb, ok := receiver.bases[lo.Ternary(id == 0, receiver.defaultKbId, id)]
+	if !ok {
+		panic(fmt.Sprintf("knowledge base %d not found", id))
+	}
+	return kb
+}
+
+// chunking 返回知识库的分割配置，知识库没有配置的项使用全局配置
+func (receiver *ModuleKnowledgeImpl) chunking(kb *knowledgeBase) (string, chunker.Options) {
+	chunking := receiver.conf.Biz.Chunking
+	return lo.Ternary(stringutils.IsNotEmpty(kb.ChunkStrategy), kb.ChunkStrategy, chunking.Strategy),
+		chunker.Options{
+			ChunkSize:    lo.Ternary(kb.ChunkSize > 0, kb.ChunkSize, chunking.ChunkSize),
+			ChunkOverlap: lo.Ternary(kb.ChunkOverlap > 0, kb.ChunkOverlap, chunking.ChunkOverlap),
+		}
+}
+
+func (receiver *ModuleKnowledgeImpl) PostKb(ctx context.Context, req dto.SaveKbReq) (data dto.KbDTO, err error) {
+	validateKb(ctx, 0, req)
+
+	kbRepo := dao.GetKnowledgeBaseRepo()
+	kb := &model.KnowledgeBase{
+		Name:           req.Name,
+		Description:    req.Description,
+		EmbeddingModel: req.EmbeddingModel,
+		ChunkStrategy:  req.ChunkStrategy,
+		ChunkSize:      req.ChunkSize,
+		ChunkOverlap:   req.ChunkOverlap,
+		PromptTemplate: req.PromptTemplate,
+	}
+	kbRepo.Save(ctx, kb)
+	kb.Collection = fmt.Sprintf("kb-%d", kb.ID)
+	kbRepo.Save(ctx, kb)
+
+	receiver.setBase(receiver.openBase(kb))
+
+	return receiver.newKbDTO(kb), nil
+}
+
+func (receiver *ModuleKnowledgeImpl) GetKb(ctx context.Context) (data []dto.KbDTO, err error) {
+	for _, item := range dao.GetKnowledgeBaseRepo().List(ctx) {
+		data = append(data, receiver.newKbDTO(item))
+	}
+	return data, nil
+}
+
+func (receiver *ModuleKnowledgeImpl) GetKb_Id(ctx context.Context, id uint) (data dto.KbDTO, err error) {
+	return receiver.newKbDTO(receiver.base(id).KnowledgeBase), nil
+}
+
+func (receiver *ModuleKnowledgeImpl) PutKb_Id(ctx context.Context, id uint, req dto.SaveKbReq) (data dto.KbDTO, err error) {
+	validateKb(ctx, receiver.base(id).ID, req)
+
+	receiver.swapMu.Lock()
+	defer receiver.swapMu.Unlock()
+
+	kb := receiver.base(id)
+	updated := *kb.KnowledgeBase
+	updated.Name = req.Name
+	updated.Description = req.Description
+	updated.EmbeddingModel = req.EmbeddingModel
+	updated.ChunkStrategy = req.ChunkStrategy
+	updated.ChunkSize = req.ChunkSize
+	updated.ChunkOverlap = req.ChunkOverlap
+	updated.PromptTemplate = req.PromptTemplate
+	dao.GetKnowledgeBaseRepo().Save(ctx, &updated)
+
+	// 集合中已有向量时仍然使用原来的模型，直到重新向量化
+	reopened := receiver.openBase(&updated)
+	// 关键词索引与集合一样沿用已有的
+	reopened.keywords = kb.keywords
+	receiver.setBase(reopened)
+
+	return receiver.newKbDTO(&updated), nil
+}
+
+func (receiver *ModuleKnowledgeImpl) DeleteKb_Id(ctx context.Context, id uint) (err error) {
+	kb := receiver.base(id)
+	if kb.IsDefault {
+		panic("cannot delete the default knowledge base")
+	}
+
+	// 删除期间不接受上传，避免删除后留下该知识库的文件和入库任务
+	receiver.uploadMu.Lock()
+	defer receiver.uploadMu.Unlock()
+	receiver.swapMu.Lock()
+	defer receiver.swapMu.Unlock()
+
+	kb = receiver.base(kb.ID)
+	files := dao.GetFileRepo().List(ctx, dao.ListReq{
+		KbId: kb.ID,
+	})
+	receiver.removeFiles(ctx, kb, files)
+
+	if err = receiver.vectorStore.DeleteCollection(kb.Collection); err != nil {
+		panic(err)
+	}
+	receiver.persist()
+
+	dao.GetChunkRepo().DeleteByKb(ctx, kb.ID)
+	dao.GetKnowledgeBaseRepo().Delete(ctx, kb.ID)
+
+	receiver.basesMu.Lock()
+	delete(receiver.bases, kb.ID)
+	receiver.basesMu.Unlock()
+
+	return nil
+}
+
+func validateKb(ctx context.Context, id uint, req dto.SaveKbReq) {
+	if stringutils.IsEmpty(strings.TrimSpace(req.Name)) {
+		panic("name is required")
+	}
+	if existing := dao.GetKnowledgeBaseRepo().GetByName(ctx, req.Name); existing != nil && existing.ID != id {
+		panic(fmt.Sprintf("knowledge base %s already exists", req.Name))
+	}
+	if stringutils.IsNotEmpty(req.ChunkStrategy) {
+		if _, ok := chunker.New(req.ChunkStrategy, chunker.Options{}); !ok {
+			panic(fmt.Sprintf("unsupported chunk strategy, supported strategies: %s", strings.Join(chunker.Names(), ", ")))
+		}
+	}
+	if req.ChunkSize < 0 || req.ChunkOverlap < 0 {
+		panic("chunk size and chunk overlap must not be negative")
+	}
+	// 模板在 modulechat 中维护，没有部署 modulechat 时无法检查，只记录警告
+	if stringutils.IsNotEmpty(req.PromptTemplate) && req.PromptTemplate != prompt.Default {
+		if _, err := do.Invoke[prompt.Store](nil); err != nil {
+			zlogger.Warn().Msgf("Prompt template %s is not checked, no prompt template store is provided", req.PromptTemplate)
+		} else if _, ok := prompt.Lookup(ctx, req.PromptTemplate, 0); !ok {
+			panic(fmt.Sprintf("prompt template %s not found", req.PromptTemplate))
+		}
+	}
+}
+
+func (receiver *ModuleKnowledgeImpl) newKbDTO(kb *model.KnowledgeBase) dto.KbDTO {
+	return dto.KbDTO{
+		Id:             kb.ID,
+		Name:           kb.Name,
+		Description:    kb.Description,
+		IsDefault:      kb.IsDefault,
+		EmbeddingModel: kb.EmbeddingModel,
+		ChunkStrategy:  kb.ChunkStrategy,
+		ChunkSize:      kb.ChunkSize,
+		ChunkOverlap:   kb.ChunkOverlap,
+		PromptTemplate: kb.PromptTemplate,
+		IndexedModel:   kb.IndexedModel,
+		Dimension:      kb.Dimension,
+		Stale:          receiver.stale(kb),
+		CreatedAt:      kb.CreatedAt.Format(time.DateTime),
+	}
+}
@@ -0,0 +1,221 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/samber/do"
+	v3 "github.com/unionj-cloud/toolkit/openapi/v3"
+
+	"go-doudou-rag/module-knowledge/dto"
+	"go-doudou-rag/module-knowledge/internal/dao"
+	"go-doudou-rag/toolkit/llm"
+	"go-doudou-rag/toolkit/prompt"
+)
+
+// uploadTo 上传文件到指定的知识库并等待入库完成
+func uploadTo(t *testing.T, svc *ModuleKnowledgeImpl, kbId uint, name, content string) dto.UploadResult {
+	uploaded, err := svc.Upload(context.Background(), v3.FileModel{
+		Filename: name,
+		Reader:   io.NopCloser(strings.NewReader(content)),
+	}, &kbId, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitJob(t, svc, uploaded.JobId)
+	return uploaded
+}
+
+// mustPanic 执行 fn 并返回 panic 的内容，没有 panic 时测试失败
+func mustPanic(t *testing.T, fn func()) (msg string) {
+	t.Helper()
+	defer func() {
+		r := recover()
+		if r == nil {
+			t.Fatal("should panic")
+		}
+		msg = fmt.Sprint(r)
+	}()
+	fn()
+	return ""
+}
+
+func TestKnowledgeBases(t *testing.T) {
+	svc := newTestService(t, llm.NewFake())
+	ctx := context.Background()
+
+	finance, err := svc.PostKb(ctx, dto.SaveKbReq{Name: "财务", ChunkStrategy: "recursive", ChunkSize: 200})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if finance.IsDefault || finance.Id == svc.defaultKbId {
+		t.Fatalf("kb = %+v", finance)
+	}
+
+	// 相同的文件上传到不同的知识库时各自入库
+	content := "出差住宿费一类城市每天不超过五百元。"
+	inDefault := uploadTo(t, svc, svc.defaultKbId, "差旅制度.txt", content)
+	inFinance := uploadTo(t, svc, finance.Id, "差旅制度.txt", content)
+	if inFinance.Duplicate || inFinance.KbId != finance.Id || inFinance.Id == inDefault.Id {
+		t.Fatalf("uploaded = %+v", inFinance)
+	}
+	uploadTo(t, svc, finance.Id, "报销流程.txt", "报销单需要部门负责人签字。")
+
+	tests := []struct {
+		name string
+		req  dto.QueryReq
+		want []uint
+	}{
+		{"default", dto.QueryReq{}, []uint{svc.defaultKbId}},
+		{"finance", dto.QueryReq{KbIds: []uint{finance.Id}}, []uint{finance.Id}},
+		{"file in finance", dto.QueryReq{Filter: &dto.QueryFilter{FileIds: []uint{inFinance.Id}}}, []uint{finance.Id}},
+		{"both", dto.QueryReq{KbIds: []uint{svc.defaultKbId, finance.Id, finance.Id}}, []uint{svc.defaultKbId, finance.Id}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := tt.req
+			req.Text = "住宿费"
+			req.RetrieveLimit = 10
+			results, err := svc.GetQuery(ctx, req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			kbIds := make(map[uint]bool)
+			for i, item := range results {
+				kbIds[item.KbId] = true
+				if i > 0 && item.Score > results[i-1].Score {
+					t.Fatalf("results are not sorted by score: %+v", results)
+				}
+			}
+			if len(kbIds) != len(tt.want) {
+				t.Fatalf("results = %+v", results)
+			}
+			for _, id := range tt.want {
+				if !kbIds[id] {
+					t.Fatalf("results = %+v", results)
+				}
+			}
+		})
+	}
+
+	files, err := svc.GetList(ctx, dto.GetListReq{KbId: finance.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("files = %+v", files)
+	}
+
+	for _, tt := range []struct {
+		req  dto.SaveKbReq
+		want string
+	}{
+		{dto.SaveKbReq{Name: " "}, "name is required"},
+		{dto.SaveKbReq{Name: "财务"}, "already exists"},
+		{dto.SaveKbReq{Name: "行政", ChunkStrategy: "unknown"}, "unsupported chunk strategy"},
+		{dto.SaveKbReq{Name: "行政", ChunkSize: -1}, "must not be negative"},
+	} {
+		if msg := mustPanic(t, func() { _, _ = svc.PostKb(ctx, tt.req) }); !strings.Contains(msg, tt.want) {
+			t.Fatalf("PostKb(%+v) panic = %q", tt.req, msg)
+		}
+	}
+	// 修改时名称可以和自己相同
+	if _, err = svc.PutKb_Id(ctx, finance.Id, dto.SaveKbReq{Name: "财务", Description: "财务制度"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if msg := mustPanic(t, func() { _ = svc.DeleteKb_Id(ctx, svc.defaultKbId) }); !strings.Contains(msg, "default knowledge base") {
+		t.Fatalf("panic = %q", msg)
+	}
+	if err = svc.DeleteKb_Id(ctx, finance.Id); err != nil {
+		t.Fatal(err)
+	}
+	if msg := mustPanic(t, func() { svc.base(finance.Id) }); !strings.Contains(msg, "not found") {
+		t.Fatalf("panic = %q", msg)
+	}
+	kbs, err := svc.GetKb(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kbs) != 1 || kbs[0].Id != svc.defaultKbId {
+		t.Fatalf("kbs = %+v", kbs)
+	}
+	results, err := svc.GetQuery(ctx, dto.QueryReq{Text: "住宿费", RetrieveLimit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].FileId != inDefault.Id {
+		t.Fatalf("results = %+v", results)
+	}
+}
+
+type fakePromptStore map[string]prompt.Template
+
+func (receiver fakePromptStore) Get(ctx context.Context, name string, version int) (prompt.Template, bool) {
+	tpl, ok := receiver[name]
+	return tpl, ok
+}
+
+func TestKbPromptTemplate(t *testing.T) {
+	svc := newTestService(t, llm.NewFake())
+	ctx := context.Background()
+
+	// 没有部署 modulechat 时不检查模板
+	if _, err := svc.PostKb(ctx, dto.SaveKbReq{Name: "法务", PromptTemplate: "legal"}); err != nil {
+		t.Fatal(err)
+	}
+
+	do.OverrideValue[prompt.Store](nil, fakePromptStore{
+		"travel": {Name: "travel", Version: 1},
+	})
+	t.Cleanup(func() {
+		_ = do.Shutdown[prompt.Store](nil)
+	})
+	for _, name := range []string{"", prompt.Default, "travel"} {
+		if _, err := svc.PostKb(ctx, dto.SaveKbReq{Name: "财务" + name, PromptTemplate: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if msg := mustPanic(t, func() {
+		_, _ = svc.PostKb(ctx, dto.SaveKbReq{Name: "行政", PromptTemplate: "admin"})
+	}); !strings.Contains(msg, "prompt template admin not found") {
+		t.Fatalf("panic = %q", msg)
+	}
+}
+
+func TestDeleteKbWhileUploading(t *testing.T) {
+	svc := newTestService(t, llm.NewFake())
+	ctx := context.Background()
+	finance, err := svc.PostKb(ctx, dto.SaveKbReq{Name: "财务"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 上传还在接收文件内容时删除知识库
+	r, w := io.Pipe()
+	uploaded := make(chan string)
+	go func() {
+		defer func() {
+			uploaded <- fmt.Sprint(recover())
+		}()
+		_, _ = svc.Upload(ctx, v3.FileModel{Filename: "差旅制度.txt", Reader: r}, &finance.Id, nil, nil)
+	}()
+	if _, err = w.Write([]byte("出差住宿费")); err != nil {
+		t.Fatal(err)
+	}
+	if err = svc.DeleteKb_Id(ctx, finance.Id); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = w.Write([]byte("一类城市每天不超过五百元。"))
+	_ = w.Close()
+
+	if msg := <-uploaded; !strings.Contains(msg, "not found") {
+		t.Fatalf("upload panic = %q", msg)
+	}
+	if files := dao.GetFileRepo().List(ctx, dao.ListReq{KbId: finance.Id}); len(files) > 0 {
+		t.Fatalf("files = %+v", files)
+	}
+}
@@ -0,0 +1,348 @@
+package loader
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	concpool "github.com/sourcegraph/conc/pool"
+	"github.com/spf13/cast"
+	"github.com/tmc/langchaingo/schema"
+	"github.com/unionj-cloud/toolkit/stringutils"
+)
+
+const (
+	docxNsWordprocessing = "http://schemas.openxmlformats.org/wordprocessingml/2006/main"
+	docxNsRelationships  = "http://schemas.openxmlformats.org/officeDocument/2006/relationships"
+)
+
+// 标题样式：英文版 Word 为 Heading1 ~ Heading9，中文版 Word 常见为 1 ~ 9
+var docxHeadingStyle = regexp.MustCompile(`^(?i:heading\s*)?([1-9])$`)
+
+func init() {
+	Register(&DocxLoader{}, ".docx", "application/vnd.openxmlformats-officedocument.wordprocessingml.document")
+}
+
+type docxRelationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+type docxTable struct {
+	rows [][]string
+	row  []string
+	cell []string
+}
+
+// docxBody 按阅读顺序保存 DOCX 正文中的段落、标题、表格以及图片引用
+type docxBody struct {
+	blocks []string
+	images []string
+}
+
+func (receiver *docxBody) markdown() string {
+	return strings.Join(receiver.blocks, "\n\n")
+}
+
+// parseDocxBody 解析 word/document.xml，标题转换成 markdown 标题，表格转换成 markdown 表格
+func parseDocxBody(r io.Reader) (*docxBody, error) {
+	var (
+		body      docxBody
+		tables    []*docxTable
+		paragraph strings.Builder
+		heading   int
+		inText    bool
+	)
+
+	decoder := xml.NewDecoder(r)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if t.Name.Space != docxNsWordprocessing {
+				if t.Name.Local == "blip" {
+					for _, attr := range t.Attr {
+						if attr.Name.Space == docxNsRelationships && attr.Name.Local == "embed" {
+							body.images = append(body.images, attr.Value)
+						}
+					}
+				}
+				continue
+			}
+			switch t.Name.Local {
+			case "p":
+				paragraph.Reset()
+				heading = 0
+			case "pStyle":
+				for _, attr := range t.Attr {
+					if attr.Name.Local == "val" {
+						if m := docxHeadingStyle.FindStringSubmatch(attr.Value); m != nil {
+							heading = cast.ToInt(m[1])
+						}
+					}
+				}
+			case "t":
+				inText = true
+			case "tab":
+				paragraph.WriteString("\t")
+			case "br", "cr":
+				paragraph.WriteString("\n")
+			case "tbl":
+				tables = append(tables, &docxTable{})
+			case "tr":
+				if len(tables) > 0 {
+					tables[len(tables)-1].row = nil
+				}
+			case "tc":
+				if len(tables) > 0 {
+					tables[len(tables)-1].cell = nil
+				}
+			}
+		case xml.CharData:
+			if inText {
+				paragraph.Write(t)
+			}
+		case xml.EndElement:
+			if t.Name.Space != docxNsWordprocessing {
+				continue
+			}
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				text := strings.TrimSpace(paragraph.String())
+				if stringutils.IsEmpty(text) {
+					continue
+				}
+				if len(tables) > 0 {
+					table := tables[len(tables)-1]
+					table.cell = append(table.cell, text)
+					continue
+				}
+				if heading > 0 {
+					text = strings.Repeat("#", heading) + " " + text
+				}
+				body.blocks = append(body.blocks, text)
+			case "tc":
+				if len(tables) > 0 {
+					table := tables[len(tables)-1]
+					table.row = append(table.row, strings.Join(table.cell, " "))
+				}
+			case "tr":
+				if len(tables) > 0 {
+					table := tables[len(tables)-1]
+					table.rows = append(table.rows, table.row)
+				}
+			case "tbl":
+				table := tables[len(tables)-1]
+				tables = tables[:len(tables)-1]
+				text := table.markdown()
+				if stringutils.IsEmpty(text) {
+					continue
+				}
+				// 嵌套表格整体作为外层表格当前单元格的内容
+				if len(tables) > 0 {
+					outer := tables[len(tables)-1]
+					outer.cell = append(outer.cell, text)
+					continue
+				}
+				body.blocks = append(body.blocks, text)
+			}
+		}
+	}
+
+	return &body, nil
+}
+
+func (receiver *docxTable) markdown() string {
+	var lines []string
+	for i, row := range receiver.rows {
+		cells := make([]string, len(row))
+		for j, cell := range row {
+			cells[j] = strings.ReplaceAll(strings.ReplaceAll(cell, "\n", " "), "|", "\\|")
+		}
+		lines = append(lines, "| "+strings.Join(cells, " | ")+" |")
+		if i == 0 {
+			lines = append(lines, "|"+strings.Repeat(" --- |", len(row)))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+var _ Loader = (*DocxLoader)(nil)
+
+// DocxLoader 抽取 DOCX 中的段落、标题、表格和内嵌图片，标题和表格转换成 markdown 格式，
+// DOCX 没有分页信息，全部内容都视为第 0 页
+type DocxLoader struct {
+}
+
+func (receiver *DocxLoader) Load(ctx context.Context, file string, opts Options) ([]schema.Document, error) {
+	reader, err := zip.OpenReader(file)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	parts := make(map[string]*zip.File)
+	for _, item := range reader.File {
+		parts[item.Name] = item
+	}
+
+	documentPart, ok := parts["word/document.xml"]
+	if !ok {
+		return nil, errors.New("not a docx file")
+	}
+	rc, err := documentPart.Open()
+	if err != nil {
+		return nil, err
+	}
+	progress := opts.progress()
+	progress.PagesFound(1)
+
+	body, err := parseDocxBody(rc)
+	rc.Close()
+	if err != nil {
+		return nil, err
+	}
+	progress.PageExtracted()
+
+	var docs []schema.Document
+	if text := body.markdown(); stringutils.IsNotEmpty(text) {
+		docs = append(docs, schema.Document{
+			PageContent: text,
+			Metadata: map[string]any{
+				"page":        0,
+				"total_pages": 1,
+				"type":        "text",
+			},
+		})
+	}
+
+	if len(body.images) == 0 || opts.ImageAnalyzer == nil {
+		return docs, nil
+	}
+
+	targets := make(map[string]string)
+	if relsPart, ok := parts["word/_rels/document.xml.rels"]; ok {
+		rc, err := relsPart.Open()
+		if err != nil {
+			return nil, err
+		}
+		var rels docxRelationships
+		err = xml.NewDecoder(rc).Decode(&rels)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range rels.Relationships {
+			if strings.HasPrefix(item.Target, "/") {
+				targets[item.ID] = strings.TrimPrefix(item.Target, "/")
+				continue
+			}
+			targets[item.ID] = path.Join("word", item.Target)
+		}
+	}
+
+	fileName := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+
+	g := concpool.NewWithResults[[]schema.Document]().WithContext(ctx).WithCancelOnError()
+
+	// 写出图片失败后不再提交新的分析任务，但仍然等待已经提交的任务结束再返回
+	var extractErr error
+	seen := make(map[string]struct{})
+	for i, rid := range body.images {
+		mediaPart, ok := parts[targets[rid]]
+		if !ok {
+			continue
+		}
+		if _, ok = seen[mediaPart.Name]; ok {
+			continue
+		}
+		seen[mediaPart.Name] = struct{}{}
+
+		imageOutFile := filepath.Join(opts.ImageSavePath, fmt.Sprintf("%s_%d_%s", fileName, i, path.Base(mediaPart.Name)))
+		extracted, err := extractDocxImage(mediaPart, imageOutFile)
+		if err != nil {
+			extractErr = err
+			break
+		}
+		if !extracted {
+			continue
+		}
+		progress.ImageExtracted(imageOutFile)
+		progress.ImagesFound(1)
+
+		g.Go(func(ctx context.Context) ([]schema.Document, error) {
+			imageDescription := opts.ImageAnalyzer(ctx, imageOutFile)
+			progress.ImageAnalysed()
+			if stringutils.IsEmpty(imageDescription) {
+				return nil, nil
+			}
+			return []schema.Document{
+				{
+					PageContent: imageDescription,
+					Metadata: map[string]any{
+						"page":        0,
+						"total_pages": 1,
+						"image":       imageOutFile,
+						"type":        "image",
+					},
+				},
+			}, nil
+		})
+	}
+
+	groups, err := g.Wait()
+	if extractErr != nil {
+		return nil, extractErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, items := range groups {
+		docs = append(docs, items...)
+	}
+
+	return docs, nil
+}
+
+// extractDocxImage 将内嵌图片写入 imageOutFile，EMF/WMF 等多模态大模型无法识别的格式会被跳过
+func extractDocxImage(mediaPart *zip.File, imageOutFile string) (bool, error) {
+	rc, err := mediaPart.Open()
+	if err != nil {
+		return false, err
+	}
+	defer rc.Close()
+
+	imgData, err := io.ReadAll(rc)
+	if err != nil {
+		return false, err
+	}
+
+	if !strings.HasPrefix(http.DetectContentType(imgData), "image/") {
+		return false, nil
+	}
+
+	if err = os.WriteFile(imageOutFile, imgData, os.ModePerm); err != nil {
+		return false, err
+	}
+	return true, nil
+}
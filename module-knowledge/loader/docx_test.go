@@ -0,0 +1,169 @@
+package loader
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tmc/langchaingo/schema"
+)
+
+const docxHeader = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"
+ xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"
+ xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main">
+<w:body>
+`
+
+func docxImage(rid string) string {
+	return `<w:p><w:r><w:drawing><a:graphic><a:graphicData><a:blip r:embed="` + rid + `"/></a:graphicData></a:graphic></w:drawing></w:r></w:p>
+`
+}
+
+func pngImage(t *testing.T, c color.Color) string {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	img.Set(1, 1, c)
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+// writeDocx 把正文和两张图片 image1.png（rId1）、image2.png（rId2）写成 dir 下的 制度.docx
+func writeDocx(t *testing.T, dir string, body string) string {
+	parts := map[string]string{
+		"word/document.xml": docxHeader + body + "</w:body>\n</w:document>",
+		"word/_rels/document.xml.rels": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/image" Target="media/image1.png"/>
+<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/image" Target="media/image2.png"/>
+</Relationships>`,
+		"word/media/image1.png": pngImage(t, color.RGBA{R: 255, A: 255}),
+		"word/media/image2.png": pngImage(t, color.RGBA{B: 255, A: 255}),
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range parts {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(dir, "制度.docx")
+	if err := os.WriteFile(file, buf.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestDocxLoaderText(t *testing.T) {
+	file := writeDocx(t, t.TempDir(), `<w:p><w:pPr><w:pStyle w:val="Heading1"/></w:pPr><w:r><w:t>差旅管理办法</w:t></w:r></w:p>
+<w:p><w:pPr><w:pStyle w:val="2"/></w:pPr><w:r><w:t>住宿费</w:t></w:r></w:p>
+<w:p><w:r><w:t>一类城市</w:t></w:r><w:r><w:tab/><w:t>每天不超过五百元。</w:t></w:r></w:p>
+<w:p></w:p>
+<w:tbl>
+<w:tr><w:tc><w:p><w:r><w:t>城市</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>标准</w:t></w:r></w:p></w:tc></w:tr>
+<w:tr><w:tc><w:p><w:r><w:t>杭州</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>500|元</w:t></w:r></w:p></w:tc></w:tr>
+</w:tbl>
+`)
+
+	docs, err := (&DocxLoader{}).Load(context.Background(), file, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "# 差旅管理办法\n\n## 住宿费\n\n一类城市\t每天不超过五百元。\n\n" +
+		"| 城市 | 标准 |\n| --- | --- |\n| 杭州 | 500\\|元 |"
+	if len(docs) != 1 || docs[0].PageContent != want {
+		t.Fatalf("docs = %+v", docs)
+	}
+	if docs[0].Metadata["type"] != "text" || docs[0].Metadata["page"] != 0 || docs[0].Metadata["total_pages"] != 1 {
+		t.Fatalf("metadata = %+v", docs[0].Metadata)
+	}
+}
+
+func TestDocxLoaderImages(t *testing.T) {
+	dir := t.TempDir()
+	// 同一张图片引用了两次，只分析一次
+	file := writeDocx(t, dir, `<w:p><w:r><w:t>组织架构</w:t></w:r></w:p>
+`+docxImage("rId1")+docxImage("rId2")+docxImage("rId1")+docxImage("rId9"))
+
+	var mu sync.Mutex
+	var analysed []string
+	docs, err := (&DocxLoader{}).Load(context.Background(), file, Options{
+		ImageSavePath: dir,
+		ImageAnalyzer: func(ctx context.Context, file string) string {
+			mu.Lock()
+			defer mu.Unlock()
+			analysed = append(analysed, file)
+			return "图片描述: " + filepath.Base(file)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(analysed) != 2 {
+		t.Fatalf("analysed = %v", analysed)
+	}
+	images := make(map[string]schema.Document)
+	for _, item := range docs[1:] {
+		images[filepath.Base(item.Metadata["image"].(string))] = item
+	}
+	for _, name := range []string{"制度_0_image1.png", "制度_1_image2.png"} {
+		doc, ok := images[name]
+		if !ok || doc.Metadata["type"] != "image" || doc.PageContent != "图片描述: "+name {
+			t.Fatalf("image docs = %+v", docs[1:])
+		}
+		if _, err = os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(docs) != 3 || docs[0].PageContent != "组织架构" {
+		t.Fatalf("docs = %+v", docs)
+	}
+}
+
+func TestDocxLoaderImageError(t *testing.T) {
+	dir := t.TempDir()
+	file := writeDocx(t, dir, docxImage("rId1")+docxImage("rId2"))
+	// 第二张图片的目标路径是一个目录，写出失败
+	if err := os.Mkdir(filepath.Join(dir, "制度_1_image2.png"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	var finished atomic.Bool
+	_, err := (&DocxLoader{}).Load(context.Background(), file, Options{
+		ImageSavePath: dir,
+		ImageAnalyzer: func(ctx context.Context, file string) string {
+			time.Sleep(100 * time.Millisecond)
+			finished.Store(true)
+			return "图片描述"
+		},
+	})
+	if err == nil || !strings.Contains(err.Error(), "制度_1_image2.png") {
+		t.Fatalf("err = %v", err)
+	}
+	// 返回之前已经提交的分析任务都已经结束
+	if !finished.Load() {
+		t.Fatal("Load returned before the image analysis finished")
+	}
+}
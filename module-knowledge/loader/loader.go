@@ -0,0 +1,113 @@
+package loader
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/tmc/langchaingo/schema"
+)
+
+// Loader 将一个文件解析成按页（或按段落、图片等）组织的文档，文档元数据中需包含
+// page、total_pages 和 type（text/image）三个键，图片文档还需通过 image 键给出抽取出的图片路径
+type Loader interface {
+	Load(ctx context.Context, file string, opts Options) ([]schema.Document, error)
+}
+
+// ImageAnalyzer 使用多模态大模型为图片生成文字描述
+type ImageAnalyzer func(ctx context.Context, file string) string
+
+// Progress 接收加载过程中的进度通知，实现需要是并发安全的
+type Progress interface {
+	PagesFound(n int)
+	PageExtracted()
+	// ImageExtracted 每写出一张图片文件调用一次，file 为图片路径
+	ImageExtracted(file string)
+	// ImagesFound 和 ImageAnalysed 只统计需要交给多模态大模型分析的图片
+	ImagesFound(n int)
+	ImageAnalysed()
+}
+
+type Options struct {
+	// 抽取出的图片的保存目录
+	ImageSavePath string
+	// 为空时不分析图片
+	ImageAnalyzer ImageAnalyzer
+	// 可以为空
+	Progress Progress
+}
+
+type noopProgress struct{}
+
+func (noopProgress) PagesFound(int)        {}
+func (noopProgress) PageExtracted()        {}
+func (noopProgress) ImageExtracted(string) {}
+func (noopProgress) ImagesFound(int)       {}
+func (noopProgress) ImageAnalysed()        {}
+
+func (receiver Options) progress() Progress {
+	if receiver.Progress == nil {
+		return noopProgress{}
+	}
+	return receiver.Progress
+}
+
+var (
+	mu       sync.RWMutex
+	registry = make(map[string]Loader)
+)
+
+// Register 注册一个文档加载器，key 可以是扩展名（如 .pdf）或者 MIME 类型（如 application/pdf），
+// 通常在插件的 init() 中调用。同一个 key 重复注册时后注册的覆盖先注册的
+func Register(loader Loader, keys ...string) {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, key := range keys {
+		registry[normalize(key)] = loader
+	}
+}
+
+// Get 根据扩展名或者 MIME 类型获取文档加载器
+func Get(key string) (Loader, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	loader, ok := registry[normalize(key)]
+	return loader, ok
+}
+
+// Lookup 先按文件扩展名查找，找不到再按 MIME 类型查找
+func Lookup(filename, contentType string) (Loader, bool) {
+	if loader, ok := Get(filepath.Ext(filename)); ok {
+		return loader, true
+	}
+	if contentType == "" {
+		return nil, false
+	}
+	return Get(contentType)
+}
+
+// Keys 返回所有已注册的扩展名和 MIME 类型
+func Keys() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	keys := make([]string, 0, len(registry))
+	for key := range registry {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func normalize(key string) string {
+	key = strings.ToLower(strings.TrimSpace(key))
+	// MIME 类型可能带有 charset 等参数
+	if i := strings.Index(key, ";"); i >= 0 {
+		key = strings.TrimSpace(key[:i])
+	}
+	if key != "" && !strings.Contains(key, "/") && !strings.HasPrefix(key, ".") {
+		key = "." + key
+	}
+	return key
+}
@@ -0,0 +1,108 @@
+package loader
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/tmc/langchaingo/schema"
+)
+
+type csvLoader struct{}
+
+func (csvLoader) Load(ctx context.Context, file string, opts Options) ([]schema.Document, error) {
+	return nil, nil
+}
+
+// countProgress 统计收到的进度通知
+type countProgress struct {
+	noopProgress
+	pages, extracted int
+}
+
+func (receiver *countProgress) PagesFound(n int) {
+	receiver.pages += n
+}
+
+func (receiver *countProgress) PageExtracted() {
+	receiver.extracted++
+}
+
+func TestRegistry(t *testing.T) {
+	var l csvLoader
+	Register(l, "CSV", " text/csv ")
+	t.Cleanup(func() {
+		mu.Lock()
+		defer mu.Unlock()
+		delete(registry, ".csv")
+		delete(registry, "text/csv")
+	})
+
+	for _, key := range []string{".csv", "csv", ".CSV", "text/csv", "text/csv; charset=utf-8"} {
+		if got, ok := Get(key); !ok || got != l {
+			t.Errorf("Get(%q) = %v, %v", key, got, ok)
+		}
+	}
+
+	tests := []struct {
+		filename    string
+		contentType string
+		want        Loader
+	}{
+		{"报表.CSV", "", l},
+		// 扩展名优先于 MIME 类型
+		{"制度.txt", "text/csv", &TextLoader{}},
+		// 没有扩展名或者扩展名未注册时按 MIME 类型查找
+		{"报表", "text/csv; charset=utf-8", l},
+		{"报表.xyz", "text/plain; charset=utf-8", &TextLoader{}},
+		{"报表.xyz", "", nil},
+		{"报表.xyz", "application/octet-stream", nil},
+	}
+	for _, tt := range tests {
+		got, ok := Lookup(tt.filename, tt.contentType)
+		if ok != (tt.want != nil) || reflect.TypeOf(got) != reflect.TypeOf(tt.want) {
+			t.Errorf("Lookup(%q, %q) = %T, %v", tt.filename, tt.contentType, got, ok)
+		}
+	}
+
+	keys := Keys()
+	for _, key := range []string{".csv", ".docx", ".md", ".pdf", ".txt", "application/pdf", "text/csv"} {
+		found := false
+		for _, item := range keys {
+			found = found || item == key
+		}
+		if !found {
+			t.Errorf("Keys() = %v, missing %s", keys, key)
+		}
+	}
+}
+
+func TestTextLoader(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "制度.md")
+	content := "# 差旅\n\n出差住宿费一类城市每天不超过五百元。"
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	progress := &countProgress{}
+	docs, err := (&TextLoader{}).Load(context.Background(), file, Options{Progress: progress})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []schema.Document{{
+		PageContent: content,
+		Metadata:    map[string]any{"page": 0, "total_pages": 1, "type": "text"},
+	}}
+	if !reflect.DeepEqual(docs, want) {
+		t.Fatalf("docs = %+v", docs)
+	}
+	if progress.pages != 1 || progress.extracted != 1 {
+		t.Fatalf("progress = %+v", progress)
+	}
+
+	if _, err = (&TextLoader{}).Load(context.Background(), file+".missing", Options{}); err == nil {
+		t.Fatal("loading a missing file should fail")
+	}
+}
@@ -0,0 +1,175 @@
+package loader
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/klippa-app/go-pdfium"
+	"github.com/klippa-app/go-pdfium/requests"
+	"github.com/klippa-app/go-pdfium/webassembly"
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	pdfmodel "github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	concpool "github.com/sourcegraph/conc/pool"
+	"github.com/spf13/cast"
+	"github.com/tmc/langchaingo/schema"
+	"github.com/unionj-cloud/toolkit/stringutils"
+)
+
+var pool pdfium.Pool
+var instance pdfium.Pdfium
+
+func init() {
+	var err error
+
+	// Init the PDFium library and return the instance to open documents.
+	// You can tweak these configs to your need. Be aware that workers can use quite some memory.
+	pool, err = webassembly.Init(webassembly.Config{
+		MinIdle:  1, // Makes sure that at least x workers are always available
+		MaxIdle:  1, // Makes sure that at most x workers are ever available
+		MaxTotal: 1, // Maxium amount of workers in total, allows the amount of workers to grow when needed, items between total max and idle max are automatically cleaned up, while idle workers are kept alive so they can be used directly.
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	instance, err = pool.GetInstance(time.Second * 30)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	Register(&PdfLoader{}, ".pdf", "application/pdf")
+}
+
+var _ Loader = (*PdfLoader)(nil)
+
+// PdfLoader 使用 pdfium 按页抽取文本，使用 pdfcpu 抽取每页的图片
+type PdfLoader struct {
+}
+
+func (receiver *PdfLoader) Load(ctx context.Context, file string, opts Options) ([]schema.Document, error) {
+	fileBytes, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := instance.FPDF_LoadDocument(&requests.FPDF_LoadDocument{
+		Path: &file,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Always close the document, this will release its resources.
+	defer instance.FPDF_CloseDocument(&requests.FPDF_CloseDocument{
+		Document: doc.Document,
+	})
+
+	pageCount, err := instance.FPDF_GetPageCount(&requests.FPDF_GetPageCount{
+		Document: doc.Document,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	progress := opts.progress()
+	progress.PagesFound(pageCount.PageCount)
+
+	fileName := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+
+	g := concpool.NewWithResults[[]schema.Document]().WithContext(ctx).WithCancelOnError()
+
+	for i := 0; i < pageCount.PageCount; i++ {
+		g.Go(func(ctx context.Context) ([]schema.Document, error) {
+
+			var docs []schema.Document
+
+			// 获取页面文本
+			pageText, err := instance.GetPageText(&requests.GetPageText{
+				Page: requests.Page{
+					ByIndex: &requests.PageByIndex{
+						Document: doc.Document,
+						Index:    i,
+					},
+				},
+			})
+			if err != nil {
+				return nil, err
+			}
+			progress.PageExtracted()
+
+			docs = append(docs, schema.Document{
+				PageContent: pageText.Text,
+				Metadata: map[string]any{
+					"page":        i,
+					"total_pages": pageCount.PageCount,
+					"type":        "text",
+				},
+			})
+
+			if opts.ImageAnalyzer == nil {
+				return docs, nil
+			}
+
+			var imageOutFile string
+			if err = api.ExtractImages(bytes.NewReader(fileBytes), []string{cast.ToString(i)}, func(img pdfmodel.Image, singleImgPerPage bool, maxPageDigits int) error {
+				if img.Reader == nil {
+					return nil
+				}
+				s := "%s_%" + fmt.Sprintf("0%dd", maxPageDigits)
+				qual := img.Name
+				if img.Thumb {
+					qual = "thumb"
+				}
+				f := fmt.Sprintf(s+"_%s.%s", fileName, img.PageNr, qual, img.FileType)
+				imageOutFile = filepath.Join(opts.ImageSavePath, f)
+				if err := pdfcpu.WriteReader(imageOutFile, img); err != nil {
+					return err
+				}
+				progress.ImageExtracted(imageOutFile)
+				return nil
+			}, nil); err != nil {
+				return nil, err
+			}
+
+			if stringutils.IsNotEmpty(imageOutFile) {
+				progress.ImagesFound(1)
+				imageDescription := opts.ImageAnalyzer(ctx, imageOutFile)
+				progress.ImageAnalysed()
+
+				if stringutils.IsNotEmpty(imageDescription) {
+					docs = append(docs, schema.Document{
+						PageContent: imageDescription,
+						Metadata: map[string]any{
+							"page":        i,
+							"total_pages": pageCount.PageCount,
+							"image":       imageOutFile,
+							"type":        "image",
+						},
+					})
+				}
+			}
+
+			return docs, nil
+		})
+
+	}
+
+	groups, err := g.Wait()
+	if err != nil {
+		return nil, err
+	}
+
+	var docs []schema.Document
+	for _, items := range groups {
+		docs = append(docs, items...)
+	}
+
+	return docs, nil
+}
@@ -0,0 +1,40 @@
+package loader
+
+import (
+	"context"
+	"os"
+
+	"github.com/tmc/langchaingo/schema"
+)
+
+func init() {
+	Register(&TextLoader{}, ".txt", ".md", "text/plain", "text/markdown")
+}
+
+var _ Loader = (*TextLoader)(nil)
+
+// TextLoader 加载纯文本和 markdown 文件，全部内容视为第 0 页
+type TextLoader struct {
+}
+
+func (receiver *TextLoader) Load(ctx context.Context, file string, opts Options) ([]schema.Document, error) {
+	progress := opts.progress()
+	progress.PagesFound(1)
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	progress.PageExtracted()
+
+	return []schema.Document{
+		{
+			PageContent: string(content),
+			Metadata: map[string]any{
+				"page":        0,
+				"total_pages": 1,
+				"type":        "text",
+			},
+		},
+	}, nil
+}
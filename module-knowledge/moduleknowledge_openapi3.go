@@ -1,3 +1,3 @@
 package service
 
-var Oas = `{"openapi":"3.0.2","info":{"title":"ModuleKnowledge","version":"v20250513"},"servers":[{"url":"http://localhost:6060"}],"paths":{"/list":{"get":{"parameters":[{"name":"req","in":"query","required":true,"schema":{"$ref":"#/components/schemas/GetListReq"}}],"responses":{"200":{"description":"","content":{"application/json":{"schema":{"$ref":"#/components/schemas/GetListResp"}}}}}}},"/query":{"get":{"parameters":[{"name":"req","in":"query","required":true,"schema":{"$ref":"#/components/schemas/QueryReq"}}],"responses":{"200":{"description":"","content":{"application/json":{"schema":{"$ref":"#/components/schemas/GetQueryResp"}}}}}}},"/upload":{"post":{"requestBody":{"content":{"multipart/form-data":{"schema":{"$ref":"#/components/schemas/UploadReq"}}},"required":true},"responses":{"200":{"description":"","content":{"application/json":{"schema":{"$ref":"#/components/schemas/UploadResp"}}}}}}}},"components":{"schemas":{"FileDTO":{"title":"FileDTO","type":"object","properties":{"content":{"type":"string"},"id":{"type":"integer","format":"int32"},"path":{"type":"string"}},"required":["id","path","content"]},"GddUser":{"title":"GddUser","type":"object","properties":{"dept":{"type":"string"},"id":{"type":"integer","format":"int64"},"name":{"type":"string"},"phone":{"type":"string"}},"required":["id","name","phone","dept"]},"GetListReq":{"title":"GetListReq","type":"object","properties":{"file_id":{"type":"string","description":"多个值用英文逗号拼接"},"with_content":{"type":"boolean"}},"description":"\n","required":["file_id","with_content"]},"GetListResp":{"title":"GetListResp","type":"object","properties":{"data":{"type":"array","items":{"$ref":"#/components/schemas/FileDTO"}}},"required":["data"]},"GetQueryResp":{"title":"GetQueryResp","type":"object","properties":{"data":{"type":"array","items":{"$ref":"#/components/schemas/QueryResult"}}},"required":["data"]},"Page":{"title":"Page","type":"object","properties":{"first":{"type":"boolean"},"items":{"type":"array","items":{"type":"object"}},"last":{"type":"boolean"},"max_page":{"type":"integer","format":"int64"},"page":{"type":"integer","format":"int64"},"size":{"type":"integer","format":"int64"},"total":{"type":"integer","format":"int64"},"total_pages":{"type":"integer","format":"int64"},"visible":{"type":"integer","format":"int64"}},"description":"Page result wrapper","required":["items","page","size","max_page","total_pages","total","last","first","visible"]},"Parameter":{"title":"Parameter","type":"object","properties":{"fields":{"type":"string"},"filters":{"type":"string"},"order":{"type":"string"},"page":{"type":"integer","format":"int64"},"size":{"type":"integer","format":"int64"},"sort":{"type":"string"}},"description":"Parameter struct","required":["page","size","sort","order","fields","filters"]},"QueryReq":{"title":"QueryReq","type":"object","properties":{"text":{"type":"string"},"top":{"type":"integer","format":"int32"}},"description":"\n","required":["text","top"]},"QueryResult":{"title":"QueryResult","type":"object","properties":{"content":{"type":"string"},"id":{"type":"string"},"similarity":{"type":"string"}},"required":["id","similarity","content"]},"UploadReq":{"title":"UploadReq","type":"object","properties":{"file":{"type":"string","format":"binary"}},"required":["file"]},"UploadResp":{"title":"UploadResp","type":"object","properties":{"data":{"$ref":"#/components/schemas/UploadResult"}},"required":["data"]},"UploadResult":{"title":"UploadResult","type":"object","properties":{"id":{"type":"integer","format":"int32"}},"description":"\n","required":["id"]}}}}`
+var Oas = `{"openapi":"3.0.2","info":{"title":"ModuleKnowledge","version":"v20250513"},"servers":[{"url":"http://localhost:6060"}],"paths":{"/embedding/cache":{"get":{"description":"GetEmbeddingCache 按向量化模型返回向量缓存的条数和命中率","responses":{"200":{"description":"","content":{"application/json":{"schema":{"$ref":"#/components/schemas/GetEmbeddingCacheResp"}}}}}}},"/file":{"delete":{"description":"DeleteFile 删除文件的全部向量、原文件和抽取出的图片，并软删除文件记录。\n删除当前版本时连同全部历史版本一起删除，删除历史版本时只删除该版本","parameters":[{"name":"id","in":"query","required":true,"schema":{"type":"integer","format":"int32"}}],"responses":{"200":{"description":"","content":{"application/json":{"schema":{"$ref":"#/components/schemas/DeleteFileResp"}}}}}}},"/jobs":{"get":{"parameters":[{"name":"req","in":"query","required":true,"schema":{"$ref":"#/components/schemas/GetJobsReq"}}],"responses":{"200":{"description":"","content":{"application/json":{"schema":{"$ref":"#/components/schemas/GetJobsResp"}}}}}}},"/jobs/{id}":{"get":{"parameters":[{"name":"id","in":"path","required":true,"schema":{"type":"integer","format":"int32"}}],"responses":{"200":{"description":"","content":{"application/json":{"schema":{"$ref":"#/components/schemas/GetJobs_IdResp"}}}}}}},"/kb":{"post":{"description":"PostKb 新建知识库，向量化模型和分割配置为空时使用配置文件中的默认值","requestBody":{"content":{"application/json":{"schema":{"$ref":"#/components/schemas/SaveKbReq"}}},"required":true},"responses":{"200":{"description":"","content":{"application/json":{"schema":{"$ref":"#/components/schemas/PostKbResp"}}}}}},"get":{"responses":{"200":{"description":"","content":{"application/json":{"schema":{"$ref":"#/components/schemas/GetKbResp"}}}}}}},"/kb/{id}":{"get":{"parameters":[{"name":"id","in":"path","required":true,"schema":{"type":"integer","format":"int32"}}],"responses":{"200":{"description":"","content":{"application/json":{"schema":{"$ref":"#/components/schemas/GetKb_IdResp"}}}}}},"put":{"description":"PutKb_Id 修改知识库名称、描述、向量化模型和默认分割配置。\n知识库中已有文件时修改向量化模型后仍然使用原来的模型检索，需要调用 PostKb_IdReembed 重新向量化","parameters":[{"name":"id","in":"path","required":true,"schema":{"type":"integer","format":"int32"}}],"requestBody":{"content":{"application/json":{"schema":{"$ref":"#/components/schemas/SaveKbReq"}}},"required":true},"responses":{"200":{"description":"","content":{"application/json":{"schema":{"$ref":"#/components/schemas/PutKb_IdResp"}}}}}},"delete":{"description":"DeleteKb_Id 删除知识库及其中的全部文件和向量，默认知识库不能删除","parameters":[{"name":"id","in":"path","required":true,"schema":{"type":"integer","format":"int32"}}],"responses":{"200":{"description":"","content":{"application/json":{"schema":{"$ref":"#/components/schemas/DeleteKb_IdResp"}}}}}}},"/kb/{id}/reembed":{"post":{"description":"PostKb_IdReembed @role(admin) 使用配置的向量化模型重新向量化知识库，完成后替换原来的集合，期间检索不受影响。\n返回的任务可以通过 /jobs/{id} 查询进度","parameters":[{"name":"id","in":"path","required":true,"schema":{"type":"integer","format":"int32"}}],"responses":{"200":{"description":"","content":{"application/json":{"schema":{"$ref":"#/components/schemas/PostKb_IdReembedResp"}}}}}}},"/list":{"get":{"parameters":[{"name":"req","in":"query","required":true,"schema":{"$ref":"#/components/schemas/GetListReq"}}],"responses":{"200":{"description":"","content":{"application/json":{"schema":{"$ref":"#/components/schemas/GetListResp"}}}}}}},"/query":{"get":{"parameters":[{"name":"req","in":"query","required":true,"schema":{"$ref":"#/components/schemas/QueryReq"}}],"responses":{"200":{"description":"","content":{"application/json":{"schema":{"$ref":"#/components/schemas/GetQueryResp"}}}}}}},"/upload":{"post":{"description":"Upload 按内容哈希去重，同名但内容不同的文件作为新版本入库，入库成功后替换旧版本。\nkbId 为目标知识库，为空时上传到默认知识库。\nchunkStrategy 为分割策略：recursive, token, chinese, markdown, policy，为空时使用知识库的默认策略。\ntags 为英文逗号拼接的标签，用于检索时筛选文件，为空时沿用上一个版本的标签","requestBody":{"content":{"multipart/form-data":{"schema":{"$ref":"#/components/schemas/UploadReq"}}},"required":true},"responses":{"200":{"description":"","content":{"application/json":{"schema":{"$ref":"#/components/schemas/UploadResp"}}}}}}}},"components":{"schemas":{"DeleteFileResp":{"title":"DeleteFileResp","type":"object"},"DeleteKb_IdResp":{"title":"DeleteKb_IdResp","type":"object"},"EmbeddingCacheStats":{"title":"EmbeddingCacheStats","type":"object","properties":{"entries":{"type":"integer","format":"int64","description":"缓存的向量条数"},"hit_rate":{"type":"number","format":"double"},"hits":{"type":"integer","format":"int64"},"misses":{"type":"integer","format":"int64"},"model":{"type":"string"}},"description":"EmbeddingCacheStats 向量缓存统计，命中和未命中次数从服务启动时开始累计","required":["model","entries","hits","misses","hit_rate"]},"FileDTO":{"title":"FileDTO","type":"object","properties":{"chunk_strategy":{"type":"string","description":"为空时使用配置中的默认分割策略"},"content":{"type":"string"},"created_at":{"type":"string"},"current":{"type":"boolean","description":"是否为当前参与检索的版本"},"hash":{"type":"string","description":"文件内容的 sha256"},"id":{"type":"integer","format":"int32"},"kb_id":{"type":"integer","format":"int32"},"name":{"type":"string"},"path":{"type":"string"},"tags":{"type":"array","items":{"type":"string"}},"version":{"type":"integer","format":"int32"},"versions":{"type":"array","items":{"$ref":"#/components/schemas/FileVersionDTO"},"description":"同名文件的全部版本，按版本号倒序"}},"required":["id","kb_id","name","path","hash","version","current","chunk_strategy","tags","created_at","content","versions"]},"FileVersionDTO":{"title":"FileVersionDTO","type":"object","properties":{"created_at":{"type":"string"},"current":{"type":"boolean"},"hash":{"type":"string"},"id":{"type":"integer","format":"int32"},"version":{"type":"integer","format":"int32"}},"required":["id","hash","version","current","created_at"]},"GddUser":{"title":"GddUser","type":"object","properties":{"dept":{"type":"string"},"id":{"type":"integer","format":"int64"},"name":{"type":"string"},"phone":{"type":"string"}},"required":["id","name","phone","dept"]},"GetEmbeddingCacheResp":{"title":"GetEmbeddingCacheResp","type":"object","properties":{"data":{"type":"array","items":{"$ref":"#/components/schemas/EmbeddingCacheStats"}}},"required":["data"]},"GetJobsReq":{"title":"GetJobsReq","type":"object","properties":{"file_id":{"type":"integer","format":"int32"},"kb_id":{"type":"integer","format":"int32"},"kind":{"type":"string","description":"ingest 或 reembed，为空时不限"},"limit":{"type":"integer","format":"int32"},"status":{"type":"string","description":"多个值用英文逗号拼接"}},"required":["kind","kb_id","file_id","status","limit"]},"GetJobsResp":{"title":"GetJobsResp","type":"object","properties":{"data":{"type":"array","items":{"$ref":"#/components/schemas/JobDTO"}}},"required":["data"]},"GetJobs_IdResp":{"title":"GetJobs_IdResp","type":"object","properties":{"data":{"$ref":"#/components/schemas/JobDTO"}},"required":["data"]},"GetKbResp":{"title":"GetKbResp","type":"object","properties":{"data":{"type":"array","items":{"$ref":"#/components/schemas/KbDTO"}}},"required":["data"]},"GetKb_IdResp":{"title":"GetKb_IdResp","type":"object","properties":{"data":{"$ref":"#/components/schemas/KbDTO"}},"required":["data"]},"GetListReq":{"title":"GetListReq","type":"object","properties":{"file_id":{"type":"string","description":"多个值用英文逗号拼接，为空时返回每个文件的当前版本"},"kb_id":{"type":"integer","format":"int32","description":"为 0 时使用默认知识库，指定了 FileId 时忽略"},"with_content":{"type":"boolean"}},"description":"\n","required":["kb_id","file_id","with_content"]},"GetListResp":{"title":"GetListResp","type":"object","properties":{"data":{"type":"array","items":{"$ref":"#/components/schemas/FileDTO"}}},"required":["data"]},"GetQueryResp":{"title":"GetQueryResp","type":"object","properties":{"data":{"type":"array","items":{"$ref":"#/components/schemas/QueryResult"}}},"required":["data"]},"JobDTO":{"title":"JobDTO","type":"object","properties":{"chunks_embedded":{"type":"integer","format":"int32"},"chunks_total":{"type":"integer","format":"int32"},"created_at":{"type":"string"},"error":{"type":"string"},"file_id":{"type":"integer","format":"int32","description":"仅 ingest 任务有值"},"finished_at":{"type":"string"},"id":{"type":"integer","format":"int32"},"images_analysed":{"type":"integer","format":"int32"},"images_total":{"type":"integer","format":"int32"},"kb_id":{"type":"integer","format":"int32","description":"仅 reembed 任务有值"},"kind":{"type":"string","description":"ingest 或 reembed"},"pages_extracted":{"type":"integer","format":"int32"},"pages_total":{"type":"integer","format":"int32"},"stage":{"type":"string","description":"extracting, splitting, embedding, persisting, done"},"started_at":{"type":"string"},"status":{"type":"string","description":"queued, running, succeeded, failed"}},"required":["id","kind","file_id","kb_id","status","stage","pages_total","pages_extracted","images_total","images_analysed","chunks_total","chunks_embedded","error","created_at","started_at","finished_at"]},"KbDTO":{"title":"KbDTO","type":"object","properties":{"chunk_overlap":{"type":"integer","format":"int32"},"chunk_size":{"type":"integer","format":"int32"},"chunk_strategy":{"type":"string"},"created_at":{"type":"string"},"description":{"type":"string"},"dimension":{"type":"integer","format":"int32"},"embedding_model":{"type":"string","description":"以下配置为空时使用 moduleknowledge 配置中的默认值"},"id":{"type":"integer","format":"int32"},"indexed_model":{"type":"string","description":"集合中已有向量实际使用的向量化模型和维度，还没有向量时为空"},"is_default":{"type":"boolean"},"name":{"type":"string"},"prompt_template":{"type":"string","description":"回答和解析图片使用的提示词模板名称，为空时使用 default 模板"},"stale":{"type":"boolean","description":"已有向量的模型与配置的模型不一致，需要通过 /kb/{id}/reembed 重新向量化，完成之前检索仍使用原来的模型"}},"required":["id","name","description","is_default","embedding_model","chunk_strategy","chunk_size","chunk_overlap","prompt_template","indexed_model","dimension","stale","created_at"]},"Page":{"title":"Page","type":"object","properties":{"first":{"type":"boolean"},"items":{"type":"array","items":{"type":"object"}},"last":{"type":"boolean"},"max_page":{"type":"integer","format":"int64"},"page":{"type":"integer","format":"int64"},"size":{"type":"integer","format":"int64"},"total":{"type":"integer","format":"int64"},"total_pages":{"type":"integer","format":"int64"},"visible":{"type":"integer","format":"int64"}},"description":"Page result wrapper","required":["items","page","size","max_page","total_pages","total","last","first","visible"]},"Parameter":{"title":"Parameter","type":"object","properties":{"fields":{"type":"string"},"filters":{"type":"string"},"order":{"type":"string"},"page":{"type":"integer","format":"int64"},"size":{"type":"integer","format":"int64"},"sort":{"type":"string"}},"description":"Parameter struct","required":["page","size","sort","order","fields","filters"]},"PostKbResp":{"title":"PostKbResp","type":"object","properties":{"data":{"$ref":"#/components/schemas/KbDTO"}},"required":["data"]},"PostKb_IdReembedResp":{"title":"PostKb_IdReembedResp","type":"object","properties":{"data":{"$ref":"#/components/schemas/JobDTO"}},"required":["data"]},"PutKb_IdResp":{"title":"PutKb_IdResp","type":"object","properties":{"data":{"$ref":"#/components/schemas/KbDTO"}},"required":["data"]},"QueryFilter":{"title":"QueryFilter","type":"object","properties":{"contains":{"type":"string","description":"分块内容需要包含的文本"},"file_ids":{"type":"array","items":{"type":"integer","format":"int32"},"description":"文件ID，传入历史版本的ID时检索该文件的当前版本"},"metadata":{"type":"object","additionalProperties":{"type":"string"},"description":"分块元数据等值过滤，例如 chunk_strategy"},"metadata_contains":{"type":"object","additionalProperties":{"type":"string"},"description":"分块元数据的值需要包含的文本，例如 file_name 包含“差旅”"},"not_contains":{"type":"string","description":"分块内容不能包含的文本"},"page_from":{"type":"integer","format":"int32","description":"页码范围，从 0 开始，包含两端"},"page_to":{"type":"integer","format":"int32"},"tags":{"type":"array","items":{"type":"string"},"description":"文件需要带有全部标签"},"type":{"type":"string","description":"text 或 image"},"uploaded_from":{"type":"string","description":"上传时间范围，格式为 2006-01-02 或者 2006-01-02 15:04:05，包含两端"},"uploaded_to":{"type":"string"}},"description":"QueryFilter 检索范围，各条件之间是且的关系","required":["file_ids","type","tags","uploaded_from","uploaded_to","metadata","metadata_contains","contains","not_contains"]},"QueryReq":{"title":"QueryReq","type":"object","properties":{"filter":{"$ref":"#/components/schemas/QueryFilter","description":"为空时检索全部文件"},"kb_ids":{"type":"array","items":{"type":"integer","format":"int32"},"description":"在多个知识库中检索时合并各知识库的结果，为空时检索 Filter.FileIds 所在的知识库，都为空时检索默认知识库"},"keyword_weight":{"type":"number","format":"float","description":"hybrid 模式下关键词检索在倒数排名融合中的权重，取值 0 到 1，为 0 时使用配置中的默认值"},"mode":{"type":"string","description":"vector, keyword, hybrid，为空时使用配置中的默认模式"},"rerank":{"$ref":"#/components/schemas/Rerank","description":"为空时不重排"},"retrieve_limit":{"type":"integer","format":"int32"},"similarity_threshold":{"type":"number","format":"float","description":"只作用于向量检索的结果"},"text":{"type":"string"}},"description":"\n","required":["kb_ids","text","retrieve_limit","similarity_threshold","mode","keyword_weight"]},"QueryResult":{"title":"QueryResult","type":"object","properties":{"chunk_index":{"type":"integer","format":"int32","description":"分块在文件中的序号，从 0 开始，相邻的分块序号连续。记录序号之前入库的分块为 -1"},"content":{"type":"string"},"file_id":{"type":"integer","format":"int32"},"file_name":{"type":"string"},"id":{"type":"string"},"image":{"type":"string","description":"抽取出的图片路径，仅 type 为 image 时有值"},"kb_id":{"type":"integer","format":"int32"},"page":{"type":"integer","format":"int32","description":"从 0 开始"},"rerank_score":{"type":"number","format":"float","description":"重排得分，重排后结果按该得分排序，未重排时为 0"},"score":{"type":"number","format":"float","description":"检索得分：vector 模式为向量相似度，keyword 模式为 BM25 得分，hybrid 模式为融合得分"},"similarity":{"type":"number","format":"float","description":"向量相似度，只由关键词检索命中时为 0"},"total_pages":{"type":"integer","format":"int32"},"type":{"type":"string","description":"text 或 image"}},"required":["id","kb_id","similarity","score","rerank_score","content","file_id","file_name","page","total_pages","type","image","chunk_index"]},"Rerank":{"title":"Rerank","type":"object","properties":{"lambda":{"type":"number","format":"float","description":"mmr 中相关性的权重，取值 0 到 1，越小结果越多样，为 0 时取 0.5"},"strategy":{"type":"string","description":"mmr 或 cross_encoder"},"top_n":{"type":"integer","format":"int32","description":"重排后保留的结果数量，为 0 时保留全部"}},"required":["strategy","lambda","top_n"]},"SaveKbReq":{"title":"SaveKbReq","type":"object","properties":{"chunk_overlap":{"type":"integer","format":"int32"},"chunk_size":{"type":"integer","format":"int32"},"chunk_strategy":{"type":"string","description":"修改分割配置只影响之后入库的文件"},"description":{"type":"string"},"embedding_model":{"type":"string","description":"知识库中已有文件时修改后需要重新向量化"},"name":{"type":"string"},"prompt_template":{"type":"string","description":"提示词模板名称，模板在 modulechat 的 /prompt 接口中维护，保存时模板必须已经存在，为空时使用 default 模板"}},"required":["name","description","embedding_model","chunk_strategy","chunk_size","chunk_overlap","prompt_template"]},"UploadReq":{"title":"UploadReq","type":"object","properties":{"chunkStrategy":{"type":"string"},"file":{"type":"string","format":"binary"},"kbId":{"type":"integer","format":"int32"},"tags":{"type":"string"}},"required":["file"]},"UploadResp":{"title":"UploadResp","type":"object","properties":{"data":{"$ref":"#/components/schemas/UploadResult"}},"required":["data"]},"UploadResult":{"title":"UploadResult","type":"object","properties":{"duplicate":{"type":"boolean","description":"内容与已上传的文件完全相同，直接返回已有的记录"},"id":{"type":"integer","format":"int32"},"job_id":{"type":"integer","format":"int32","description":"入库任务ID，通过 /jobs/{id} 查询进度"},"kb_id":{"type":"integer","format":"int32"},"version":{"type":"integer","format":"int32"}},"description":"\n","required":["id","kb_id","job_id","version","duplicate"]}}}}`
@@ -5,6 +5,8 @@
 package plugin
 
 import (
+	"context"
+	"fmt"
 	"github.com/glebarez/sqlite"
 	"github.com/samber/do"
 	"github.com/unionj-cloud/go-doudou/v2/framework/grpcx"
@@ -17,6 +19,8 @@ import (
 	"go-doudou-rag/module-knowledge/internal/dao"
 	"go-doudou-rag/module-knowledge/internal/model"
 	"go-doudou-rag/module-knowledge/transport/httpsrv"
+	"go-doudou-rag/module-knowledge/vectorstore"
+	"go-doudou-rag/toolkit/llm"
 	"google.golang.org/grpc"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
@@ -67,13 +71,33 @@ func init() {
 			panic("failed to connect database")
 		}
 
-		if err = db.AutoMigrate(&model.File{}); err != nil {
+		if err = db.AutoMigrate(&model.File{}, &model.Job{}, &model.Chunk{}, &model.KnowledgeBase{}, &model.EmbeddingCache{}); err != nil {
 			panic(err)
 		}
 
 		dao.Use(db)
+		defaultKb := dao.GetKnowledgeBaseRepo().EnsureDefault(context.Background())
+		dao.GetFileRepo().Backfill(context.Background(), defaultKb.ID)
 
-		svc := service.NewModuleKnowledge(conf)
+		var vectorStore vectorstore.Store
+		switch conf.Biz.VectorStore.Backend {
+		case "chromem":
+			if vectorStore, err = vectorstore.NewChromem(vectorstore.ChromemOptions{
+				File:          conf.Biz.VectorStore.ExportToFile,
+				EncryptionKey: conf.Biz.VectorStore.EncryptionKey,
+				CompactSize:   int64(conf.Biz.VectorStore.CompactSizeMb) << 20,
+			}); err != nil {
+				panic(err)
+			}
+		case "sqlite":
+			if vectorStore, err = vectorstore.NewSQLite(db); err != nil {
+				panic(err)
+			}
+		default:
+			panic(fmt.Sprintf("unsupported vector store backend: %s", conf.Biz.VectorStore.Backend))
+		}
+
+		svc := service.NewModuleKnowledge(conf, vectorStore, do.MustInvoke[llm.Provider](injector))
 		return svc, nil
 	})
 }
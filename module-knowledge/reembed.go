@@ -0,0 +1,245 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/philippgille/chromem-go"
+	"github.com/samber/lo"
+	"github.com/unionj-cloud/toolkit/stringutils"
+	"github.com/unionj-cloud/toolkit/zlogger"
+
+	"go-doudou-rag/module-knowledge/dto"
+	"go-doudou-rag/module-knowledge/internal/dao"
+	"go-doudou-rag/module-knowledge/internal/model"
+	"go-doudou-rag/module-knowledge/vectorstore"
+)
+
+// checkIndex 启动时检查集合中的向量是否由当前配置的模型生成。不一致时继续使用原来的模型检索，等待管理员重新向量化
+func (receiver *ModuleKnowledgeImpl) checkIndex(ctx context.Context, kb *knowledgeBase) {
+	if stringutils.IsNotEmpty(kb.IndexedModel) {
+		if receiver.stale(kb.KnowledgeBase) {
+			zlogger.Warn().Msgf("Knowledge base %s was embedded with %s but is configured to use %s, "+
+				"queries keep using %s until it is re-embedded through POST /kb/%d/reembed",
+				kb.Name, kb.IndexedModel, receiver.embeddingModel(kb.KnowledgeBase), kb.IndexedModel, kb.ID)
+		}
+		return
+	}
+
+	// 记录模型之前写入的向量：维度取自任意一个分块，模型只能认为是当前配置的模型
+	chunk := dao.GetChunkRepo().FirstByKb(ctx, kb.ID)
+	if chunk == nil {
+		return
+	}
+	doc, err := kb.collection.Get(ctx, chunk.ID)
+	if err != nil {
+		panic(err)
+	}
+	if doc == nil {
+		return
+	}
+	receiver.recordIndex(ctx, kb, kb.embeddingModel, len(doc.Embedding))
+}
+
+// recordIndex 记录集合中向量的模型和维度，调用方需要持有 swapMu 写锁或者还在启动阶段
+func (receiver *ModuleKnowledgeImpl) recordIndex(ctx context.Context, kb *knowledgeBase, embeddingModel string, dimension int) {
+	updated := *kb.KnowledgeBase
+	updated.IndexedModel = embeddingModel
+	updated.Dimension = dimension
+	dao.GetKnowledgeBaseRepo().Save(ctx, &updated)
+
+	recorded := *kb
+	recorded.KnowledgeBase = &updated
+	receiver.setBase(&recorded)
+}
+
+func (receiver *ModuleKnowledgeImpl) PostKb_IdReembed(ctx context.Context, id uint) (data dto.JobDTO, err error) {
+	kb := receiver.base(id)
+
+	unfinished := dao.GetJobRepo().List(ctx, dao.ListJobReq{
+		Kind:   model.JobKindReembed,
+		KbId:   kb.ID,
+		Status: []string{model.JobStatusQueued, model.JobStatusRunning},
+	})
+	if len(unfinished) > 0 {
+		panic(fmt.Sprintf("knowledge base is being re-embedded by job %d", unfinished[0].ID))
+	}
+
+	jobId := receiver.enqueue(ctx, &model.Job{
+		Kind: model.JobKindReembed,
+		KbID: kb.ID,
+	})
+
+	return newJobDTO(dao.GetJobRepo().Get(ctx, jobId)), nil
+}
+
+// 替换集合前不加锁同步的最大次数，之后在写锁内完成同步
+const maxReembedSyncs = 3
+
+// reembed 使用配置的模型把知识库的全部分块重新向量化到一个新的集合，完成后替换原来的集合。
+// 重建期间检索和入库都继续使用原来的集合，替换前把重建期间入库或者删除的文件同步到新集合
+func (receiver *ModuleKnowledgeImpl) reembed(ctx context.Context, kb *knowledgeBase, progress *jobProgress) {
+	embeddingModel := receiver.embeddingModel(kb.KnowledgeBase)
+	name := fmt.Sprintf("kb-%d-%d", kb.ID, time.Now().Unix())
+	collection, err := receiver.vectorStore.Collection(name)
+	if err != nil {
+		panic(err)
+	}
+	queryFunc := receiver.newEmbeddingFunc(embeddingModel)
+	rb := &rebuild{
+		collection:    collection,
+		embeddingFunc: receiver.cached(embeddingModel, queryFunc),
+		files:         make(map[string][]string),
+	}
+
+	swapped := false
+	defer func() {
+		if !swapped {
+			if err := receiver.vectorStore.DeleteCollection(name); err != nil {
+				zlogger.Error().Msgf("Delete collection %s failed: %v", name, err)
+			}
+		}
+	}()
+
+	progress.stage(model.JobStageEmbedding)
+	chunks := dao.GetChunkRepo().ListByKb(ctx, kb.ID)
+	progress.ChunksFound(len(chunks))
+	rb.add(ctx, chunks, progress.ChunksEmbedded)
+
+	// 不加锁把重建期间入库或者删除的文件同步到新集合，再加锁对比分块ID，没有变化时替换集合，仍有变化时解锁继续同步。
+	// 持有写锁期间一般不请求向量化模型，持续入库导致 maxReembedSyncs 次对比都有变化时在写锁内完成最后一次同步
+	progress.stage(model.JobStagePersisting)
+	trySwap := func(last bool) bool {
+		receiver.swapMu.Lock()
+		defer receiver.swapMu.Unlock()
+		if rb.changed(ctx, kb.ID) {
+			if !last {
+				return false
+			}
+			rb.sync(ctx, kb.ID)
+		}
+
+		current := receiver.base(kb.ID)
+
+		updated := *current.KnowledgeBase
+		updated.Collection = name
+		updated.IndexedModel = lo.Ternary(rb.dimension > 0, embeddingModel, "")
+		updated.Dimension = rb.dimension
+		dao.GetKnowledgeBaseRepo().Save(ctx, &updated)
+
+		receiver.setBase(&knowledgeBase{
+			KnowledgeBase:  &updated,
+			collection:     collection,
+			embeddingModel: embeddingModel,
+			embeddingFunc:  rb.embeddingFunc,
+			queryFunc:      queryFunc,
+			keywords:       current.keywords,
+		})
+		swapped = true
+
+		if err := receiver.vectorStore.DeleteCollection(current.Collection); err != nil {
+			zlogger.Error().Msgf("Delete collection %s failed: %v", current.Collection, err)
+		}
+		receiver.persist()
+		return true
+	}
+	for i := 1; ; i++ {
+		rb.sync(ctx, kb.ID)
+		if trySwap(i == maxReembedSyncs) {
+			break
+		}
+	}
+
+	// 引入关键词检索之前入库的文件没有保存分块原文，只能从原文件重新入库
+	for _, item := range dao.GetFileRepo().FindCurrent(ctx, dao.FindCurrentReq{KbId: kb.ID}) {
+		if _, ok := rb.files[item.Path]; ok {
+			continue
+		}
+		zlogger.Info().Msgf("Re-ingest file %s from the original file", item.Path)
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					zlogger.Error().Msgf("Re-ingest file %s failed: %v", item.Path, r)
+				}
+			}()
+			receiver.submitJob(ctx, item.ID)
+		}()
+	}
+}
+
+// rebuild 重新向量化过程中新集合的状态
+type rebuild struct {
+	collection    vectorstore.Collection
+	embeddingFunc chromem.EmbeddingFunc
+	// 文件路径 -> 新集合中该文件的分块ID
+	files     map[string][]string
+	dimension int
+}
+
+// add 向量化分块并写入新集合
+func (receiver *rebuild) add(ctx context.Context, chunks []*model.Chunk, done func(n int)) {
+	for start := 0; start < len(chunks); start += embeddingBatchSize {
+		end := min(start+embeddingBatchSize, len(chunks))
+		documents := lo.Map(chunks[start:end], func(item *model.Chunk, index int) vectorstore.Document {
+			return vectorstore.Document{
+				ID:       item.ID,
+				Content:  item.Content,
+				Metadata: item.Metadata,
+			}
+		})
+		embed(ctx, receiver.embeddingFunc, documents, done)
+		if err := receiver.collection.Add(ctx, documents); err != nil {
+			panic(err)
+		}
+		for _, item := range chunks[start:end] {
+			receiver.files[item.File] = append(receiver.files[item.File], item.ID)
+		}
+		receiver.dimension = len(documents[0].Embedding)
+	}
+}
+
+// diff 对比数据库中的分块ID，返回新集合中分块有变化或者已经不存在的文件，以及需要写入新集合的文件的分块
+func (receiver *rebuild) diff(ctx context.Context, kbId uint) (stale []string, missing map[string][]*model.Chunk) {
+	current := lo.GroupBy(dao.GetChunkRepo().ListByKb(ctx, kbId), func(item *model.Chunk) string {
+		return item.File
+	})
+
+	missing = make(map[string][]*model.Chunk)
+	for file, ids := range receiver.files {
+		if chunks, ok := current[file]; ok && len(chunks) == len(ids) && lo.Every(ids, lo.Map(chunks, func(item *model.Chunk, index int) string {
+			return item.ID
+		})) {
+			continue
+		}
+		stale = append(stale, file)
+	}
+	for file, chunks := range current {
+		if _, ok := receiver.files[file]; !ok || lo.Contains(stale, file) {
+			missing[file] = chunks
+		}
+	}
+	return stale, missing
+}
+
+// changed 新集合与数据库中的分块是否不一致，只对比分块ID，不请求向量化模型
+func (receiver *rebuild) changed(ctx context.Context, kbId uint) bool {
+	stale, missing := receiver.diff(ctx, kbId)
+	return len(stale) > 0 || len(missing) > 0
+}
+
+// sync 重新写入分块有变化的文件，删除已经不存在的文件
+func (receiver *rebuild) sync(ctx context.Context, kbId uint) {
+	stale, missing := receiver.diff(ctx, kbId)
+	for _, file := range stale {
+		if err := receiver.collection.Delete(ctx, map[string]string{
+			"file": file,
+		}); err != nil {
+			panic(err)
+		}
+		delete(receiver.files, file)
+	}
+	for _, chunks := range missing {
+		receiver.add(ctx, chunks, func(int) {})
+	}
+}
@@ -0,0 +1,202 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/philippgille/chromem-go"
+	v3 "github.com/unionj-cloud/toolkit/openapi/v3"
+
+	"go-doudou-rag/module-knowledge/dto"
+	"go-doudou-rag/module-knowledge/embedding"
+	"go-doudou-rag/module-knowledge/internal/dao"
+	"go-doudou-rag/module-knowledge/internal/model"
+	"go-doudou-rag/module-knowledge/vectorstore"
+	"go-doudou-rag/toolkit/llm"
+)
+
+// gate 阻塞内容包含 keyword 的 v2 向量化请求，第一次请求时关闭 started，release 关闭后放行
+type gate struct {
+	keyword     string
+	started     chan struct{}
+	startedOnce sync.Once
+	release     chan struct{}
+}
+
+func newGate(keyword string) *gate {
+	return &gate{
+		keyword: keyword,
+		started: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+}
+
+// gatedEmbedding 模型 v1 直接使用哈希向量，模型 v2 的请求经过 gates，并统计在 swapMu 写锁下发出的请求数。
+// unlocked 不为空时在写锁之外的每次 v2 请求后调用
+type gatedEmbedding struct {
+	gates    []*gate
+	unlocked func()
+	locked   atomic.Int32
+	svc      *ModuleKnowledgeImpl
+}
+
+func (receiver *gatedEmbedding) factory(opts embedding.Options) chromem.EmbeddingFunc {
+	hash := embedding.NewHash(opts.Dimension)
+	if opts.Model != "v2" {
+		return hash
+	}
+	return func(ctx context.Context, text string) ([]float32, error) {
+		for _, item := range receiver.gates {
+			if strings.Contains(text, item.keyword) {
+				item.startedOnce.Do(func() {
+					close(item.started)
+				})
+				<-item.release
+			}
+		}
+		if receiver.svc.swapMu.TryRLock() {
+			receiver.svc.swapMu.RUnlock()
+			if receiver.unlocked != nil {
+				receiver.unlocked()
+			}
+		} else {
+			receiver.locked.Add(1)
+		}
+		return hash(ctx, text)
+	}
+}
+
+// newGatedService 创建使用 gated 向量化模型 v1 的服务，一个 worker 执行重新向量化，另一个执行入库
+func newGatedService(t *testing.T, gated *gatedEmbedding) *ModuleKnowledgeImpl {
+	embedding.Register("gated", gated.factory)
+
+	dir := t.TempDir()
+	db := newTestDB(t, dir)
+	vectorStore, err := vectorstore.NewSQLite(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := newTestConfig(dir)
+	conf.Biz.Embedding.Provider = "gated"
+	conf.Openai.EmbeddingModel = "v1"
+	conf.Biz.Ingest.Workers = 2
+	svc := startTestService(t, conf, vectorStore, llm.NewFake())
+	gated.svc = svc
+	return svc
+}
+
+// startReembed 把默认知识库的向量化模型改为 v2 并开始重新向量化
+func startReembed(t *testing.T, svc *ModuleKnowledgeImpl) dto.JobDTO {
+	ctx := context.Background()
+	kb, _ := svc.GetKb_Id(ctx, svc.defaultKbId)
+	if _, err := svc.PutKb_Id(ctx, kb.Id, dto.SaveKbReq{
+		Name:           kb.Name,
+		Description:    kb.Description,
+		EmbeddingModel: "v2",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	job, err := svc.PostKb_IdReembed(ctx, kb.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return job
+}
+
+func TestReembedWhileIngesting(t *testing.T) {
+	travel, room := newGate("住宿费"), newGate("机房")
+	gated := &gatedEmbedding{
+		gates: []*gate{travel, room},
+	}
+	svc := newGatedService(t, gated)
+	ctx := context.Background()
+
+	upload(t, svc, "差旅制度.txt", "出差住宿费一类城市每天不超过五百元。", "")
+	job := startReembed(t, svc)
+
+	// 重新向量化正在请求模型时，入库和检索不受影响，仍然使用原来的集合和模型
+	<-travel.started
+	upload(t, svc, "机房管理.txt", "机房空调每周巡检一次，巡检记录保存三年。", "")
+	results, err := svc.GetQuery(ctx, dto.QueryReq{Text: "机房巡检", RetrieveLimit: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) == 0 || !strings.Contains(results[0].Content, "机房") {
+		t.Fatalf("results during reembed = %+v", results)
+	}
+
+	// 同步重建期间入库的文件时又有文件入库，这个文件同样在写锁之外向量化
+	close(travel.release)
+	<-room.started
+	upload(t, svc, "会议室.txt", "会议室需要提前一天预约，使用后恢复桌椅摆放。", "")
+	close(room.release)
+
+	waitJob(t, svc, job.Id)
+	if n := gated.locked.Load(); n > 0 {
+		t.Fatalf("%d embedding requests were made while holding the swap lock", n)
+	}
+
+	// 重建期间入库的文件也同步到了新集合
+	kb, _ := svc.GetKb_Id(ctx, svc.defaultKbId)
+	if kb.IndexedModel != "gated:v2" || kb.Stale {
+		t.Fatalf("kb after reembed = %+v", kb)
+	}
+	if got, want := countVectors(t, svc.base(kb.Id)), len(dao.GetChunkRepo().ListByKb(ctx, kb.Id)); got != want {
+		t.Fatalf("vectors = %d, want %d", got, want)
+	}
+	for _, text := range []string{"机房巡检", "会议室预约"} {
+		results, err = svc.GetQuery(ctx, dto.QueryReq{Text: text, RetrieveLimit: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) == 0 || !strings.Contains(results[0].Content, text[:6]) {
+			t.Fatalf("results of %s after reembed = %+v", text, results)
+		}
+	}
+}
+
+func TestReembedUnderSteadyIngestion(t *testing.T) {
+	// 每次在写锁之外请求模型后都有新文件入库，对比分块ID时总有变化
+	var ingested atomic.Int32
+	gated := &gatedEmbedding{}
+	svc := newGatedService(t, gated)
+	ctx := context.Background()
+	gated.unlocked = func() {
+		n := ingested.Add(1)
+		uploaded, err := svc.Upload(ctx, v3.FileModel{
+			Filename: fmt.Sprintf("通知%d.txt", n),
+			Reader:   io.NopCloser(strings.NewReader(fmt.Sprintf("第%d号通知：机房空调巡检。", n))),
+		}, nil, nil, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+			if job, _ := svc.GetJobs_Id(ctx, uploaded.JobId); job.Status == model.JobStatusSucceeded {
+				return
+			}
+		}
+		t.Errorf("ingest job %d did not succeed", uploaded.JobId)
+	}
+
+	upload(t, svc, "差旅制度.txt", "出差住宿费一类城市每天不超过五百元。", "")
+	waitJob(t, svc, startReembed(t, svc).Id)
+
+	// 不加锁同步 maxReembedSyncs 次后在写锁内完成最后一次同步
+	if n := gated.locked.Load(); n == 0 {
+		t.Fatal("the last sync should be made while holding the swap lock")
+	}
+	if n := ingested.Load(); n != maxReembedSyncs+1 {
+		t.Fatalf("ingested = %d", n)
+	}
+	kb := svc.base(svc.defaultKbId)
+	if got, want := countVectors(t, kb), len(dao.GetChunkRepo().ListByKb(ctx, kb.ID)); got != want || kb.IndexedModel != "gated:v2" {
+		t.Fatalf("vectors = %d, want %d, kb = %+v", got, want, kb.KnowledgeBase)
+	}
+}
@@ -0,0 +1,198 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/samber/lo"
+	"github.com/unionj-cloud/toolkit/stringutils"
+
+	"go-doudou-rag/module-knowledge/dto"
+)
+
+const (
+	rerankStrategyMMR          = "mmr"
+	rerankStrategyCrossEncoder = "cross_encoder"
+)
+
+// rerank 对召回的分块重排，原来的检索得分保留在 Score 中，重排得分写入 RerankScore
+func (receiver *ModuleKnowledgeImpl) rerank(ctx context.Context, text string, hits []hit, rerank dto.Rerank) []hit {
+	if len(hits) == 0 {
+		return hits
+	}
+
+	topN := rerank.TopN
+	if topN <= 0 || topN > len(hits) {
+		topN = len(hits)
+	}
+
+	switch rerank.Strategy {
+	case rerankStrategyMMR:
+		lambda := lo.Ternary(rerank.Lambda > 0, rerank.Lambda, 0.5)
+		if lambda > 1 {
+			panic("lambda must be between 0 and 1")
+		}
+		return receiver.mmr(ctx, text, hits, lambda, topN)
+	case rerankStrategyCrossEncoder:
+		return receiver.crossEncode(ctx, text, hits, topN)
+	default:
+		panic(fmt.Sprintf("unsupported rerank strategy: %s", rerank.Strategy))
+	}
+}
+
+// mmr 最大边际相关性：每次选出 lambda * 与问题的相似度 - (1 - lambda) * 与已选分块的最大相似度 最高的分块。
+// 使用向量库中保存的向量，向量都已归一化，点积即为余弦相似度。各知识库的问题向量使用各自的向量化模型计算
+func (receiver *ModuleKnowledgeImpl) mmr(ctx context.Context, text string, hits []hit, lambda float32, topN int) []hit {
+	queryEmbeddings := make(map[uint][]float32)
+	remaining := slices.Clone(hits)
+	for i := range remaining {
+		kb := receiver.base(remaining[i].KbId)
+		if _, ok := queryEmbeddings[kb.ID]; !ok {
+			queryEmbedding, err := kb.queryFunc(ctx, text)
+			if err != nil {
+				panic(err)
+			}
+			queryEmbeddings[kb.ID] = normalize(queryEmbedding)
+		}
+		// 只由关键词检索命中的分块没有带回向量
+		if len(remaining[i].Embedding) > 0 {
+			continue
+		}
+		if doc, err := kb.collection.Get(ctx, remaining[i].ID); err == nil && doc != nil {
+			remaining[i].Embedding = doc.Embedding
+		}
+	}
+
+	selected := make([]hit, 0, topN)
+	for len(selected) < topN && len(remaining) > 0 {
+		best := 0
+		bestScore := float32(math.Inf(-1))
+		for i, candidate := range remaining {
+			var redundancy float32
+			for j, item := range selected {
+				similarity := dot(candidate.Embedding, item.Embedding)
+				if j == 0 || similarity > redundancy {
+					redundancy = similarity
+				}
+			}
+			score := lambda*dot(queryEmbeddings[candidate.KbId], candidate.Embedding) - (1-lambda)*redundancy
+			if score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+		remaining[best].RerankScore = bestScore
+		selected = append(selected, remaining[best])
+		remaining = slices.Delete(remaining, best, best+1)
+	}
+
+	return selected
+}
+
+func dot(a, b []float32) float32 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var sum float32
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
+
+func normalize(v []float32) []float32 {
+	var norm float32
+	for _, item := range v {
+		norm += item * item
+	}
+	if norm == 0 {
+		return v
+	}
+	norm = float32(math.Sqrt(float64(norm)))
+	return lo.Map(v, func(item float32, index int) float32 {
+		return item / norm
+	})
+}
+
+type rerankRequest struct {
+	Model           string   `json:"model"`
+	Query           string   `json:"query"`
+	Documents       []string `json:"documents"`
+	TopN            int      `json:"top_n"`
+	ReturnDocuments bool     `json:"return_documents"`
+}
+
+type rerankResponse struct {
+	Results []struct {
+		Index          int     `json:"index"`
+		RelevanceScore float32 `json:"relevance_score"`
+	} `json:"results"`
+}
+
+// crossEncode 调用 OpenAI 兼容的 /rerank 接口（Jina、Cohere、SiliconFlow 等使用相同的请求和响应格式）
+func (receiver *ModuleKnowledgeImpl) crossEncode(ctx context.Context, text string, hits []hit, topN int) []hit {
+	if stringutils.IsEmpty(receiver.conf.Openai.RerankModel) {
+		panic("rerank model is not configured")
+	}
+
+	body, err := json.Marshal(rerankRequest{
+		Model: receiver.conf.Openai.RerankModel,
+		Query: text,
+		Documents: lo.Map(hits, func(item hit, index int) string {
+			return item.Content
+		}),
+		TopN: topN,
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(receiver.conf.Openai.BaseUrl, "/")+"/rerank", bytes.NewReader(body))
+	if err != nil {
+		panic(err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+lo.Ternary(stringutils.IsNotEmpty(receiver.conf.Openai.Token), receiver.conf.Openai.Token, os.Getenv("OPENAI_API_KEY")))
+
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		panic(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(resp.Body)
+		panic(fmt.Sprintf("rerank failed, status: %d, body: %s", resp.StatusCode, msg))
+	}
+
+	var rerankResp rerankResponse
+	if err = json.NewDecoder(resp.Body).Decode(&rerankResp); err != nil {
+		panic(err)
+	}
+
+	var reranked []hit
+	for _, item := range rerankResp.Results {
+		if item.Index < 0 || item.Index >= len(hits) {
+			continue
+		}
+		result := hits[item.Index]
+		result.RerankScore = item.RelevanceScore
+		reranked = append(reranked, result)
+	}
+	sort.SliceStable(reranked, func(i, j int) bool {
+		return reranked[i].RerankScore > reranked[j].RerankScore
+	})
+	if len(reranked) > topN {
+		reranked = reranked[:topN]
+	}
+
+	return reranked
+}
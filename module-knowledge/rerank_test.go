@@ -0,0 +1,147 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go-doudou-rag/module-knowledge/dto"
+	"go-doudou-rag/toolkit/llm"
+)
+
+func contents(results []dto.QueryResult) []string {
+	var data []string
+	for _, item := range results {
+		data = append(data, item.Content)
+	}
+	return data
+}
+
+// queryPanics 返回检索时 panic 的内容，没有 panic 时返回空字符串
+func queryPanics(svc *ModuleKnowledgeImpl, req dto.QueryReq) (msg string) {
+	defer func() {
+		if r := recover(); r != nil {
+			msg = fmt.Sprint(r)
+		}
+	}()
+	_, _ = svc.GetQuery(context.Background(), req)
+	return ""
+}
+
+func TestRerankMMR(t *testing.T) {
+	svc := newTestService(t, llm.NewFake())
+	ctx := context.Background()
+
+	upload(t, svc, "差旅制度.txt", "出差住宿费一类城市每天不超过五百元。", "")
+	upload(t, svc, "差旅制度补充.txt", "出差住宿费一类城市每天不超过五百元整。", "")
+	upload(t, svc, "机房管理.txt", "机房空调每周巡检一次。", "")
+
+	query := func(lambda float32) []dto.QueryResult {
+		results, err := svc.GetQuery(ctx, dto.QueryReq{
+			Text:          "出差住宿费一类城市每天不超过五百元",
+			RetrieveLimit: 3,
+			Rerank:        &dto.Rerank{Strategy: rerankStrategyMMR, Lambda: lambda, TopN: 2},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 2 || results[0].RerankScore < results[1].RerankScore || results[0].Score == 0 {
+			t.Fatalf("results = %+v", results)
+		}
+		return results
+	}
+
+	// 只看相关性时两个几乎相同的分块排在前面，更看重多样性时第二个结果换成不同的分块
+	if got := contents(query(1)); !strings.Contains(got[1], "住宿费") {
+		t.Fatalf("lambda 1: %v", got)
+	}
+	if got := contents(query(0.3)); !strings.Contains(got[0], "住宿费") || !strings.Contains(got[1], "机房") {
+		t.Fatalf("lambda 0.3: %v", got)
+	}
+
+	for _, rerank := range []dto.Rerank{
+		{Strategy: rerankStrategyMMR, Lambda: 1.5},
+		{Strategy: "unknown"},
+	} {
+		if msg := queryPanics(svc, dto.QueryReq{Text: "住宿费", RetrieveLimit: 3, Rerank: &rerank}); msg == "" {
+			t.Fatalf("rerank %+v should fail", rerank)
+		}
+	}
+}
+
+func TestRerankCrossEncoder(t *testing.T) {
+	svc := newTestService(t, llm.NewFake())
+	upload(t, svc, "差旅制度.txt", "出差住宿费一类城市每天不超过五百元。", "")
+	upload(t, svc, "机房管理.txt", "机房空调每周巡检一次，出差期间由值班人员代为巡检。", "")
+	upload(t, svc, "会议室.txt", "会议室需要提前一天预约。", "")
+	req := dto.QueryReq{
+		Text:          "出差",
+		RetrieveLimit: 3,
+		Rerank:        &dto.Rerank{Strategy: rerankStrategyCrossEncoder, TopN: 2},
+	}
+
+	if msg := queryPanics(svc, req); !strings.Contains(msg, "not configured") {
+		t.Fatalf("panic = %q", msg)
+	}
+
+	var received rerankRequest
+	var authorization string
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/rerank" {
+			http.NotFound(w, r)
+			return
+		}
+		authorization = r.Header.Get("Authorization")
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Error(err)
+		}
+		if status != http.StatusOK {
+			http.Error(w, "model overloaded", status)
+			return
+		}
+		// 按文档中出现的“会议室”“机房”打分，越界的序号忽略
+		var resp rerankResponse
+		for i, item := range received.Documents {
+			score := float32(0.1)
+			if strings.Contains(item, "会议室") {
+				score = 0.9
+			} else if strings.Contains(item, "机房") {
+				score = 0.5
+			}
+			resp.Results = append(resp.Results, struct {
+				Index          int     `json:"index"`
+				RelevanceScore float32 `json:"relevance_score"`
+			}{Index: i, RelevanceScore: score})
+		}
+		resp.Results = append(resp.Results, resp.Results[0])
+		resp.Results[len(resp.Results)-1].Index = len(received.Documents)
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+	svc.conf.Openai.BaseUrl = server.URL + "/v1/"
+	svc.conf.Openai.Token = "secret"
+	svc.conf.Openai.RerankModel = "bge-reranker"
+
+	results, err := svc.GetQuery(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if received.Model != "bge-reranker" || received.Query != "出差" || len(received.Documents) != 3 || received.TopN != 2 ||
+		authorization != "Bearer secret" {
+		t.Fatalf("request = %+v, authorization = %q", received, authorization)
+	}
+	if got := contents(results); len(got) != 2 || !strings.Contains(got[0], "会议室") || !strings.Contains(got[1], "机房") ||
+		results[0].RerankScore != 0.9 || results[1].RerankScore != 0.5 {
+		t.Fatalf("results = %+v", results)
+	}
+
+	status = http.StatusServiceUnavailable
+	if msg := queryPanics(svc, req); !strings.Contains(msg, "status: 503") || !strings.Contains(msg, "model overloaded") {
+		t.Fatalf("panic = %q", msg)
+	}
+}
@@ -0,0 +1,158 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/samber/lo"
+	"github.com/unionj-cloud/toolkit/stringutils"
+
+	"go-doudou-rag/module-knowledge/dto"
+	"go-doudou-rag/module-knowledge/vectorstore"
+)
+
+const (
+	retrievalModeVector  = "vector"
+	retrievalModeKeyword = "keyword"
+	retrievalModeHybrid  = "hybrid"
+)
+
+// hit 向量检索或者关键词检索命中的分块
+type hit struct {
+	KbId       uint
+	ID         string
+	Content    string
+	Metadata   map[string]string
+	Similarity float32
+	Score      float32
+	// 仅向量检索命中的分块有值
+	Embedding   []float32
+	RerankScore float32
+}
+
+// retrieve 按检索模式在知识库的检索范围内召回分块，调用方需要持有 swapMu 读锁
+func (receiver *ModuleKnowledgeImpl) retrieve(ctx context.Context, kb *knowledgeBase, req dto.QueryReq) []hit {
+	retrieval := receiver.conf.Biz.Retrieval
+	mode := lo.Ternary(stringutils.IsNotEmpty(req.Mode), req.Mode, retrieval.Mode)
+
+	s := newScope(ctx, kb.ID, req.Filter)
+	if s == nil {
+		return nil
+	}
+
+	switch mode {
+	case retrievalModeVector:
+		return receiver.vectorSearch(ctx, kb, req, s)
+	case retrievalModeKeyword:
+		return receiver.keywordSearch(kb, req, s)
+	case retrievalModeHybrid:
+		weight := lo.Ternary(req.KeywordWeight > 0, req.KeywordWeight, retrieval.KeywordWeight)
+		if weight < 0 || weight > 1 {
+			panic("keyword weight must be between 0 and 1")
+		}
+		return fuse(receiver.vectorSearch(ctx, kb, req, s), receiver.keywordSearch(kb, req, s), 1-weight, weight, retrieval.RrfK, req.RetrieveLimit)
+	default:
+		panic(fmt.Sprintf("unsupported retrieval mode: %s", mode))
+	}
+}
+
+// vectorSearch 向量检索，过滤掉相似度低于阈值的结果。问题只向量化一次，每个 where 条件分别检索后合并
+func (receiver *ModuleKnowledgeImpl) vectorSearch(ctx context.Context, kb *knowledgeBase, req dto.QueryReq, s *scope) []hit {
+	count, err := kb.collection.Count(ctx)
+	if err != nil {
+		panic(err)
+	}
+	nResults := min(req.RetrieveLimit, count)
+	if nResults <= 0 {
+		return nil
+	}
+
+	queryEmbedding, err := kb.queryFunc(ctx, req.Text)
+	if err != nil {
+		panic(err)
+	}
+	if kb.Dimension > 0 && len(queryEmbedding) != kb.Dimension {
+		panic(fmt.Sprintf("query embedding dimension %d does not match the %d dimensions of knowledge base %s, please re-embed it", len(queryEmbedding), kb.Dimension, kb.Name))
+	}
+
+	var res []vectorstore.Result
+	for _, filter := range s.filters() {
+		items, err := kb.collection.Query(ctx, queryEmbedding, nResults, filter)
+		if err != nil {
+			panic(err)
+		}
+		res = append(res, items...)
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].Similarity > res[j].Similarity
+	})
+
+	var hits []hit
+	lo.ForEach(res, func(item vectorstore.Result, index int) {
+		if len(hits) >= nResults || item.Similarity < req.SimilarityThreshold {
+			return
+		}
+		hits = append(hits, hit{
+			KbId:       kb.ID,
+			ID:         item.ID,
+			Content:    item.Content,
+			Metadata:   item.Metadata,
+			Similarity: item.Similarity,
+			Score:      item.Similarity,
+			Embedding:  item.Embedding,
+		})
+	})
+	return hits
+}
+
+// keywordSearch BM25 关键词检索
+func (receiver *ModuleKnowledgeImpl) keywordSearch(kb *knowledgeBase, req dto.QueryReq, s *scope) []hit {
+	var hits []hit
+	for _, item := range kb.keywords.Search(req.Text, req.RetrieveLimit, s.match) {
+		hits = append(hits, hit{
+			KbId:     kb.ID,
+			ID:       item.ID,
+			Content:  item.Content,
+			Metadata: item.Metadata,
+			Score:    item.Score,
+		})
+	}
+	return hits
+}
+
+// fuse 倒数排名融合：每个分块的得分为其在各路结果中 weight / (k + rank) 之和，rank 从 1 开始
+func fuse(vectorHits, keywordHits []hit, vectorWeight, keywordWeight float32, k, limit int) []hit {
+	if k <= 0 {
+		k = 60
+	}
+
+	fused := make(map[string]*hit)
+	var order []string
+	add := func(hits []hit, weight float32) {
+		for rank, item := range hits {
+			score := weight / float32(k+rank+1)
+			if existing, ok := fused[item.ID]; ok {
+				existing.Score += score
+				existing.Similarity = max(existing.Similarity, item.Similarity)
+				continue
+			}
+			item.Score = score
+			fused[item.ID] = &item
+			order = append(order, item.ID)
+		}
+	}
+	add(vectorHits, vectorWeight)
+	add(keywordHits, keywordWeight)
+
+	hits := lo.Map(order, func(id string, index int) hit {
+		return *fused[id]
+	})
+	sort.SliceStable(hits, func(i, j int) bool {
+		return hits[i].Score > hits[j].Score
+	})
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits
+}
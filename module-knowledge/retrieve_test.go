@@ -0,0 +1,61 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/samber/lo"
+)
+
+func TestFuse(t *testing.T) {
+	vectorHits := []hit{{ID: "a", Similarity: 0.9}, {ID: "b", Similarity: 0.8}, {ID: "c", Similarity: 0.7}}
+	keywordHits := []hit{{ID: "c"}, {ID: "d"}, {ID: "a"}}
+
+	tests := []struct {
+		name          string
+		vectorWeight  float32
+		keywordWeight float32
+		k             int
+		limit         int
+		want          []string
+	}{
+		{
+			// a: 1/61+1/63，c: 1/63+1/61，得分相同时保持先出现的顺序
+			name:          "两路都命中的分块排在前面",
+			vectorWeight:  1,
+			keywordWeight: 1,
+			want:          []string{"a", "c", "b", "d"},
+		},
+		{
+			name:          "关键词权重更高",
+			vectorWeight:  0.2,
+			keywordWeight: 1,
+			k:             1,
+			want:          []string{"c", "a", "d", "b"},
+		},
+		{
+			name:          "只用向量检索",
+			vectorWeight:  1,
+			keywordWeight: 0,
+			limit:         2,
+			want:          []string{"a", "b"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hits := fuse(vectorHits, keywordHits, tt.vectorWeight, tt.keywordWeight, tt.k, tt.limit)
+			if got := lo.Map(hits, func(item hit, index int) string { return item.ID }); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("fuse() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	hits := fuse(vectorHits, keywordHits, 1, 1, 60, 0)
+	if hits[1].ID != "c" || hits[1].Similarity != 0.7 || hits[1].Score != float32(1)/63+float32(1)/61 {
+		t.Fatalf("fused hit = %+v", hits[1])
+	}
+	// 融合不修改传入的命中结果
+	if vectorHits[0].Score != 0 || keywordHits[0].Score != 0 {
+		t.Fatal("fuse modified its input")
+	}
+}
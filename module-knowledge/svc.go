@@ -13,7 +13,30 @@ import (
 //go:generate go-doudou svc http --case snake
 
 type ModuleKnowledge interface {
-	Upload(ctx context.Context, file v3.FileModel) (data dto.UploadResult, err error)
+	// Upload 按内容哈希去重，同名但内容不同的文件作为新版本入库，入库成功后替换旧版本。
+	// kbId 为目标知识库，为空时上传到默认知识库。
+	// chunkStrategy 为分割策略：recursive, token, chinese, markdown, policy，为空时使用知识库的默认策略。
+	// tags 为英文逗号拼接的标签，用于检索时筛选文件，为空时沿用上一个版本的标签
+	Upload(ctx context.Context, file v3.FileModel, kbId *uint, chunkStrategy *string, tags *string) (data dto.UploadResult, err error)
 	GetList(ctx context.Context, req dto.GetListReq) (data []dto.FileDTO, err error)
 	GetQuery(ctx context.Context, req dto.QueryReq) (data []dto.QueryResult, err error)
+	// DeleteFile 删除文件的全部向量、原文件和抽取出的图片，并软删除文件记录。
+	// 删除当前版本时连同全部历史版本一起删除，删除历史版本时只删除该版本
+	DeleteFile(ctx context.Context, id uint) (err error)
+	GetJobs(ctx context.Context, req dto.GetJobsReq) (data []dto.JobDTO, err error)
+	GetJobs_Id(ctx context.Context, id uint) (data dto.JobDTO, err error)
+	// PostKb 新建知识库，向量化模型和分割配置为空时使用配置文件中的默认值
+	PostKb(ctx context.Context, req dto.SaveKbReq) (data dto.KbDTO, err error)
+	GetKb(ctx context.Context) (data []dto.KbDTO, err error)
+	GetKb_Id(ctx context.Context, id uint) (data dto.KbDTO, err error)
+	// PutKb_Id 修改知识库名称、描述、向量化模型和默认分割配置。
+	// 知识库中已有文件时修改向量化模型后仍然使用原来的模型检索，需要调用 PostKb_IdReembed 重新向量化
+	PutKb_Id(ctx context.Context, id uint, req dto.SaveKbReq) (data dto.KbDTO, err error)
+	// DeleteKb_Id 删除知识库及其中的全部文件和向量，默认知识库不能删除
+	DeleteKb_Id(ctx context.Context, id uint) (err error)
+	// GetEmbeddingCache 按向量化模型返回向量缓存的条数和命中率
+	GetEmbeddingCache(ctx context.Context) (data []dto.EmbeddingCacheStats, err error)
+	// PostKb_IdReembed @role(admin) 使用配置的向量化模型重新向量化知识库，完成后替换原来的集合，期间检索不受影响。
+	// 返回的任务可以通过 /jobs/{id} 查询进度
+	PostKb_IdReembed(ctx context.Context, id uint) (data dto.JobDTO, err error)
 }
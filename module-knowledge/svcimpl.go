@@ -5,233 +5,251 @@
 package service
 
 import (
-	"bytes"
 	"context"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
-	concpool "github.com/sourcegraph/conc/pool"
 	"go-doudou-rag/toolkit/utils"
 	"io"
-	"log"
 	"net/http"
 	"os"
 	"path/filepath"
-	"runtime"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/klippa-app/go-pdfium"
-	"github.com/klippa-app/go-pdfium/requests"
-	"github.com/klippa-app/go-pdfium/webassembly"
-	"github.com/pdfcpu/pdfcpu/pkg/api"
-	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
-	pdfmodel "github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
-	"github.com/philippgille/chromem-go"
 	"github.com/samber/lo"
 	"github.com/spf13/cast"
 	"github.com/tmc/langchaingo/llms"
-	"github.com/tmc/langchaingo/llms/openai"
 	"github.com/tmc/langchaingo/schema"
 	"github.com/tmc/langchaingo/textsplitter"
 	v3 "github.com/unionj-cloud/toolkit/openapi/v3"
 	"github.com/unionj-cloud/toolkit/stringutils"
 
+	"go-doudou-rag/module-knowledge/chunker"
 	"go-doudou-rag/module-knowledge/config"
 	"go-doudou-rag/module-knowledge/dto"
+	"go-doudou-rag/module-knowledge/embedding"
 	"go-doudou-rag/module-knowledge/internal/dao"
 	"go-doudou-rag/module-knowledge/internal/model"
+	"go-doudou-rag/module-knowledge/loader"
+	"go-doudou-rag/module-knowledge/vectorstore"
+	"go-doudou-rag/toolkit/llm"
+	"go-doudou-rag/toolkit/prompt"
 )
 
-var pool pdfium.Pool
-var instance pdfium.Pdfium
-
-func init() {
-	var err error
-
-	// Init the PDFium library and return the instance to open documents.
-	// You can tweak these configs to your need. Be aware that workers can use quite some memory.
-	pool, err = webassembly.Init(webassembly.Config{
-		MinIdle:  1, // Makes sure that at least x workers are always available
-		MaxIdle:  1, // Makes sure that at most x workers are ever available
-		MaxTotal: 1, // Maxium amount of workers in total, allows the amount of workers to grow when needed, items between total max and idle max are automatically cleaned up, while idle workers are kept alive so they can be used directly.
-	})
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	instance, err = pool.GetInstance(time.Second * 30)
-	if err != nil {
-		log.Fatal(err)
-	}
-}
-
 var _ ModuleKnowledge = (*ModuleKnowledgeImpl)(nil)
 
 type ModuleKnowledgeImpl struct {
 	conf        *config.Config
-	collection  *chromem.Collection
-	vectorStore *chromem.DB
+	vectorStore vectorstore.Store
+	llmProvider llm.Provider
+	// 知识库ID -> 知识库
+	bases       map[uint]*knowledgeBase
+	basesMu     sync.RWMutex
+	defaultKbId uint
+	jobs        chan uint
+	// 关闭后 worker 不再领取新任务
+	stop     chan struct{}
+	stopOnce sync.Once
+	workers  sync.WaitGroup
+	uploadMu sync.Mutex
+	// 向量缓存的命中统计
+	cacheCounter cacheCounter
+	// 检索时持有读锁，新旧版本分块替换和删除文件时持有写锁
+	swapMu sync.RWMutex
 }
 
-func NewModuleKnowledge(conf *config.Config) *ModuleKnowledgeImpl {
-	db := chromem.NewDB()
-	db.ImportFromFile(conf.Biz.VectorStore.ExportToFile, "")
-
-	embeddingFunc := chromem.NewEmbeddingFuncOpenAICompat(conf.Openai.BaseUrl,
-		lo.Ternary(stringutils.IsNotEmpty(conf.Openai.Token), conf.Openai.Token, os.Getenv("OPENAI_API_KEY")),
-		conf.Openai.EmbeddingModel, nil)
-	c, err := db.GetOrCreateCollection("knowledge-base", nil, embeddingFunc)
-	if err != nil {
-		panic(err)
+func NewModuleKnowledge(conf *config.Config, vectorStore vectorstore.Store, llmProvider llm.Provider) *ModuleKnowledgeImpl {
+	if _, ok := embedding.New(conf.Biz.Embedding.Provider, embedding.Options{}); !ok {
+		panic(fmt.Sprintf("unsupported embedding provider %s, supported providers: %s",
+			conf.Biz.Embedding.Provider, strings.Join(embedding.Names(), ", ")))
 	}
 
-	return &ModuleKnowledgeImpl{
+	svc := &ModuleKnowledgeImpl{
 		conf:        conf,
-		collection:  c,
-		vectorStore: db,
+		vectorStore: vectorStore,
+		llmProvider: llmProvider,
+		bases:       make(map[uint]*knowledgeBase),
+		jobs:        make(chan uint, conf.Biz.Ingest.QueueSize),
+		stop:        make(chan struct{}),
+	}
+
+	ctx := context.Background()
+	kbRepo := dao.GetKnowledgeBaseRepo()
+	svc.defaultKbId = kbRepo.EnsureDefault(ctx).ID
+	for _, item := range kbRepo.List(ctx) {
+		svc.bases[item.ID] = svc.openBase(item)
 	}
+	for _, kb := range lo.Values(svc.bases) {
+		svc.checkIndex(ctx, kb)
+	}
+
+	// 引入关键词检索之前入库的文件没有保存分块原文，重新上传或者重新入库后才能被关键词检索到
+	dao.GetChunkRepo().Each(ctx, func(chunk *model.Chunk) {
+		if kb, ok := svc.bases[chunk.KbID]; ok {
+			kb.keywords.Add(chunk.ID, chunk.Content, chunk.Metadata)
+		}
+	})
+
+	svc.recoverVectors(ctx)
+	svc.startWorkers()
+
+	return svc
 }
 
-func (receiver *ModuleKnowledgeImpl) Upload(ctx context.Context, file v3.FileModel) (data dto.UploadResult, err error) {
+func (receiver *ModuleKnowledgeImpl) Upload(ctx context.Context, file v3.FileModel, kbId *uint, chunkStrategy *string, tags *string) (data dto.UploadResult, err error) {
 	defer func() {
 		file.Close()
 	}()
 
-	if filepath.Ext(file.Filename) != ".pdf" {
-		panic("not a pdf file")
+	kb := receiver.base(lo.FromPtr(kbId))
+
+	strategy := lo.FromPtr(chunkStrategy)
+	if stringutils.IsNotEmpty(strategy) {
+		if _, ok := chunker.New(strategy, chunker.Options{}); !ok {
+			panic(fmt.Sprintf("unsupported chunk strategy, supported strategies: %s", strings.Join(chunker.Names(), ", ")))
+		}
 	}
 
 	_ = os.MkdirAll(receiver.conf.Biz.FileSavePath, os.ModePerm)
-	out := filepath.Join(receiver.conf.Biz.FileSavePath, file.Filename)
+	name := filepath.Base(file.Filename)
+
+	// 先写入临时文件，边写边计算内容哈希
 	var f *os.File
-	f, err = os.OpenFile(out, os.O_WRONLY|os.O_CREATE, os.ModePerm)
+	f, err = os.CreateTemp(receiver.conf.Biz.FileSavePath, "upload-*")
 	if err != nil {
 		panic(err)
 	}
+	defer os.Remove(f.Name())
 	defer f.Close()
-	_, err = io.Copy(f, file.Reader)
-	if err != nil {
-		panic(err)
-	}
 
-	fileBytes, err := os.ReadFile(out)
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(f, h), file.Reader)
 	if err != nil {
 		panic(err)
 	}
+	_ = f.Close()
+	hash := hex.EncodeToString(h.Sum(nil))
 
-	doc, err := instance.FPDF_LoadDocument(&requests.FPDF_LoadDocument{
-		Path: &out,
-	})
-	if err != nil {
-		panic(err)
+	if _, ok := loader.Lookup(name, detectContentType(f.Name())); !ok {
+		panic(fmt.Sprintf("unsupported file type, supported types: %s", strings.Join(loader.Keys(), ", ")))
 	}
 
-	// Always close the document, this will release its resources.
-	defer instance.FPDF_CloseDocument(&requests.FPDF_CloseDocument{
-		Document: doc.Document,
-	})
-
-	pageCount, err := instance.FPDF_GetPageCount(&requests.FPDF_GetPageCount{
-		Document: doc.Document,
-	})
-	if err != nil {
-		panic(err)
-	}
+	receiver.uploadMu.Lock()
+	defer receiver.uploadMu.Unlock()
 
-	fileName := strings.TrimSuffix(filepath.Base(out), ".pdf")
+	// 接收文件期间知识库可能已经被删除
+	kb = receiver.base(kb.ID)
 
-	g := concpool.NewWithResults[[]schema.Document]().WithContext(ctx).WithCancelOnError()
+	fileRepo := dao.GetFileRepo()
+	if existing := fileRepo.GetByHash(ctx, kb.ID, hash); existing != nil {
+		if tags != nil {
+			fileRepo.UpdateTags(ctx, existing.ID, splitTags(*tags))
+		}
+		return receiver.reuse(ctx, existing, strategy), nil
+	}
 
-	for i := 0; i < pageCount.PageCount; i++ {
-		g.Go(func(ctx context.Context) ([]schema.Document, error) {
+	// 每个版本保存在以内容哈希命名的目录下，保留原文件名，抽取出的图片也写在同一个目录。
+	// 默认知识库之外的知识库再按知识库分一层目录，相同的文件上传到不同的知识库时互不影响
+	dir := filepath.Join(receiver.conf.Biz.FileSavePath, hash)
+	if !kb.IsDefault {
+		dir = filepath.Join(receiver.conf.Biz.FileSavePath, fmt.Sprintf("kb-%d", kb.ID), hash)
+	}
+	if err = os.MkdirAll(dir, os.ModePerm); err != nil {
+		panic(err)
+	}
+	out := filepath.Join(dir, name)
+	if err = os.Rename(f.Name(), out); err != nil {
+		panic(err)
+	}
 
-			var docs []schema.Document
+	// 未指定标签时沿用上一个版本的标签
+	var fileTags []string
+	versions := fileRepo.ListVersions(ctx, kb.ID, name)
+	if tags != nil {
+		fileTags = splitTags(*tags)
+	} else if len(versions) > 0 {
+		fileTags = versions[0].Tags
+	}
 
-			// 获取页面文本
-			pageText, err := instance.GetPageText(&requests.GetPageText{
-				Page: requests.Page{
-					ByIndex: &requests.PageByIndex{
-						Document: doc.Document,
-						Index:    i,
-					},
-				},
-			})
-			if err != nil {
-				panic(err)
-			}
+	version := fileRepo.LatestVersion(ctx, kb.ID, name) + 1
+	id := fileRepo.Save(ctx, dto.FileDTO{
+		KbId:          kb.ID,
+		Name:          name,
+		Hash:          hash,
+		Version:       version,
+		ChunkStrategy: strategy,
+		Tags:          fileTags,
+		Path:          out,
+	})
 
-			docs = append(docs, schema.Document{
-				PageContent: pageText.Text,
-				Metadata: map[string]any{
-					"page":        i,
-					"total_pages": pageCount.PageCount,
-					"type":        "text",
-				},
-			})
-
-			var imageOutFile string
-			if err = api.ExtractImages(bytes.NewReader(fileBytes), []string{cast.ToString(i)}, func(img pdfmodel.Image, singleImgPerPage bool, maxPageDigits int) error {
-				if img.Reader == nil {
-					return nil
-				}
-				s := "%s_%" + fmt.Sprintf("0%dd", maxPageDigits)
-				qual := img.Name
-				if img.Thumb {
-					qual = "thumb"
-				}
-				f := fmt.Sprintf(s+"_%s.%s", fileName, img.PageNr, qual, img.FileType)
-				imageOutFile = filepath.Join(receiver.conf.Biz.FileSavePath, f)
-				return pdfcpu.WriteReader(imageOutFile, img)
-			}, nil); err != nil {
-				panic(err)
-			}
+	// 抽取、向量化耗时较长，交给后台 worker 执行，入库成功后新版本才替换旧版本
+	jobId := receiver.submitJob(ctx, id)
 
-			if stringutils.IsNotEmpty(imageOutFile) {
-				imageDescription := receiver.analyzeImageWithMultiModal(ctx, imageOutFile)
-
-				if stringutils.IsNotEmpty(imageDescription) {
-					docs = append(docs, schema.Document{
-						PageContent: imageDescription,
-						Metadata: map[string]any{
-							"page":        i,
-							"total_pages": pageCount.PageCount,
-							"file":        imageOutFile,
-							"type":        "image",
-						},
-					})
-				}
-			}
+	return dto.UploadResult{
+		Id:      id,
+		KbId:    kb.ID,
+		JobId:   jobId,
+		Version: version,
+	}, nil
+}
 
-			return docs, nil
-		})
+// splitTags 拆分英文逗号拼接的标签，去掉空白和重复的标签
+func splitTags(tags string) []string {
+	return lo.Uniq(lo.Compact(lo.Map(strings.Split(tags, ","), func(item string, index int) string {
+		return strings.TrimSpace(item)
+	})))
+}
 
+// reuse 内容相同的文件不重复入库。该版本入库失败、已经被新版本替换或者指定了不同的分割策略时重新提交任务，
+// 入库成功后它会重新成为当前版本
+func (receiver *ModuleKnowledgeImpl) reuse(ctx context.Context, file *model.File, strategy string) dto.UploadResult {
+	result := dto.UploadResult{
+		Id:        file.ID,
+		KbId:      file.KbID,
+		Version:   file.Version,
+		Duplicate: true,
 	}
 
-	groups, err := g.Wait()
-	if err != nil {
-		panic(err)
-	}
+	jobs := dao.GetJobRepo().List(ctx, dao.ListJobReq{
+		FileId: file.ID,
+		Limit:  1,
+	})
+	unfinished := len(jobs) > 0 && lo.Contains([]string{model.JobStatusQueued, model.JobStatusRunning}, jobs[0].Status)
 
-	if len(groups) == 0 {
-		panic("内容为空")
+	if stringutils.IsNotEmpty(strategy) && strategy != file.ChunkStrategy {
+		if unfinished {
+			panic("file is being ingested, please retry later")
+		}
+		dao.GetFileRepo().UpdateChunkStrategy(ctx, file.ID, strategy)
+		result.JobId = receiver.submitJob(ctx, file.ID)
+		return result
 	}
 
-	var docs []schema.Document
-	lo.ForEach(groups, func(items []schema.Document, index int) {
-		docs = append(docs, items...)
-	})
+	if len(jobs) > 0 {
+		result.JobId = jobs[0].ID
+		if file.Current || unfinished {
+			return result
+		}
+	} else if file.Current {
+		return result
+	}
 
-	sort.SliceStable(docs, func(i, j int) bool {
-		pageNoI := cast.ToInt(docs[i].Metadata["page"])
-		pageNoJ := cast.ToInt(docs[j].Metadata["page"])
-		return pageNoI < pageNoJ
-	})
+	result.JobId = receiver.submitJob(ctx, file.ID)
+	return result
+}
 
-	splitter := textsplitter.NewRecursiveCharacter(
-		textsplitter.WithChunkSize(500),
-		textsplitter.WithChunkOverlap(100),
-	)
+// split 按文件指定的策略分割文档并转换成向量库文档，未指定时使用知识库的分割配置
+func (receiver *ModuleKnowledgeImpl) split(kb *knowledgeBase, file *model.File, docs []schema.Document) []vectorstore.Document {
+	strategy, opts := receiver.chunking(kb)
+	strategy = lo.Ternary(stringutils.IsNotEmpty(file.ChunkStrategy), file.ChunkStrategy, strategy)
+	splitter, ok := chunker.New(strategy, opts)
+	if !ok {
+		panic(fmt.Sprintf("unsupported chunk strategy: %s", strategy))
+	}
 
 	// 分割文档
 	splitDocs, err := textsplitter.SplitDocuments(splitter, docs)
@@ -239,106 +257,76 @@ func (receiver *ModuleKnowledgeImpl) Upload(ctx context.Context, file v3.FileMod
 		panic(err)
 	}
 
-	var documents []chromem.Document
+	var documents []vectorstore.Document
 	lo.ForEach(splitDocs, func(item schema.Document, index int) {
 		metadata := lo.MapEntries[string, any, string, string](item.Metadata, func(key string, value any) (string, string) {
 			return key, cast.ToString(value)
 		})
 
-		metadata["file"] = out
+		metadata["file"] = file.Path
+		metadata["kb_id"] = cast.ToString(file.KbID)
+		metadata["file_id"] = cast.ToString(file.ID)
+		metadata["file_name"] = file.Name
+		metadata["chunk_strategy"] = strategy
+		metadata["chunk_index"] = cast.ToString(index)
 
-		documents = append(documents, chromem.Document{
-			ID:       utils.GenerateBase64URLSafeSHA256ID(item.PageContent),
+		documents = append(documents, vectorstore.Document{
+			// 不同知识库、不同文件中相同的内容分别保存，同一文件的不同版本中相同的内容 ID 相同
+			ID:       utils.GenerateBase64URLSafeSHA256ID(fmt.Sprintf("%d/%s/%s", file.KbID, file.Name, item.PageContent)),
 			Content:  item.PageContent,
 			Metadata: metadata,
 		})
 	})
 
-	if err = receiver.collection.AddDocuments(ctx, documents, runtime.NumCPU()); err != nil {
-		panic(err)
-	}
-
-	if err = receiver.vectorStore.ExportToFile(receiver.conf.Biz.VectorStore.ExportToFile, false, ""); err != nil {
-		panic(err)
-	}
-
-	fileRepo := dao.GetFileRepo()
-	id := fileRepo.Save(ctx, dto.FileDTO{
-		Path: out,
-	})
-
-	return dto.UploadResult{
-		Id: id,
-	}, nil
+	return documents
 }
 
-func (receiver *ModuleKnowledgeImpl) extractContentFromPdf(ctx context.Context, file *model.File) (data string) {
-	doc, err := instance.FPDF_LoadDocument(&requests.FPDF_LoadDocument{
-		Path: &file.Path,
-	})
-	if err != nil {
-		panic(err)
+// load 根据文件扩展名或者 MIME 类型从注册表中选择文档加载器解析文件，图片使用 promptTemplate 模板中的提示词解析
+func (receiver *ModuleKnowledgeImpl) load(ctx context.Context, file string, promptTemplate string, progress loader.Progress) []schema.Document {
+	l, ok := loader.Lookup(file, detectContentType(file))
+	if !ok {
+		panic(fmt.Sprintf("unsupported file type: %s", filepath.Ext(file)))
 	}
 
-	// Always close the document, this will release its resources.
-	defer instance.FPDF_CloseDocument(&requests.FPDF_CloseDocument{
-		Document: doc.Document,
-	})
-
-	pageCount, err := instance.FPDF_GetPageCount(&requests.FPDF_GetPageCount{
-		Document: doc.Document,
+	docs, err := l.Load(ctx, file, loader.Options{
+		ImageSavePath: filepath.Dir(file),
+		ImageAnalyzer: func(ctx context.Context, image string) string {
+			return receiver.analyzeImageWithMultiModal(ctx, image, promptTemplate)
+		},
+		Progress: progress,
 	})
 	if err != nil {
 		panic(err)
 	}
 
-	fileBytes, err := os.ReadFile(file.Path)
-	if err != nil {
-		panic(err)
-	}
+	sort.SliceStable(docs, func(i, j int) bool {
+		pageNoI := cast.ToInt(docs[i].Metadata["page"])
+		pageNoJ := cast.ToInt(docs[j].Metadata["page"])
+		return pageNoI < pageNoJ
+	})
 
-	fileName := strings.TrimSuffix(filepath.Base(file.Path), ".pdf")
+	return docs
+}
 
+func (receiver *ModuleKnowledgeImpl) extractContent(ctx context.Context, file *model.File) (data string) {
 	var content string
-	for i := 0; i < pageCount.PageCount; i++ {
-		pageText, err := instance.GetPageText(&requests.GetPageText{
-			Page: requests.Page{
-				ByIndex: &requests.PageByIndex{
-					Document: doc.Document,
-					Index:    i,
-				},
-			},
-		})
-		if err != nil {
-			panic(err)
-		}
-
-		content += pageText.Text
-
-		var imageOutFile string
-		if err = api.ExtractImages(bytes.NewReader(fileBytes), []string{cast.ToString(i)}, func(img pdfmodel.Image, singleImgPerPage bool, maxPageDigits int) error {
-			if img.Reader == nil {
-				return nil
-			}
-			s := "%s_%" + fmt.Sprintf("0%dd", maxPageDigits)
-			qual := img.Name
-			if img.Thumb {
-				qual = "thumb"
-			}
-			f := fmt.Sprintf(s+"_%s.%s", fileName, img.PageNr, qual, img.FileType)
-			imageOutFile = filepath.Join(receiver.conf.Biz.FileSavePath, f)
-			return pdfcpu.WriteReader(imageOutFile, img)
-		}, nil); err != nil {
-			panic(err)
-		}
+	lo.ForEach(receiver.load(ctx, file.Path, receiver.base(file.KbID).PromptTemplate, nil), func(item schema.Document, index int) {
+		content += item.PageContent
+	})
+	return content
+}
 
-		if stringutils.IsNotEmpty(imageOutFile) {
-			imageDescription := receiver.analyzeImageWithMultiModal(ctx, imageOutFile)
-			content += imageDescription
-		}
+// detectContentType 读取文件头部嗅探 MIME 类型，扩展名缺失或者未注册时使用
+func detectContentType(file string) string {
+	f, err := os.Open(file)
+	if err != nil {
+		return ""
 	}
+	defer f.Close()
 
-	return content
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(f, head)
+	return http.DetectContentType(head[:n])
 }
 
 func (receiver *ModuleKnowledgeImpl) GetList(ctx context.Context, req dto.GetListReq) (data []dto.FileDTO, _ error) {
@@ -347,65 +335,214 @@ func (receiver *ModuleKnowledgeImpl) GetList(ctx context.Context, req dto.GetLis
 	listReq := dao.ListReq{
 		FileId: req.FileId,
 	}
+	if stringutils.IsEmpty(req.FileId) {
+		listReq.KbId = receiver.base(req.KbId).ID
+	}
 	fileModels := fileRepo.List(ctx, listReq)
 
+	if stringutils.IsEmpty(req.FileId) {
+		// 每个文件只返回当前版本，还没有入库成功的文件返回最新版本
+		fileModels = lo.Filter(fileModels, func(item *model.File, index int) bool {
+			return isPrimaryVersion(item, fileModels)
+		})
+	}
+
 	lo.ForEach(fileModels, func(item *model.File, index int) {
 
 		var content string
 
 		if req.WithContent {
-			content = receiver.extractContentFromPdf(ctx, item)
+			content = receiver.extractContent(ctx, item)
 		}
 
 		data = append(data, dto.FileDTO{
-			Id:      item.ID,
-			Path:    item.Path,
-			Content: content,
+			Id:            item.ID,
+			KbId:          item.KbID,
+			Name:          item.Name,
+			Path:          item.Path,
+			Hash:          item.Hash,
+			Version:       item.Version,
+			Current:       item.Current,
+			ChunkStrategy: item.ChunkStrategy,
+			Tags:          item.Tags,
+			CreatedAt:     item.CreatedAt.Format(time.DateTime),
+			Content:       content,
+			Versions: lo.Map(fileRepo.ListVersions(ctx, item.KbID, item.Name), func(version *model.File, index int) dto.FileVersionDTO {
+				return dto.FileVersionDTO{
+					Id:        version.ID,
+					Hash:      version.Hash,
+					Version:   version.Version,
+					Current:   version.Current,
+					CreatedAt: version.CreatedAt.Format(time.DateTime),
+				}
+			}),
 		})
 	})
 
 	return data, nil
 }
 
+func isPrimaryVersion(file *model.File, files []*model.File) bool {
+	if file.Current {
+		return true
+	}
+	for _, item := range files {
+		if item.KbID != file.KbID || item.Name != file.Name || item.ID == file.ID {
+			continue
+		}
+		if item.Current || item.Version > file.Version {
+			return false
+		}
+	}
+	return true
+}
+
+func (receiver *ModuleKnowledgeImpl) DeleteFile(ctx context.Context, id uint) (err error) {
+	fileRepo := dao.GetFileRepo()
+	file := fileRepo.Get(ctx, id)
+	if file == nil {
+		panic("file not found")
+	}
+
+	files := []*model.File{file}
+	if file.Current {
+		files = fileRepo.ListVersions(ctx, file.KbID, file.Name)
+	}
+
+	receiver.swapMu.Lock()
+	defer receiver.swapMu.Unlock()
+	receiver.removeFiles(ctx, receiver.base(file.KbID), files)
+
+	return nil
+}
+
+// removeFiles 删除文件的全部分块、原文件和抽取出的图片，并软删除文件记录，调用方需要持有 swapMu 写锁
+func (receiver *ModuleKnowledgeImpl) removeFiles(ctx context.Context, kb *knowledgeBase, files []*model.File) {
+	for _, item := range files {
+		unfinished := dao.GetJobRepo().List(ctx, dao.ListJobReq{
+			FileId: item.ID,
+			Status: []string{model.JobStatusQueued, model.JobStatusRunning},
+		})
+		if len(unfinished) > 0 {
+			panic("file is being ingested, please retry later")
+		}
+	}
+
+	for _, item := range files {
+		if err := kb.collection.Delete(ctx, map[string]string{
+			"file": item.Path,
+		}); err != nil {
+			panic(err)
+		}
+		kb.keywords.Delete(map[string]string{
+			"file": item.Path,
+		})
+
+		lo.ForEach(append(item.Images, item.Path), func(path string, index int) {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				panic(err)
+			}
+		})
+		// 版本目录为空时一并删除，非空（例如旧版本直接保存在 FileSavePath 下）时忽略
+		if filepath.Dir(item.Path) != filepath.Clean(receiver.conf.Biz.FileSavePath) {
+			_ = os.Remove(filepath.Dir(item.Path))
+		}
+	}
+
+	receiver.persist()
+
+	dao.GetChunkRepo().Replace(ctx, lo.Map(files, func(item *model.File, index int) string {
+		return item.Path
+	}), nil)
+	dao.GetFileRepo().Delete(ctx, lo.Map(files, func(item *model.File, index int) uint {
+		return item.ID
+	})...)
+}
+
 func (receiver *ModuleKnowledgeImpl) GetQuery(ctx context.Context, req dto.QueryReq) (data []dto.QueryResult, err error) {
 	if stringutils.IsEmpty(req.Text) {
 		panic("empty text")
 	}
 
-	nResults := req.RetrieveLimit
-	if nResults > receiver.collection.Count() {
-		nResults = receiver.collection.Count()
+	receiver.swapMu.RLock()
+	defer receiver.swapMu.RUnlock()
+
+	kbIds := lo.Uniq(req.KbIds)
+	if len(kbIds) == 0 && req.Filter != nil {
+		for _, id := range req.Filter.FileIds {
+			if file := dao.GetFileRepo().Get(ctx, id); file != nil {
+				kbIds = append(kbIds, file.KbID)
+			}
+		}
+		kbIds = lo.Uniq(kbIds)
+	}
+	if len(kbIds) == 0 {
+		kbIds = []uint{receiver.defaultKbId}
 	}
 
-	res, err := receiver.collection.Query(ctx, req.Text, nResults, nil, nil)
-	if err != nil {
-		panic(err)
+	var hits []hit
+	for _, kbId := range kbIds {
+		hits = append(hits, receiver.retrieve(ctx, receiver.base(kbId), req)...)
+	}
+	if len(kbIds) > 1 {
+		sort.SliceStable(hits, func(i, j int) bool {
+			return hits[i].Score > hits[j].Score
+		})
+		if req.RetrieveLimit > 0 && len(hits) > req.RetrieveLimit {
+			hits = hits[:req.RetrieveLimit]
+		}
+	}
+
+	if req.Rerank != nil {
+		hits = receiver.rerank(ctx, req.Text, hits, *req.Rerank)
 	}
 
-	lo.ForEach(res, func(item chromem.Result, index int) {
-		if item.Similarity >= req.SimilarityThreshold {
-			data = append(data, dto.QueryResult{
-				ID:         item.ID,
-				Similarity: item.Similarity,
-				Content:    item.Content,
-			})
+	// 早期入库的分块没有 file_id 和 file_name，按路径查找文件记录补齐
+	files := make(map[string]*model.File)
+	lo.ForEach(hits, func(item hit, index int) {
+		result := dto.QueryResult{
+			ID:          item.ID,
+			KbId:        item.KbId,
+			Similarity:  item.Similarity,
+			Score:       item.Score,
+			RerankScore: item.RerankScore,
+			Content:     item.Content,
+			FileId:      cast.ToUint(item.Metadata["file_id"]),
+			FileName:    item.Metadata["file_name"],
+			Page:        cast.ToInt(item.Metadata["page"]),
+			TotalPages:  cast.ToInt(item.Metadata["total_pages"]),
+			Type:        item.Metadata["type"],
+			Image:       item.Metadata["image"],
+			ChunkIndex:  -1,
+		}
+		if chunkIndex, ok := item.Metadata["chunk_index"]; ok {
+			result.ChunkIndex = cast.ToInt(chunkIndex)
+		}
+		if result.FileId == 0 && stringutils.IsNotEmpty(item.Metadata["file"]) {
+			path := item.Metadata["file"]
+			if _, ok := files[path]; !ok {
+				files[path] = dao.GetFileRepo().GetByPath(ctx, path)
+			}
+			if file := files[path]; file != nil {
+				result.FileId = file.ID
+				result.FileName = file.Name
+			}
 		}
+		data = append(data, result)
 	})
 
 	return data, nil
 }
 
 // analyzeImageWithMultiModal 使用多模态大模型分析图片，提取文字并描述图片内容
-func (receiver *ModuleKnowledgeImpl) analyzeImageWithMultiModal(ctx context.Context, file string) string {
-
-	// 初始化OpenAI客户端 (使用GPT-4 Vision或其他多模态模型)
-	// 从配置中获取API密钥
-	llm, err := openai.New(
-		openai.WithBaseURL(receiver.conf.Openai.BaseUrl),
-		openai.WithToken(lo.Ternary(stringutils.IsNotEmpty(receiver.conf.Openai.Token), receiver.conf.Openai.Token, os.Getenv("OPENAI_API_KEY"))),
-		openai.WithEmbeddingModel(receiver.conf.Openai.EmbeddingModel),
-		openai.WithModel(receiver.conf.Openai.Model),
-	)
+func (receiver *ModuleKnowledgeImpl) analyzeImageWithMultiModal(ctx context.Context, file string, promptTemplate string) string {
+
+	// 使用GPT-4 Vision或其他多模态模型
+	vision, err := receiver.llmProvider.New(llm.Options{
+		BaseUrl: receiver.conf.Openai.BaseUrl,
+		Token:   receiver.conf.Openai.Token,
+		Model:   receiver.conf.Openai.Model,
+	})
 	if err != nil {
 		panic(fmt.Errorf("初始化OpenAI客户端失败: %w", err))
 	}
@@ -431,13 +568,11 @@ func (receiver *ModuleKnowledgeImpl) analyzeImageWithMultiModal(ctx context.Cont
 	// 创建包含图片的提示
 	// 注意: 这里的实现依赖于OpenAI的Vision API
 	// 其他模型可能需要不同的实现方式
-	prompt := fmt.Sprintf(`上面是一张图片。请执行两项任务:
-1. 如果图片包含任何文字，请提取并返回所有可见文字。
-2. 详细描述图片中显示的内容。
-
-请按以下格式返回:
-图片文字: [图片中的所有文字，如果没有则返回"无文字"]
-图片描述: [对图片内容的详细描述]`)
+	tpl := prompt.ForKb(ctx, promptTemplate)
+	text, err := prompt.Render(tpl.Vision, prompt.Vars{})
+	if err != nil {
+		panic(fmt.Errorf("渲染提示词模板 %s 失败: %w", tpl.Name, err))
+	}
 
 	// 发送请求到模型
 	content := []llms.MessageContent{
@@ -445,12 +580,12 @@ func (receiver *ModuleKnowledgeImpl) analyzeImageWithMultiModal(ctx context.Cont
 			Role: llms.ChatMessageTypeHuman,
 			Parts: []llms.ContentPart{
 				llms.ImageURLPart(imgUrl),
-				llms.TextPart(prompt),
+				llms.TextPart(text),
 			},
 		},
 	}
 
-	contentResponse, err := llm.GenerateContent(ctx, content,
+	contentResponse, err := vision.GenerateContent(ctx, content,
 		llms.WithMaxTokens(4096),
 		llms.WithTemperature(0.2),
 	)
@@ -0,0 +1,461 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/samber/lo"
+	"github.com/tmc/langchaingo/llms"
+	v3 "github.com/unionj-cloud/toolkit/openapi/v3"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"go-doudou-rag/module-knowledge/config"
+	"go-doudou-rag/module-knowledge/dto"
+	"go-doudou-rag/module-knowledge/embedding"
+	"go-doudou-rag/module-knowledge/internal/dao"
+	"go-doudou-rag/module-knowledge/internal/model"
+	"go-doudou-rag/module-knowledge/vectorstore"
+	"go-doudou-rag/toolkit/llm"
+)
+
+// newTestService 使用临时目录中的数据库、SQLite 向量库、本地哈希向量和按脚本回答的大模型，不需要访问网络
+func newTestService(t *testing.T, fake *llm.Fake) *ModuleKnowledgeImpl {
+	dir := t.TempDir()
+	db := newTestDB(t, dir)
+	vectorStore, err := vectorstore.NewSQLite(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return startTestService(t, newTestConfig(dir), vectorStore, fake)
+}
+
+// newTestDB 在 dir 中创建知识库数据库并交给 dao 使用，测试结束后换回原来的数据库
+func newTestDB(t *testing.T, dir string) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(dir, "knowledge.db")+"?_pragma=busy_timeout(5000)"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.AutoMigrate(&model.File{}, &model.Job{}, &model.Chunk{}, &model.KnowledgeBase{}, &model.EmbeddingCache{}); err != nil {
+		t.Fatal(err)
+	}
+	previous := dao.DB()
+	dao.Use(db)
+	// 清理函数后注册先执行，worker 在这之前已经停掉，不会写到其他测试的数据库里
+	t.Cleanup(func() {
+		dao.Use(previous)
+	})
+	return db
+}
+
+func newTestConfig(dir string) *config.Config {
+	conf := &config.Config{}
+	conf.Biz.FileSavePath = filepath.Join(dir, "files")
+	conf.Biz.Embedding.Provider = embedding.ProviderHash
+	conf.Biz.Embedding.Dimension = 256
+	conf.Biz.Ingest.Workers = 1
+	conf.Biz.Ingest.QueueSize = 10
+	conf.Biz.Chunking.Strategy = "chinese"
+	conf.Biz.Chunking.ChunkSize = 60
+	conf.Biz.Retrieval.Mode = retrievalModeVector
+	conf.Biz.Retrieval.RrfK = 60
+	conf.Biz.Retrieval.KeywordWeight = 0.5
+	conf.Openai.EmbeddingModel = "test"
+	return conf
+}
+
+// startTestService 创建服务，测试结束时停掉 worker
+func startTestService(t *testing.T, conf *config.Config, vectorStore vectorstore.Store, fake *llm.Fake) *ModuleKnowledgeImpl {
+	svc := NewModuleKnowledge(conf, vectorStore, fake)
+	t.Cleanup(svc.Close)
+	return svc
+}
+
+// waitFinished 等待任务执行结束，返回成功或者失败的任务
+func waitFinished(t *testing.T, svc *ModuleKnowledgeImpl, jobId uint) dto.JobDTO {
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		job, err := svc.GetJobs_Id(context.Background(), jobId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.Status == model.JobStatusSucceeded || job.Status == model.JobStatusFailed {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %d is still %s", jobId, job.Status)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func waitJob(t *testing.T, svc *ModuleKnowledgeImpl, jobId uint) dto.JobDTO {
+	job := waitFinished(t, svc, jobId)
+	if job.Status == model.JobStatusFailed {
+		t.Fatalf("job %d failed: %s", jobId, job.Error)
+	}
+	return job
+}
+
+func TestUploadQuery(t *testing.T) {
+	svc := newTestService(t, llm.NewFake())
+	ctx := context.Background()
+
+	content := "第一条 职工因公出差的住宿费按照城市类别分档报销，一类城市每人每天不超过五百元。" +
+		"第二条 机房空调每周巡检一次，巡检记录保存三年。" +
+		"第三条 会议室需要提前一天在系统中预约，使用后恢复桌椅摆放。"
+	uploaded, err := svc.Upload(ctx, v3.FileModel{
+		Filename: "制度.txt",
+		Reader:   io.NopCloser(strings.NewReader(content)),
+	}, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := waitJob(t, svc, uploaded.JobId)
+	if job.ChunksTotal < 2 {
+		t.Fatalf("chunks = %d, want at least 2", job.ChunksTotal)
+	}
+
+	results, err := svc.GetQuery(ctx, dto.QueryReq{
+		Text:          "出差住宿费怎么报销",
+		RetrieveLimit: 3,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) == 0 {
+		t.Fatal("no results")
+	}
+	if results[0].FileId != uploaded.Id || !strings.Contains(results[0].Content, "住宿费") {
+		t.Fatalf("top result = %+v", results[0])
+	}
+
+	// 相同内容再次上传直接复用，不重新入库
+	again, err := svc.Upload(ctx, v3.FileModel{
+		Filename: "制度.txt",
+		Reader:   io.NopCloser(strings.NewReader(content)),
+	}, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !again.Duplicate || again.Id != uploaded.Id {
+		t.Fatalf("second upload = %+v", again)
+	}
+}
+
+// newDocx 生成只包含一段文字和一张图片的 DOCX
+func newDocx(t *testing.T, text string) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	img.Set(1, 1, color.RGBA{R: 255, A: 255})
+	var pngData bytes.Buffer
+	if err := png.Encode(&pngData, img); err != nil {
+		t.Fatal(err)
+	}
+
+	parts := map[string]string{
+		"word/document.xml": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"
+ xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"
+ xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main">
+<w:body>
+<w:p><w:r><w:t>` + text + `</w:t></w:r></w:p>
+<w:p><w:r><w:drawing><a:graphic><a:graphicData><a:blip r:embed="rId1"/></a:graphicData></a:graphic></w:drawing></w:r></w:p>
+</w:body>
+</w:document>`,
+		"word/_rels/document.xml.rels": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/image" Target="media/image1.png"/>
+</Relationships>`,
+		"word/media/image1.png": pngData.String(),
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range parts {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestUploadImage(t *testing.T) {
+	fake := llm.NewFake(llm.Reply{
+		Chunks: []string{"图片文字: 组织架构图\n图片描述: 一张展示各部门汇报关系的组织架构图"},
+	})
+	svc := newTestService(t, fake)
+	ctx := context.Background()
+
+	uploaded, err := svc.Upload(ctx, v3.FileModel{
+		Filename: "组织.docx",
+		Reader:   io.NopCloser(bytes.NewReader(newDocx(t, "本制度适用于全体员工。"))),
+	}, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := waitJob(t, svc, uploaded.JobId)
+	if job.ImagesTotal != 1 || job.ImagesAnalysed != 1 {
+		t.Fatalf("images = %d/%d, want 1/1", job.ImagesAnalysed, job.ImagesTotal)
+	}
+
+	// 多模态模型收到的是图片的 data URL 和提示词
+	calls := fake.Calls()
+	if len(calls) != 1 {
+		t.Fatalf("calls = %d, want 1", len(calls))
+	}
+	imagePart, ok := calls[0][0].Parts[0].(llms.ImageURLContent)
+	if !ok || !strings.HasPrefix(imagePart.URL, "data:image/png;base64,") {
+		t.Fatalf("first part = %#v", calls[0][0].Parts[0])
+	}
+
+	results, err := svc.GetQuery(ctx, dto.QueryReq{
+		Text:          "部门组织架构图",
+		RetrieveLimit: 5,
+		Filter: &dto.QueryFilter{
+			Type: "image",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || !strings.Contains(results[0].Content, "汇报关系") || results[0].Image == "" {
+		t.Fatalf("results = %+v", results)
+	}
+}
+
+func TestUploadContentType(t *testing.T) {
+	svc := newTestService(t, llm.NewFake())
+	ctx := context.Background()
+
+	// 没有扩展名时按嗅探出的 MIME 类型选择加载器
+	uploaded := upload(t, svc, "说明", "机房空调每周巡检一次，巡检记录保存三年。", "")
+	results, err := svc.GetQuery(ctx, dto.QueryReq{Text: "机房巡检", RetrieveLimit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].FileId != uploaded.Id {
+		t.Fatalf("results = %+v", results)
+	}
+
+	defer func() {
+		if r := recover(); r == nil || !strings.Contains(fmt.Sprint(r), "unsupported file type") {
+			t.Fatalf("recovered = %v", r)
+		}
+	}()
+	_, _ = svc.Upload(ctx, v3.FileModel{
+		Filename: "数据.bin",
+		Reader:   io.NopCloser(bytes.NewReader([]byte{0x00, 0x01, 0x02, 0xff})),
+	}, nil, nil, nil)
+}
+
+func TestDeleteFile(t *testing.T) {
+	fake := llm.NewFake(llm.Reply{
+		Chunks: []string{"图片描述: 一张展示各部门汇报关系的组织架构图"},
+	})
+	svc := newTestService(t, fake)
+	ctx := context.Background()
+
+	uploaded, err := svc.Upload(ctx, v3.FileModel{
+		Filename: "组织.docx",
+		Reader:   io.NopCloser(bytes.NewReader(newDocx(t, "本制度适用于全体员工。"))),
+	}, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitJob(t, svc, uploaded.JobId)
+	kept := upload(t, svc, "差旅制度.txt", "出差住宿费一类城市每天不超过五百元。", "")
+	kb := svc.base(svc.defaultKbId)
+	file := dao.GetFileRepo().Get(ctx, uploaded.Id)
+	if len(file.Images) != 1 {
+		t.Fatalf("images = %v", file.Images)
+	}
+
+	if err = svc.DeleteFile(ctx, uploaded.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	// 向量、分块、原文件和图片都删除了，其他文件不受影响
+	chunks := dao.GetChunkRepo().ListByKb(ctx, kb.ID)
+	if got := countVectors(t, kb); got != len(chunks) || got == 0 {
+		t.Fatalf("vectors = %d, chunks = %d", got, len(chunks))
+	}
+	keptFile := dao.GetFileRepo().Get(ctx, kept.Id)
+	for _, item := range chunks {
+		if item.File != keptFile.Path {
+			t.Fatalf("chunk of %s left behind", item.File)
+		}
+	}
+	for _, path := range append(file.Images, file.Path, filepath.Dir(file.Path)) {
+		if _, err = os.Stat(path); !os.IsNotExist(err) {
+			t.Fatalf("%s should be removed: %v", path, err)
+		}
+	}
+	for _, mode := range []string{retrievalModeVector, retrievalModeKeyword} {
+		results, err := svc.GetQuery(ctx, dto.QueryReq{Text: "组织架构图 全体员工", RetrieveLimit: 5, Mode: mode})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, item := range results {
+			if item.FileId != kept.Id {
+				t.Fatalf("%s results = %+v", mode, results)
+			}
+		}
+	}
+	files, err := svc.GetList(ctx, dto.GetListReq{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Id != kept.Id {
+		t.Fatalf("files = %+v", files)
+	}
+
+	defer func() {
+		if r := recover(); r == nil || !strings.Contains(fmt.Sprint(r), "file not found") {
+			t.Fatalf("recovered = %v", r)
+		}
+	}()
+	_ = svc.DeleteFile(ctx, uploaded.Id)
+}
+
+func TestVersions(t *testing.T) {
+	svc := newTestService(t, llm.NewFake())
+	ctx := context.Background()
+	queryFile := func() uint {
+		results, err := svc.GetQuery(ctx, dto.QueryReq{Text: "住宿费", RetrieveLimit: 5})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 1 {
+			t.Fatalf("results = %+v", results)
+		}
+		return results[0].FileId
+	}
+
+	first := upload(t, svc, "差旅制度.txt", "出差住宿费一类城市每天不超过五百元。", "finance")
+	// 未指定标签时沿用上一个版本的标签
+	second, err := svc.Upload(ctx, v3.FileModel{
+		Filename: "差旅制度.txt",
+		Reader:   io.NopCloser(strings.NewReader("出差住宿费一类城市每天不超过六百元。")),
+	}, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitJob(t, svc, second.JobId)
+	if first.Version != 1 || second.Version != 2 || second.Duplicate {
+		t.Fatalf("versions = %d, %d", first.Version, second.Version)
+	}
+	if got := queryFile(); got != second.Id {
+		t.Fatalf("query hits file %d, want %d", got, second.Id)
+	}
+
+	files, err := svc.GetList(ctx, dto.GetListReq{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Id != second.Id || !files[0].Current || len(files[0].Tags) != 1 || files[0].Tags[0] != "finance" {
+		t.Fatalf("files = %+v", files)
+	}
+	versions := lo.Map(files[0].Versions, func(item dto.FileVersionDTO, index int) string {
+		return fmt.Sprintf("%d:%v", item.Version, item.Current)
+	})
+	if strings.Join(versions, ",") != "2:true,1:false" {
+		t.Fatalf("versions = %v", versions)
+	}
+
+	// 重新上传旧版本的内容时重新入库，旧版本重新成为当前版本
+	again := upload(t, svc, "差旅制度.txt", "出差住宿费一类城市每天不超过五百元。", "finance")
+	if !again.Duplicate || again.Id != first.Id || again.JobId == first.JobId {
+		t.Fatalf("again = %+v", again)
+	}
+	if got := queryFile(); got != first.Id {
+		t.Fatalf("query hits file %d, want %d", got, first.Id)
+	}
+
+	// 删除历史版本只删除该版本，删除当前版本时删除全部版本
+	if err = svc.DeleteFile(ctx, second.Id); err != nil {
+		t.Fatal(err)
+	}
+	if files, _ = svc.GetList(ctx, dto.GetListReq{}); len(files) != 1 || len(files[0].Versions) != 1 || queryFile() != first.Id {
+		t.Fatalf("files = %+v", files)
+	}
+	if err = svc.DeleteFile(ctx, first.Id); err != nil {
+		t.Fatal(err)
+	}
+	if files, _ = svc.GetList(ctx, dto.GetListReq{}); len(files) != 0 {
+		t.Fatalf("files = %+v", files)
+	}
+}
+
+func TestQuerySourceMetadata(t *testing.T) {
+	svc := newTestService(t, llm.NewFake())
+	ctx := context.Background()
+
+	uploaded := upload(t, svc, "制度.txt", "第一条 职工因公出差的住宿费按照城市类别分档报销，一类城市每人每天不超过五百元。"+
+		"第二条 机房空调每周巡检一次，巡检记录需要由值班人员签字确认并保存三年以上。", "")
+	results, err := svc.GetQuery(ctx, dto.QueryReq{Text: "住宿费 巡检", RetrieveLimit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) < 2 {
+		t.Fatalf("results = %+v", results)
+	}
+	indexes := make(map[int]bool)
+	for _, item := range results {
+		if item.KbId != svc.defaultKbId || item.FileId != uploaded.Id || item.FileName != "制度.txt" ||
+			item.Page != 0 || item.TotalPages != 1 || item.Type != "text" || item.Image != "" {
+			t.Fatalf("result = %+v", item)
+		}
+		indexes[item.ChunkIndex] = true
+	}
+	for i := range results {
+		if !indexes[i] {
+			t.Fatalf("chunk indexes = %v", indexes)
+		}
+	}
+
+	// 早期入库的分块只有文件路径，按路径补齐文件信息，分块序号为 -1
+	kb := svc.base(svc.defaultKbId)
+	file := dao.GetFileRepo().Get(ctx, uploaded.Id)
+	content := "会议室需要提前一天预约。"
+	vector, err := kb.queryFunc(ctx, content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = kb.collection.Add(ctx, []vectorstore.Document{{
+		ID:        "legacy",
+		Content:   content,
+		Metadata:  map[string]string{"file": file.Path, "page": "0", "total_pages": "1", "type": "text"},
+		Embedding: vector,
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	results, err = svc.GetQuery(ctx, dto.QueryReq{Text: content, RetrieveLimit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].ID != "legacy" || results[0].FileId != uploaded.Id ||
+		results[0].FileName != "制度.txt" || results[0].ChunkIndex != -1 {
+		t.Fatalf("legacy result = %+v", results)
+	}
+}
@@ -15,6 +15,16 @@ type ModuleKnowledgeHandler interface {
 	Upload(w http.ResponseWriter, r *http.Request)
 	GetList(w http.ResponseWriter, r *http.Request)
 	GetQuery(w http.ResponseWriter, r *http.Request)
+	DeleteFile(w http.ResponseWriter, r *http.Request)
+	GetJobs(w http.ResponseWriter, r *http.Request)
+	GetJobs_Id(w http.ResponseWriter, r *http.Request)
+	PostKb(w http.ResponseWriter, r *http.Request)
+	GetKb(w http.ResponseWriter, r *http.Request)
+	GetKb_Id(w http.ResponseWriter, r *http.Request)
+	PutKb_Id(w http.ResponseWriter, r *http.Request)
+	DeleteKb_Id(w http.ResponseWriter, r *http.Request)
+	GetEmbeddingCache(w http.ResponseWriter, r *http.Request)
+	PostKb_IdReembed(w http.ResponseWriter, r *http.Request)
 }
 
 func Routes(handler ModuleKnowledgeHandler) []rest.Route {
@@ -37,10 +47,79 @@ func Routes(handler ModuleKnowledgeHandler) []rest.Route {
 			Pattern:     "/query",
 			HandlerFunc: handler.GetQuery,
 		},
+		{
+			Name:        "DeleteFile",
+			Method:      "DELETE",
+			Pattern:     "/file",
+			HandlerFunc: handler.DeleteFile,
+		},
+		{
+			Name:        "GetJobs",
+			Method:      "GET",
+			Pattern:     "/jobs",
+			HandlerFunc: handler.GetJobs,
+		},
+		{
+			Name:        "GetJobs_Id",
+			Method:      "GET",
+			Pattern:     "/jobs/:id",
+			HandlerFunc: handler.GetJobs_Id,
+		},
+		{
+			Name:        "PostKb",
+			Method:      "POST",
+			Pattern:     "/kb",
+			HandlerFunc: handler.PostKb,
+		},
+		{
+			Name:        "GetKb",
+			Method:      "GET",
+			Pattern:     "/kb",
+			HandlerFunc: handler.GetKb,
+		},
+		{
+			Name:        "GetKb_Id",
+			Method:      "GET",
+			Pattern:     "/kb/:id",
+			HandlerFunc: handler.GetKb_Id,
+		},
+		{
+			Name:        "PutKb_Id",
+			Method:      "PUT",
+			Pattern:     "/kb/:id",
+			HandlerFunc: handler.PutKb_Id,
+		},
+		{
+			Name:        "DeleteKb_Id",
+			Method:      "DELETE",
+			Pattern:     "/kb/:id",
+			HandlerFunc: handler.DeleteKb_Id,
+		},
+		{
+			Name:        "GetEmbeddingCache",
+			Method:      "GET",
+			Pattern:     "/embedding/cache",
+			HandlerFunc: handler.GetEmbeddingCache,
+		},
+		{
+			Name:        "PostKb_IdReembed",
+			Method:      "POST",
+			Pattern:     "/kb/:id/reembed",
+			HandlerFunc: handler.PostKb_IdReembed,
+		},
 	}
 }
 
-var RouteAnnotationStore = framework.AnnotationStore{}
+var RouteAnnotationStore = framework.AnnotationStore{
+	"PostKb_IdReembed": {
+		{
+			Name: "@role",
+			Params: []string{
+				"admin",
+			},
+		},
+	},
+}
 
 func init() {
 	framework.RegisterAnnotationStore(RouteAnnotationStore)
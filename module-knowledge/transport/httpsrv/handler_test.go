@@ -0,0 +1,20 @@
+package httpsrv
+
+import (
+	"testing"
+
+	"go-doudou-rag/toolkit/auth"
+)
+
+func TestReembedAdminOnly(t *testing.T) {
+	am := &auth.AuthMiddleware{Admins: []string{"admin"}}
+	if am.Allowed("PostKb_IdReembed", auth.UserInfo{Username: "alice"}) {
+		t.Fatal("non-admin users should not reembed")
+	}
+	if !am.Allowed("PostKb_IdReembed", auth.UserInfo{Username: "admin"}) {
+		t.Fatal("admins should reembed")
+	}
+	if !am.Allowed("GetKb", auth.UserInfo{Username: "alice"}) {
+		t.Fatal("GetKb should not require admin")
+	}
+}
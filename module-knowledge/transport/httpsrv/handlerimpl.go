@@ -13,6 +13,8 @@ import (
 
 	"github.com/bytedance/sonic"
 	"github.com/unionj-cloud/go-doudou/v2/framework/rest"
+	"github.com/unionj-cloud/go-doudou/v2/framework/rest/httprouter"
+	"github.com/unionj-cloud/toolkit/cast"
 	v3 "github.com/unionj-cloud/toolkit/openapi/v3"
 )
 
@@ -24,10 +26,13 @@ type ModuleKnowledgeHandlerImpl struct {
 
 func (receiver *ModuleKnowledgeHandlerImpl) Upload(_writer http.ResponseWriter, _req *http.Request) {
 	var (
-		ctx  context.Context
-		file v3.FileModel
-		data dto.UploadResult
-		err  error
+		ctx           context.Context
+		file          v3.FileModel
+		kbId          *uint
+		chunkStrategy *string
+		tags          *string
+		data          dto.UploadResult
+		err           error
 	)
 	ctx = _req.Context()
 	if _err := _req.ParseMultipartForm(32 << 20); _err != nil {
@@ -52,9 +57,27 @@ func (receiver *ModuleKnowledgeHandlerImpl) Upload(_writer http.ResponseWriter,
 	} else {
 		rest.HandleBadRequestErr(errors.New("missing parameter file"))
 	}
+	if _, exists := _req.Form["kbId"]; exists {
+		if casted, _err := cast.ToUintE(_req.FormValue("kbId")); _err != nil {
+			rest.HandleBadRequestErr(_err)
+		} else {
+			kbId = &casted
+		}
+	}
+	if _, exists := _req.Form["chunkStrategy"]; exists {
+		_chunkStrategy := _req.FormValue("chunkStrategy")
+		chunkStrategy = &_chunkStrategy
+	}
+	if _, exists := _req.Form["tags"]; exists {
+		_tags := _req.FormValue("tags")
+		tags = &_tags
+	}
 	data, err = receiver.moduleKnowledge.Upload(
 		ctx,
 		file,
+		kbId,
+		chunkStrategy,
+		tags,
 	)
 	if err != nil {
 		panic(err)
@@ -144,3 +167,317 @@ func (receiver *ModuleKnowledgeHandlerImpl) GetList(_writer http.ResponseWriter,
 		rest.HandleInternalServerError(_err)
 	}
 }
+
+func (receiver *ModuleKnowledgeHandlerImpl) GetJobs(_writer http.ResponseWriter, _req *http.Request) {
+	var (
+		ctx  context.Context
+		req  dto.GetJobsReq
+		data []dto.JobDTO
+		err  error
+	)
+	ctx = _req.Context()
+	if _err := _req.ParseForm(); _err != nil {
+		rest.HandleBadRequestErr(_err)
+	}
+	if _err := rest.DecodeForm(&req, _req.Form); _err != nil {
+		rest.HandleBadRequestErr(_err)
+	} else {
+		if _err := rest.ValidateStruct(req); _err != nil {
+			rest.HandleBadRequestErr(_err)
+		}
+	}
+	data, err = receiver.moduleKnowledge.GetJobs(
+		ctx,
+		req,
+	)
+	if err != nil {
+		panic(err)
+	}
+	_writer.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if _err := json.NewEncoder(_writer).Encode(struct {
+		Data []dto.JobDTO `json:"data"`
+	}{
+		Data: data,
+	}); _err != nil {
+		rest.HandleInternalServerError(_err)
+	}
+}
+
+func (receiver *ModuleKnowledgeHandlerImpl) GetJobs_Id(_writer http.ResponseWriter, _req *http.Request) {
+	var (
+		ctx  context.Context
+		id   uint
+		data dto.JobDTO
+		err  error
+	)
+	ctx = _req.Context()
+	paramsFromCtx := httprouter.ParamsFromContext(_req.Context())
+	if casted, _err := cast.ToUintE(paramsFromCtx.ByName("id")); _err != nil {
+		rest.HandleBadRequestErr(_err)
+	} else {
+		id = casted
+	}
+	data, err = receiver.moduleKnowledge.GetJobs_Id(
+		ctx,
+		id,
+	)
+	if err != nil {
+		panic(err)
+	}
+	_writer.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if _err := json.NewEncoder(_writer).Encode(struct {
+		Data dto.JobDTO `json:"data"`
+	}{
+		Data: data,
+	}); _err != nil {
+		rest.HandleInternalServerError(_err)
+	}
+}
+
+func (receiver *ModuleKnowledgeHandlerImpl) DeleteFile(_writer http.ResponseWriter, _req *http.Request) {
+	var (
+		ctx context.Context
+		id  uint
+		err error
+	)
+	ctx = _req.Context()
+	if _err := _req.ParseForm(); _err != nil {
+		rest.HandleBadRequestErr(_err)
+	}
+	if _, exists := _req.Form["id"]; exists {
+		if casted, _err := cast.ToUintE(_req.FormValue("id")); _err != nil {
+			rest.HandleBadRequestErr(_err)
+		} else {
+			id = casted
+		}
+	} else {
+		rest.HandleBadRequestErr(errors.New("missing parameter id"))
+	}
+	err = receiver.moduleKnowledge.DeleteFile(
+		ctx,
+		id,
+	)
+	if err != nil {
+		panic(err)
+	}
+	_writer.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if _err := json.NewEncoder(_writer).Encode(struct {
+	}{}); _err != nil {
+		rest.HandleInternalServerError(_err)
+	}
+}
+
+func (receiver *ModuleKnowledgeHandlerImpl) PostKb(_writer http.ResponseWriter, _req *http.Request) {
+	var (
+		ctx  context.Context
+		req  dto.SaveKbReq
+		data dto.KbDTO
+		err  error
+	)
+	ctx = _req.Context()
+	if _req.Body == nil {
+		rest.HandleBadRequestErr(errors.New("missing request body"))
+	} else {
+		if _err := json.NewDecoder(_req.Body).Decode(&req); _err != nil {
+			rest.HandleBadRequestErr(_err)
+		} else {
+			if _err := rest.ValidateStruct(req); _err != nil {
+				rest.HandleBadRequestErr(_err)
+			}
+		}
+	}
+	data, err = receiver.moduleKnowledge.PostKb(
+		ctx,
+		req,
+	)
+	if err != nil {
+		panic(err)
+	}
+	_writer.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if _err := json.NewEncoder(_writer).Encode(struct {
+		Data dto.KbDTO `json:"data"`
+	}{
+		Data: data,
+	}); _err != nil {
+		rest.HandleInternalServerError(_err)
+	}
+}
+
+func (receiver *ModuleKnowledgeHandlerImpl) GetKb(_writer http.ResponseWriter, _req *http.Request) {
+	var (
+		ctx  context.Context
+		data []dto.KbDTO
+		err  error
+	)
+	ctx = _req.Context()
+	data, err = receiver.moduleKnowledge.GetKb(
+		ctx,
+	)
+	if err != nil {
+		panic(err)
+	}
+	_writer.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if _err := json.NewEncoder(_writer).Encode(struct {
+		Data []dto.KbDTO `json:"data"`
+	}{
+		Data: data,
+	}); _err != nil {
+		rest.HandleInternalServerError(_err)
+	}
+}
+
+func (receiver *ModuleKnowledgeHandlerImpl) GetKb_Id(_writer http.ResponseWriter, _req *http.Request) {
+	var (
+		ctx  context.Context
+		id   uint
+		data dto.KbDTO
+		err  error
+	)
+	ctx = _req.Context()
+	paramsFromCtx := httprouter.ParamsFromContext(_req.Context())
+	if casted, _err := cast.ToUintE(paramsFromCtx.ByName("id")); _err != nil {
+		rest.HandleBadRequestErr(_err)
+	} else {
+		id = casted
+	}
+	data, err = receiver.moduleKnowledge.GetKb_Id(
+		ctx,
+		id,
+	)
+	if err != nil {
+		panic(err)
+	}
+	_writer.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if _err := json.NewEncoder(_writer).Encode(struct {
+		Data dto.KbDTO `json:"data"`
+	}{
+		Data: data,
+	}); _err != nil {
+		rest.HandleInternalServerError(_err)
+	}
+}
+
+func (receiver *ModuleKnowledgeHandlerImpl) PutKb_Id(_writer http.ResponseWriter, _req *http.Request) {
+	var (
+		ctx  context.Context
+		id   uint
+		req  dto.SaveKbReq
+		data dto.KbDTO
+		err  error
+	)
+	ctx = _req.Context()
+	paramsFromCtx := httprouter.ParamsFromContext(_req.Context())
+	if casted, _err := cast.ToUintE(paramsFromCtx.ByName("id")); _err != nil {
+		rest.HandleBadRequestErr(_err)
+	} else {
+		id = casted
+	}
+	if _req.Body == nil {
+		rest.HandleBadRequestErr(errors.New("missing request body"))
+	} else {
+		if _err := json.NewDecoder(_req.Body).Decode(&req); _err != nil {
+			rest.HandleBadRequestErr(_err)
+		} else {
+			if _err := rest.ValidateStruct(req); _err != nil {
+				rest.HandleBadRequestErr(_err)
+			}
+		}
+	}
+	data, err = receiver.moduleKnowledge.PutKb_Id(
+		ctx,
+		id,
+		req,
+	)
+	if err != nil {
+		panic(err)
+	}
+	_writer.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if _err := json.NewEncoder(_writer).Encode(struct {
+		Data dto.KbDTO `json:"data"`
+	}{
+		Data: data,
+	}); _err != nil {
+		rest.HandleInternalServerError(_err)
+	}
+}
+
+func (receiver *ModuleKnowledgeHandlerImpl) DeleteKb_Id(_writer http.ResponseWriter, _req *http.Request) {
+	var (
+		ctx context.Context
+		id  uint
+		err error
+	)
+	ctx = _req.Context()
+	paramsFromCtx := httprouter.ParamsFromContext(_req.Context())
+	if casted, _err := cast.ToUintE(paramsFromCtx.ByName("id")); _err != nil {
+		rest.HandleBadRequestErr(_err)
+	} else {
+		id = casted
+	}
+	err = receiver.moduleKnowledge.DeleteKb_Id(
+		ctx,
+		id,
+	)
+	if err != nil {
+		panic(err)
+	}
+	_writer.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if _err := json.NewEncoder(_writer).Encode(struct {
+	}{}); _err != nil {
+		rest.HandleInternalServerError(_err)
+	}
+}
+
+func (receiver *ModuleKnowledgeHandlerImpl) GetEmbeddingCache(_writer http.ResponseWriter, _req *http.Request) {
+	var (
+		ctx  context.Context
+		data []dto.EmbeddingCacheStats
+		err  error
+	)
+	ctx = _req.Context()
+	data, err = receiver.moduleKnowledge.GetEmbeddingCache(
+		ctx,
+	)
+	if err != nil {
+		panic(err)
+	}
+	_writer.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if _err := json.NewEncoder(_writer).Encode(struct {
+		Data []dto.EmbeddingCacheStats `json:"data"`
+	}{
+		Data: data,
+	}); _err != nil {
+		rest.HandleInternalServerError(_err)
+	}
+}
+
+func (receiver *ModuleKnowledgeHandlerImpl) PostKb_IdReembed(_writer http.ResponseWriter, _req *http.Request) {
+	var (
+		ctx  context.Context
+		id   uint
+		data dto.JobDTO
+		err  error
+	)
+	ctx = _req.Context()
+	paramsFromCtx := httprouter.ParamsFromContext(_req.Context())
+	if casted, _err := cast.ToUintE(paramsFromCtx.ByName("id")); _err != nil {
+		rest.HandleBadRequestErr(_err)
+	} else {
+		id = casted
+	}
+	data, err = receiver.moduleKnowledge.PostKb_IdReembed(
+		ctx,
+		id,
+	)
+	if err != nil {
+		panic(err)
+	}
+	_writer.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if _err := json.NewEncoder(_writer).Encode(struct {
+		Data dto.JobDTO `json:"data"`
+	}{
+		Data: data,
+	}); _err != nil {
+		rest.HandleInternalServerError(_err)
+	}
+}
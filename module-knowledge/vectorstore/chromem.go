@@ -0,0 +1,301 @@
+package vectorstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+
+	"github.com/philippgille/chromem-go"
+)
+
+var _ Store = (*ChromemStore)(nil)
+
+// ChromemOptions chromem 向量库的持久化配置
+type ChromemOptions struct {
+	// 快照文件，预写日志保存在同目录下的 <File>.wal
+	File string
+	// 为空时不加密，否则必须为 32 字节，快照和预写日志都使用该密钥加密
+	EncryptionKey string
+	// 预写日志超过该字节数时在 Persist 中合并成新的快照，小于等于 0 时每次 Persist 都合并
+	CompactSize int64
+}
+
+// ChromemStore 基于 chromem-go 的内存向量库。每次写操作先追加到预写日志再修改内存，
+// Persist 时日志足够大才把内存整体导出成新的快照并清空日志，快照通过临时文件加重命名原子替换。
+// 合并过程中崩溃时日志里的操作会在已经包含它们的快照上再回放一次，写入按 ID 覆盖、删除按条件执行，结果不变
+type ChromemStore struct {
+	db   *chromem.DB
+	opts ChromemOptions
+	wal  *wal
+	// 串行化写操作和合并，保证日志顺序与内存中的执行顺序一致
+	mu sync.Mutex
+}
+
+// NewChromem 创建 chromem 向量库，先导入快照再回放预写日志。快照或者日志损坏、密钥不对时返回错误，
+// 不会以空库启动
+func NewChromem(opts ChromemOptions) (*ChromemStore, error) {
+	if opts.File == "" {
+		return nil, errors.New("vector store file is empty")
+	}
+	if opts.EncryptionKey != "" && len(opts.EncryptionKey) != 32 {
+		return nil, errors.New("encryption key must be 32 bytes long")
+	}
+	if err := os.MkdirAll(filepath.Dir(opts.File), 0o700); err != nil {
+		return nil, err
+	}
+
+	db := chromem.NewDB()
+	if _, err := os.Stat(opts.File); err == nil {
+		if err = db.ImportFromFile(opts.File, opts.EncryptionKey); err != nil {
+			return nil, fmt.Errorf("import vector store %s: %w", opts.File, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	w, err := openWAL(opts.File+".wal", opts.EncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	store := &ChromemStore{
+		db:   db,
+		opts: opts,
+		wal:  w,
+	}
+	if err = w.replay(func(record walRecord) error {
+		return store.apply(context.Background(), record)
+	}); err != nil {
+		w.close()
+		return nil, fmt.Errorf("replay vector store wal %s: %w", opts.File+".wal", err)
+	}
+
+	return store, nil
+}
+
+// 向量都由调用方计算好再写入，集合本身不需要向量化
+func noEmbedding(ctx context.Context, text string) ([]float32, error) {
+	return nil, errors.New("embedding must be computed before adding documents")
+}
+
+func (receiver *ChromemStore) Collection(name string) (Collection, error) {
+	if _, err := receiver.db.GetOrCreateCollection(name, nil, noEmbedding); err != nil {
+		return nil, err
+	}
+	return &chromemCollection{
+		store: receiver,
+		name:  name,
+	}, nil
+}
+
+func (receiver *ChromemStore) DeleteCollection(name string) error {
+	return receiver.write(context.Background(), walRecord{
+		Op:         walOpDrop,
+		Collection: name,
+	})
+}
+
+func (receiver *ChromemStore) Persist() error {
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+
+	if receiver.wal.size == 0 || receiver.wal.size < receiver.opts.CompactSize {
+		return nil
+	}
+	return receiver.compact()
+}
+
+// compact 把内存中的全部集合写成新的快照并清空预写日志，调用方需要持有 mu
+func (receiver *ChromemStore) compact() error {
+	tmp := receiver.opts.File + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if err = receiver.db.ExportToWriter(f, false, receiver.opts.EncryptionKey); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err = f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err = os.Rename(tmp, receiver.opts.File); err != nil {
+		return err
+	}
+	// 目录也需要落盘，否则重命名本身可能在断电后丢失
+	if dir, err := os.Open(filepath.Dir(receiver.opts.File)); err == nil {
+		_ = dir.Sync()
+		dir.Close()
+	}
+
+	return receiver.wal.reset()
+}
+
+// write 先写预写日志再修改内存
+func (receiver *ChromemStore) write(ctx context.Context, record walRecord) error {
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+
+	if err := receiver.wal.append(record); err != nil {
+		return err
+	}
+	return receiver.apply(ctx, record)
+}
+
+func (receiver *ChromemStore) apply(ctx context.Context, record walRecord) error {
+	switch record.Op {
+	case walOpAdd:
+		c, err := receiver.db.GetOrCreateCollection(record.Collection, nil, noEmbedding)
+		if err != nil {
+			return err
+		}
+		docs := make([]chromem.Document, 0, len(record.Documents))
+		for _, item := range record.Documents {
+			docs = append(docs, chromem.Document{
+				ID:        item.ID,
+				Content:   item.Content,
+				Metadata:  item.Metadata,
+				Embedding: item.Embedding,
+			})
+		}
+		return c.AddDocuments(ctx, docs, runtime.NumCPU())
+	case walOpDelete:
+		c := receiver.db.GetCollection(record.Collection, noEmbedding)
+		if c == nil {
+			return nil
+		}
+		return c.Delete(ctx, record.Where, nil)
+	case walOpDrop:
+		return receiver.db.DeleteCollection(record.Collection)
+	default:
+		return fmt.Errorf("unknown wal operation: %s", record.Op)
+	}
+}
+
+type chromemCollection struct {
+	store *ChromemStore
+	name  string
+}
+
+// collection 集合被删除后返回 nil
+func (receiver *chromemCollection) collection() *chromem.Collection {
+	return receiver.store.db.GetCollection(receiver.name, noEmbedding)
+}
+
+func (receiver *chromemCollection) Add(ctx context.Context, documents []Document) error {
+	if len(documents) == 0 {
+		return nil
+	}
+	// 先校验再写日志，避免日志中出现回放时必然失败的记录
+	for _, item := range documents {
+		if item.ID == "" || len(item.Embedding) == 0 {
+			return fmt.Errorf("document %q has no ID or embedding", item.ID)
+		}
+	}
+	return receiver.store.write(ctx, walRecord{
+		Op:         walOpAdd,
+		Collection: receiver.name,
+		Documents:  documents,
+	})
+}
+
+func (receiver *chromemCollection) Delete(ctx context.Context, where map[string]string) error {
+	if len(where) == 0 {
+		return errors.New("where must not be empty")
+	}
+	return receiver.store.write(ctx, walRecord{
+		Op:         walOpDelete,
+		Collection: receiver.name,
+		Where:      where,
+	})
+}
+
+func (receiver *chromemCollection) Query(ctx context.Context, embedding []float32, n int, filter Filter) ([]Result, error) {
+	c := receiver.collection()
+	if c == nil {
+		return nil, nil
+	}
+	// chromem 要求 n 不超过集合中的分块数量
+	n = min(n, c.Count())
+	if n <= 0 {
+		return nil, nil
+	}
+
+	var whereDocument map[string]string
+	if filter.Contains != "" || filter.NotContains != "" {
+		whereDocument = make(map[string]string)
+		if filter.Contains != "" {
+			whereDocument["$contains"] = filter.Contains
+		}
+		if filter.NotContains != "" {
+			whereDocument["$not_contains"] = filter.NotContains
+		}
+	}
+
+	// chromem 只支持元数据等值和内容包含、不包含，其余条件取回全部满足这些条件的分块后再过滤
+	postFilter := len(filter.MetadataContains) > 0 || len(filter.Ranges) > 0
+	queryResults := n
+	if postFilter {
+		queryResults = c.Count()
+	}
+	items, err := c.QueryEmbedding(ctx, embedding, queryResults, filter.Where, whereDocument)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]Result, 0, len(items))
+	for _, item := range items {
+		if len(results) >= n {
+			break
+		}
+		if postFilter && !filter.Match(item.Metadata, item.Content) {
+			continue
+		}
+		results = append(results, Result{
+			Document: Document{
+				ID:        item.ID,
+				Content:   item.Content,
+				Metadata:  item.Metadata,
+				Embedding: item.Embedding,
+			},
+			Similarity: item.Similarity,
+		})
+	}
+	return results, nil
+}
+
+func (receiver *chromemCollection) Get(ctx context.Context, id string) (*Document, error) {
+	c := receiver.collection()
+	if c == nil {
+		return nil, nil
+	}
+	// chromem 只在 ID 为空或者不存在时返回错误
+	doc, err := c.GetByID(ctx, id)
+	if err != nil {
+		return nil, nil
+	}
+	return &Document{
+		ID:        doc.ID,
+		Content:   doc.Content,
+		Metadata:  doc.Metadata,
+		Embedding: doc.Embedding,
+	}, nil
+}
+
+func (receiver *chromemCollection) Count(ctx context.Context) (int, error) {
+	c := receiver.collection()
+	if c == nil {
+		return 0, nil
+	}
+	return c.Count(), nil
+}
@@ -0,0 +1,240 @@
+package vectorstore
+
+import (
+	"container/heap"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var _ TxStore = (*SQLiteStore)(nil)
+
+// vector 向量表的一行，全部集合共用一张表
+type vector struct {
+	Collection string            `gorm:"primaryKey"`
+	ID         string            `gorm:"primaryKey"`
+	Content    string            `gorm:"type:text"`
+	Metadata   map[string]string `gorm:"serializer:json"`
+	// 归一化后的向量，按小端序依次保存 float32
+	Embedding []byte
+	CreatedAt time.Time
+}
+
+func (vector) TableName() string {
+	return "vectors"
+}
+
+// SQLiteStore 把向量保存在知识库数据库的 vectors 表中，与文件、分块记录在同一个库里，
+// 写入即持久化。检索时在满足条件的行上逐行计算相似度
+type SQLiteStore struct {
+	db *gorm.DB
+}
+
+// NewSQLite 创建 SQLite 向量库，自动建表
+func NewSQLite(db *gorm.DB) (*SQLiteStore, error) {
+	if err := db.AutoMigrate(&vector{}); err != nil {
+		return nil, err
+	}
+	return &SQLiteStore{
+		db: db,
+	}, nil
+}
+
+func (receiver *SQLiteStore) WithTx(tx *gorm.DB) Store {
+	return &SQLiteStore{
+		db: tx,
+	}
+}
+
+func (receiver *SQLiteStore) Collection(name string) (Collection, error) {
+	return &sqliteCollection{
+		db:   receiver.db,
+		name: name,
+	}, nil
+}
+
+func (receiver *SQLiteStore) DeleteCollection(name string) error {
+	return receiver.db.Where("collection = ?", name).Delete(&vector{}).Error
+}
+
+func (receiver *SQLiteStore) Persist() error {
+	return nil
+}
+
+type sqliteCollection struct {
+	db   *gorm.DB
+	name string
+}
+
+func (receiver *sqliteCollection) Add(ctx context.Context, documents []Document) error {
+	if len(documents) == 0 {
+		return nil
+	}
+	rows := make([]*vector, 0, len(documents))
+	for _, item := range documents {
+		if len(item.Embedding) == 0 {
+			return fmt.Errorf("document %s has no embedding", item.ID)
+		}
+		rows = append(rows, &vector{
+			Collection: receiver.name,
+			ID:         item.ID,
+			Content:    item.Content,
+			Metadata:   item.Metadata,
+			Embedding:  encode(normalize(item.Embedding)),
+		})
+	}
+	return receiver.db.WithContext(ctx).Clauses(clause.OnConflict{UpdateAll: true}).CreateInBatches(rows, 100).Error
+}
+
+func (receiver *sqliteCollection) Delete(ctx context.Context, where map[string]string) error {
+	if len(where) == 0 {
+		return errors.New("where must not be empty")
+	}
+	return receiver.where(ctx, Filter{Where: where}).Delete(&vector{}).Error
+}
+
+func (receiver *sqliteCollection) Query(ctx context.Context, embedding []float32, n int, filter Filter) ([]Result, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+	if len(embedding) == 0 {
+		return nil, errors.New("embedding is empty")
+	}
+	embedding = normalize(embedding)
+
+	rows, err := receiver.where(ctx, filter).Model(&vector{}).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// 小顶堆，只保留相似度最高的 n 个
+	top := &resultHeap{}
+	for rows.Next() {
+		var row vector
+		if err = receiver.db.ScanRows(rows, &row); err != nil {
+			return nil, err
+		}
+		docEmbedding := decode(row.Embedding)
+		if len(docEmbedding) != len(embedding) {
+			return nil, fmt.Errorf("embedding dimension %d does not match document %s with dimension %d", len(embedding), row.ID, len(docEmbedding))
+		}
+		similarity := dot(embedding, docEmbedding)
+		if top.Len() == n && similarity <= (*top)[0].Similarity {
+			continue
+		}
+		heap.Push(top, Result{
+			Document:   row.document(docEmbedding),
+			Similarity: similarity,
+		})
+		if top.Len() > n {
+			heap.Pop(top)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	results := []Result(*top)
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Similarity > results[j].Similarity
+	})
+	return results, nil
+}
+
+func (receiver *sqliteCollection) Get(ctx context.Context, id string) (*Document, error) {
+	var row vector
+	if err := receiver.db.WithContext(ctx).Where("collection = ? and id = ?", receiver.name, id).Take(&row).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	doc := row.document(decode(row.Embedding))
+	return &doc, nil
+}
+
+func (receiver *sqliteCollection) Count(ctx context.Context) (int, error) {
+	var count int64
+	if err := receiver.db.WithContext(ctx).Model(&vector{}).Where("collection = ?", receiver.name).Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return int(count), nil
+}
+
+// where 把检索条件转换成 SQL，元数据条件使用 json_extract
+func (receiver *sqliteCollection) where(ctx context.Context, filter Filter) *gorm.DB {
+	tx := receiver.db.WithContext(ctx).Where("collection = ?", receiver.name)
+	for key, value := range filter.Where {
+		tx = tx.Where("json_extract(metadata, ?) = ?", fmt.Sprintf("$.%q", key), value)
+	}
+	if filter.Contains != "" {
+		tx = tx.Where("instr(content, ?) > 0", filter.Contains)
+	}
+	if filter.NotContains != "" {
+		tx = tx.Where("instr(content, ?) = 0", filter.NotContains)
+	}
+	for key, value := range filter.MetadataContains {
+		tx = tx.Where("instr(json_extract(metadata, ?), ?) > 0", fmt.Sprintf("$.%q", key), value)
+	}
+	for key, r := range filter.Ranges {
+		// 元数据中的值都是字符串，按整数比较
+		path := fmt.Sprintf("$.%q", key)
+		if r.From != nil {
+			tx = tx.Where("CAST(json_extract(metadata, ?) AS INTEGER) >= ?", path, *r.From)
+		}
+		if r.To != nil {
+			tx = tx.Where("CAST(json_extract(metadata, ?) AS INTEGER) <= ?", path, *r.To)
+		}
+	}
+	return tx
+}
+
+func (receiver vector) document(embedding []float32) Document {
+	return Document{
+		ID:        receiver.ID,
+		Content:   receiver.Content,
+		Metadata:  receiver.Metadata,
+		Embedding: embedding,
+	}
+}
+
+func encode(embedding []float32) []byte {
+	buf := make([]byte, 4*len(embedding))
+	for i, item := range embedding {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(item))
+	}
+	return buf
+}
+
+func decode(buf []byte) []float32 {
+	embedding := make([]float32, len(buf)/4)
+	for i := range embedding {
+		embedding[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[4*i:]))
+	}
+	return embedding
+}
+
+type resultHeap []Result
+
+func (h resultHeap) Len() int           { return len(h) }
+func (h resultHeap) Less(i, j int) bool { return h[i].Similarity < h[j].Similarity }
+func (h resultHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *resultHeap) Push(x any) {
+	*h = append(*h, x.(Result))
+}
+
+func (h *resultHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
@@ -0,0 +1,131 @@
+package vectorstore
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Document 向量库中的一个分块，写入前调用方需要计算好向量
+type Document struct {
+	ID        string
+	Content   string
+	Metadata  map[string]string
+	Embedding []float32
+}
+
+// Result 向量检索命中的分块，Similarity 为余弦相似度
+type Result struct {
+	Document
+	Similarity float32
+}
+
+// Filter 检索条件，各条件之间是且的关系
+type Filter struct {
+	// 元数据等值条件
+	Where map[string]string
+	// 分块内容需要包含的文本
+	Contains string
+	// 分块内容不能包含的文本
+	NotContains string
+	// 元数据的值需要包含的文本
+	MetadataContains map[string]string
+	// 元数据按整数比较的范围，例如页码
+	Ranges map[string]Range
+}
+
+// Range 整数范围，包含两端，为 nil 的一端不限制
+type Range struct {
+	From *int
+	To   *int
+}
+
+// Match 判断分块是否满足 filter，供无法把条件下推到底层存储的实现在召回后过滤
+func (receiver Filter) Match(metadata map[string]string, content string) bool {
+	for key, value := range receiver.Where {
+		if metadata[key] != value {
+			return false
+		}
+	}
+	if receiver.Contains != "" && !strings.Contains(content, receiver.Contains) {
+		return false
+	}
+	if receiver.NotContains != "" && strings.Contains(content, receiver.NotContains) {
+		return false
+	}
+	for key, value := range receiver.MetadataContains {
+		if !strings.Contains(metadata[key], value) {
+			return false
+		}
+	}
+	for key, r := range receiver.Ranges {
+		value, err := strconv.Atoi(metadata[key])
+		if err != nil {
+			return false
+		}
+		if r.From != nil && value < *r.From {
+			return false
+		}
+		if r.To != nil && value > *r.To {
+			return false
+		}
+	}
+	return true
+}
+
+// Collection 一个知识库对应的向量集合，实现需要是并发安全的
+type Collection interface {
+	// Add 写入分块，ID 相同的分块直接覆盖
+	Add(ctx context.Context, documents []Document) error
+	// Delete 删除元数据满足 where 的全部分块，where 不能为空
+	Delete(ctx context.Context, where map[string]string) error
+	// Query 返回满足 filter 且与 embedding 最相似的至多 n 个分块，按相似度倒序
+	Query(ctx context.Context, embedding []float32, n int, filter Filter) ([]Result, error)
+	// Get 按 ID 获取分块，不存在时返回 nil
+	Get(ctx context.Context, id string) (*Document, error)
+	Count(ctx context.Context) (int, error)
+}
+
+// Store 向量库，按名称管理集合
+type Store interface {
+	// Collection 获取集合，不存在时创建
+	Collection(name string) (Collection, error)
+	DeleteCollection(name string) error
+	// Persist 整理持久化存储，例如把预写日志合并成快照。写操作返回时已经持久化，直接写数据库的实现什么也不做
+	Persist() error
+}
+
+// TxStore 与业务数据保存在同一个数据库中的向量库，向量的写入可以和业务数据的修改放在同一个事务中
+type TxStore interface {
+	Store
+	// WithTx 返回在事务 tx 中读写的向量库
+	WithTx(tx *gorm.DB) Store
+}
+
+// normalize 归一化向量，归一化之后点积即为余弦相似度
+func normalize(v []float32) []float32 {
+	var norm float32
+	for _, item := range v {
+		norm += item * item
+	}
+	if norm == 0 {
+		return v
+	}
+	norm = float32(math.Sqrt(float64(norm)))
+	res := make([]float32, len(v))
+	for i, item := range v {
+		res[i] = item / norm
+	}
+	return res
+}
+
+func dot(a, b []float32) float32 {
+	var sum float32
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
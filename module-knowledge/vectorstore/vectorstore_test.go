@@ -0,0 +1,232 @@
+package vectorstore
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newSQLiteStore(t *testing.T) *SQLiteStore {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "vectors.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewSQLite(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func newChromemStore(t *testing.T, file string, key string) *ChromemStore {
+	store, err := NewChromem(ChromemOptions{
+		File:          file,
+		EncryptionKey: key,
+		CompactSize:   1 << 20,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+// stores 两种实现的行为应该一致，测试对每种实现各跑一遍
+func stores(t *testing.T) map[string]Store {
+	return map[string]Store{
+		"sqlite":  newSQLiteStore(t),
+		"chromem": newChromemStore(t, filepath.Join(t.TempDir(), "vectors.gob"), ""),
+	}
+}
+
+var testDocuments = []Document{
+	{
+		ID:        "a",
+		Content:   "出差住宿费每天不超过五百元",
+		Metadata:  map[string]string{"file": "1.docx", "file_name": "差旅制度.docx", "page": "0", "type": "text"},
+		Embedding: []float32{1, 0, 0},
+	},
+	{
+		ID:        "b",
+		Content:   "出差乘坐高铁二等座",
+		Metadata:  map[string]string{"file": "1.docx", "file_name": "差旅制度.docx", "page": "2", "type": "text"},
+		Embedding: []float32{0.8, 0.6, 0},
+	},
+	{
+		ID:        "c",
+		Content:   "机房每周巡检一次",
+		Metadata:  map[string]string{"file": "2.docx", "file_name": "机房管理.docx", "page": "10", "type": "text"},
+		Embedding: []float32{0.6, 0.8, 0},
+	},
+	{
+		ID:        "d",
+		Content:   "机房平面图",
+		Metadata:  map[string]string{"file": "2.docx", "file_name": "机房管理.docx", "page": "1", "type": "image"},
+		Embedding: []float32{0, 1, 0},
+	},
+}
+
+func ids(results []Result) []string {
+	var res []string
+	for _, item := range results {
+		res = append(res, item.ID)
+	}
+	return res
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func TestQueryFilter(t *testing.T) {
+	tests := []struct {
+		name   string
+		n      int
+		filter Filter
+		want   []string
+	}{
+		{
+			name: "不过滤",
+			n:    10,
+			want: []string{"a", "b", "c", "d"},
+		},
+		{
+			name:   "元数据等值",
+			n:      1,
+			filter: Filter{Where: map[string]string{"type": "image"}},
+			want:   []string{"d"},
+		},
+		{
+			name:   "内容包含",
+			n:      10,
+			filter: Filter{Contains: "出差"},
+			want:   []string{"a", "b"},
+		},
+		{
+			name:   "内容不包含",
+			n:      10,
+			filter: Filter{NotContains: "出差"},
+			want:   []string{"c", "d"},
+		},
+		{
+			// 先过滤再取前 n 个，否则最相似的 a 占满名额后没有结果
+			name:   "元数据包含",
+			n:      1,
+			filter: Filter{MetadataContains: map[string]string{"file_name": "机房"}},
+			want:   []string{"c"},
+		},
+		{
+			name:   "页码范围",
+			n:      1,
+			filter: Filter{Ranges: map[string]Range{"page": {From: intPtr(1), To: intPtr(5)}}},
+			want:   []string{"b"},
+		},
+		{
+			// 按整数而不是字符串比较，"10" 大于 "2"
+			name:   "页码下限",
+			n:      10,
+			filter: Filter{Ranges: map[string]Range{"page": {From: intPtr(2)}}},
+			want:   []string{"b", "c"},
+		},
+		{
+			name: "组合条件",
+			n:    10,
+			filter: Filter{
+				Where:            map[string]string{"type": "text"},
+				NotContains:      "住宿",
+				MetadataContains: map[string]string{"file": "docx"},
+				Ranges:           map[string]Range{"page": {To: intPtr(10)}},
+			},
+			want: []string{"b", "c"},
+		},
+		{
+			name:   "没有满足条件的分块",
+			n:      10,
+			filter: Filter{MetadataContains: map[string]string{"file_name": "报销"}},
+		},
+	}
+
+	ctx := context.Background()
+	for name, store := range stores(t) {
+		collection, err := store.Collection("kb_1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = collection.Add(ctx, testDocuments); err != nil {
+			t.Fatal(err)
+		}
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				results, err := collection.Query(ctx, []float32{1, 0, 0}, tt.n, tt.filter)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := ids(results); !reflect.DeepEqual(got, tt.want) {
+					t.Fatalf("Query() = %v, want %v", got, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestCollection(t *testing.T) {
+	ctx := context.Background()
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			collection, err := store.Collection("kb_1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = collection.Add(ctx, testDocuments); err != nil {
+				t.Fatal(err)
+			}
+			// 集合之间互不影响
+			other, _ := store.Collection("kb_2")
+			if err = other.Add(ctx, testDocuments[:1]); err != nil {
+				t.Fatal(err)
+			}
+
+			// ID 相同时覆盖
+			updated := testDocuments[0]
+			updated.Content = "出差住宿费每天不超过六百元"
+			if err = collection.Add(ctx, []Document{updated}); err != nil {
+				t.Fatal(err)
+			}
+			doc, err := collection.Get(ctx, "a")
+			if err != nil || doc == nil || doc.Content != updated.Content || doc.Metadata["page"] != "0" {
+				t.Fatalf("Get() = %+v, %v", doc, err)
+			}
+			if doc, _ = collection.Get(ctx, "x"); doc != nil {
+				t.Fatalf("Get() missing = %+v", doc)
+			}
+
+			if err = collection.Delete(ctx, map[string]string{"file": "2.docx"}); err != nil {
+				t.Fatal(err)
+			}
+			if count, _ := collection.Count(ctx); count != 2 {
+				t.Fatalf("count after delete = %d", count)
+			}
+			if err = collection.Delete(ctx, nil); err == nil {
+				t.Fatal("delete without where should be rejected")
+			}
+
+			if err = store.DeleteCollection("kb_2"); err != nil {
+				t.Fatal(err)
+			}
+			if other, _ = store.Collection("kb_2"); other != nil {
+				if count, _ := other.Count(ctx); count != 0 {
+					t.Fatalf("count of dropped collection = %d", count)
+				}
+			}
+			if count, _ := collection.Count(ctx); count != 2 {
+				t.Fatalf("dropping another collection changed count to %d", count)
+			}
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package vectorstore
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+
+	"github.com/unionj-cloud/toolkit/zlogger"
+)
+
+const (
+	walOpAdd    = "add"
+	walOpDelete = "delete"
+	walOpDrop   = "drop"
+)
+
+// 每条记录的头部：4 字节记录长度 + 4 字节 CRC32 校验和，均为大端序
+const walHeaderSize = 8
+
+// walRecord 预写日志中的一条写操作
+type walRecord struct {
+	Op         string
+	Collection string
+	Documents  []Document
+	Where      map[string]string
+}
+
+// wal 只追加的预写日志，每条记录写入后立即 fsync。配置了密钥时记录使用 AES-GCM 加密
+type wal struct {
+	f    *os.File
+	aead cipher.AEAD
+	size int64
+	// 追加失败后没能截断回去时记录的错误，之后的追加都返回该错误
+	err error
+}
+
+func openWAL(path string, encryptionKey string) (*wal, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &wal{
+		f: f,
+	}
+	if encryptionKey != "" {
+		block, err := aes.NewCipher([]byte(encryptionKey))
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if w.aead, err = cipher.NewGCM(block); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// replay 按写入顺序回放全部记录。最后一条记录不完整时视为上次写到一半崩溃，截断后忽略；
+// 中间的记录损坏、解密或者解码失败时返回错误
+func (receiver *wal) replay(fn func(record walRecord) error) error {
+	data, err := io.ReadAll(receiver.f)
+	if err != nil {
+		return err
+	}
+
+	var offset int64
+	for int(offset) < len(data) {
+		rest := data[offset:]
+		if len(rest) < walHeaderSize {
+			break
+		}
+		length := int64(binary.BigEndian.Uint32(rest[:4]))
+		checksum := binary.BigEndian.Uint32(rest[4:8])
+		if int64(len(rest)) < walHeaderSize+length {
+			break
+		}
+		payload := rest[walHeaderSize : walHeaderSize+length]
+		if crc32.ChecksumIEEE(payload) != checksum {
+			if int64(len(rest)) == walHeaderSize+length {
+				break
+			}
+			return fmt.Errorf("wal record at offset %d is corrupt", offset)
+		}
+
+		record, err := receiver.decode(payload)
+		if err != nil {
+			return fmt.Errorf("wal record at offset %d: %w", offset, err)
+		}
+		if err = fn(record); err != nil {
+			return fmt.Errorf("wal record at offset %d: %w", offset, err)
+		}
+		offset += walHeaderSize + length
+	}
+
+	if int(offset) < len(data) {
+		zlogger.Warn().Msgf("Discard %d bytes of incomplete wal record at offset %d", len(data)-int(offset), offset)
+		if err = receiver.f.Truncate(offset); err != nil {
+			return err
+		}
+	}
+	receiver.size = offset
+	_, err = receiver.f.Seek(offset, io.SeekStart)
+	return err
+}
+
+// append 追加一条记录并落盘
+func (receiver *wal) append(record walRecord) error {
+	if receiver.err != nil {
+		return receiver.err
+	}
+	payload, err := receiver.encode(record)
+	if err != nil {
+		return err
+	}
+
+	frame := make([]byte, walHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(frame[:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(frame[4:8], crc32.ChecksumIEEE(payload))
+	copy(frame[walHeaderSize:], payload)
+
+	if _, err = receiver.f.Write(frame); err != nil {
+		return receiver.rollback(err)
+	}
+	if err = receiver.f.Sync(); err != nil {
+		return receiver.rollback(err)
+	}
+	receiver.size += int64(len(frame))
+	return nil
+}
+
+// rollback 追加失败时把日志截断回追加之前的长度，写了一半的记录不会被之后追加的记录接在后面，
+// 没有落盘确认的记录也不会在下次启动时被回放。截断失败时日志不再接受追加
+func (receiver *wal) rollback(cause error) error {
+	if err := receiver.f.Truncate(receiver.size); err != nil {
+		receiver.err = fmt.Errorf("wal is broken after a failed append: %w", errors.Join(cause, err))
+		return receiver.err
+	}
+	if _, err := receiver.f.Seek(receiver.size, io.SeekStart); err != nil {
+		receiver.err = fmt.Errorf("wal is broken after a failed append: %w", errors.Join(cause, err))
+		return receiver.err
+	}
+	return cause
+}
+
+// reset 清空日志，在快照写入成功后调用
+func (receiver *wal) reset() error {
+	if err := receiver.f.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := receiver.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	receiver.size = 0
+	return receiver.f.Sync()
+}
+
+func (receiver *wal) close() error {
+	return receiver.f.Close()
+}
+
+func (receiver *wal) encode(record walRecord) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(record); err != nil {
+		return nil, err
+	}
+	if receiver.aead == nil {
+		return buf.Bytes(), nil
+	}
+
+	nonce := make([]byte, receiver.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return receiver.aead.Seal(nonce, nonce, buf.Bytes(), nil), nil
+}
+
+func (receiver *wal) decode(payload []byte) (walRecord, error) {
+	var record walRecord
+	if receiver.aead != nil {
+		nonceSize := receiver.aead.NonceSize()
+		if len(payload) < nonceSize {
+			return record, errors.New("encrypted record is too short")
+		}
+		var err error
+		if payload, err = receiver.aead.Open(nil, payload[:nonceSize], payload[nonceSize:], nil); err != nil {
+			return record, fmt.Errorf("couldn't decrypt record, please check the encryption key: %w", err)
+		}
+	}
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&record); err != nil {
+		return record, err
+	}
+	return record, nil
+}
@@ -0,0 +1,273 @@
+package vectorstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testKey = "0123456789abcdef0123456789abcdef"
+
+var testRecords = []walRecord{
+	{Op: walOpAdd, Collection: "kb_1", Documents: testDocuments[:2]},
+	{Op: walOpDelete, Collection: "kb_1", Where: map[string]string{"file": "1.docx"}},
+	{Op: walOpDrop, Collection: "kb_2"},
+}
+
+func openTestWAL(t *testing.T, path string, key string) *wal {
+	w, err := openWAL(path, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = w.close()
+	})
+	return w
+}
+
+func appendRecords(t *testing.T, w *wal, records []walRecord) {
+	for _, item := range records {
+		if err := w.append(item); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// replayAll 重新打开日志并回放全部记录
+func replayAll(t *testing.T, path string, key string) ([]walRecord, error) {
+	var records []walRecord
+	err := openTestWAL(t, path, key).replay(func(record walRecord) error {
+		records = append(records, record)
+		return nil
+	})
+	return records, err
+}
+
+func fileSize(t *testing.T, path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.Size()
+}
+
+func TestWALReplay(t *testing.T) {
+	for name, key := range map[string]string{"plain": "", "encrypted": testKey} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "vectors.gob.wal")
+			w := openTestWAL(t, path, key)
+			if err := w.replay(func(record walRecord) error { return nil }); err != nil {
+				t.Fatal(err)
+			}
+			appendRecords(t, w, testRecords)
+			if w.size != fileSize(t, path) {
+				t.Fatalf("size = %d, file size = %d", w.size, fileSize(t, path))
+			}
+
+			records, err := replayAll(t, path, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(records, testRecords) {
+				t.Fatalf("records = %+v", records)
+			}
+		})
+	}
+}
+
+func TestWALTrailingPartialFrame(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vectors.gob.wal")
+	appendRecords(t, openTestWAL(t, path, ""), testRecords[:2])
+	size := fileSize(t, path)
+
+	// 最后一条记录只写了头部和一部分内容
+	var frame bytes.Buffer
+	w := &wal{}
+	payload, err := w.encode(testRecords[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := make([]byte, walHeaderSize)
+	binary.BigEndian.PutUint32(header, uint32(len(payload)))
+	frame.Write(header)
+	frame.Write(payload[:len(payload)/2])
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = f.Write(frame.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	reopened := openTestWAL(t, path, "")
+	var records []walRecord
+	if err = reopened.replay(func(record walRecord) error {
+		records = append(records, record)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(records, testRecords[:2]) || fileSize(t, path) != size {
+		t.Fatalf("records = %+v, file size = %d, want %d", records, fileSize(t, path), size)
+	}
+
+	// 截断之后追加的记录可以正常回放
+	appendRecords(t, reopened, testRecords[2:])
+	if records, err = replayAll(t, path, ""); err != nil || !reflect.DeepEqual(records, testRecords) {
+		t.Fatalf("records = %+v, err = %v", records, err)
+	}
+}
+
+func TestWALChecksumMismatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vectors.gob.wal")
+	appendRecords(t, openTestWAL(t, path, ""), testRecords)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 最后一条记录的校验和不对，视为没有写完，截断后忽略
+	last := bytes.Clone(data)
+	last[len(last)-1] ^= 0xff
+	if err = os.WriteFile(path, last, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	records, err := replayAll(t, path, "")
+	if err != nil || !reflect.DeepEqual(records, testRecords[:2]) {
+		t.Fatalf("records = %+v, err = %v", records, err)
+	}
+
+	// 中间的记录损坏时返回错误，不会丢掉后面的记录
+	middle := bytes.Clone(data)
+	middle[walHeaderSize] ^= 0xff
+	if err = os.WriteFile(path, middle, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = replayAll(t, path, ""); err == nil || !strings.Contains(err.Error(), "offset 0 is corrupt") {
+		t.Fatalf("err = %v", err)
+	}
+	if fileSize(t, path) != int64(len(data)) {
+		t.Fatal("corrupt wal should not be truncated")
+	}
+}
+
+func TestWALEncryption(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vectors.gob.wal")
+	appendRecords(t, openTestWAL(t, path, testKey), testRecords)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte(testDocuments[0].Content)) || bytes.Contains(data, []byte("kb_1")) {
+		t.Fatal("encrypted wal contains plain text")
+	}
+
+	wrongKey := strings.Repeat("x", 32)
+	if _, err = replayAll(t, path, wrongKey); err == nil || !strings.Contains(err.Error(), "encryption key") {
+		t.Fatalf("err = %v", err)
+	}
+	if _, err = replayAll(t, path, ""); err == nil {
+		t.Fatal("encrypted wal should not be readable without the key")
+	}
+	if records, err := replayAll(t, path, testKey); err != nil || !reflect.DeepEqual(records, testRecords) {
+		t.Fatalf("records = %+v, err = %v", records, err)
+	}
+}
+
+func TestWALRollback(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vectors.gob.wal")
+	w := openTestWAL(t, path, "")
+	appendRecords(t, w, testRecords[:1])
+	size := w.size
+
+	// 写了一半失败，截断回追加之前的长度，之后追加的记录接在完整的记录后面
+	if _, err := w.f.Write([]byte{0, 0, 1}); err != nil {
+		t.Fatal(err)
+	}
+	cause := errors.New("no space left on device")
+	if err := w.rollback(cause); !errors.Is(err, cause) {
+		t.Fatalf("err = %v", err)
+	}
+	if fileSize(t, path) != size {
+		t.Fatalf("file size = %d, want %d", fileSize(t, path), size)
+	}
+	appendRecords(t, w, testRecords[1:])
+	if records, err := replayAll(t, path, ""); err != nil || !reflect.DeepEqual(records, testRecords) {
+		t.Fatalf("records = %+v, err = %v", records, err)
+	}
+
+	// 截断也失败时不再接受追加
+	_ = w.f.Close()
+	if err := w.append(testRecords[0]); err == nil {
+		t.Fatal("append to a closed wal should fail")
+	}
+	if err := w.append(testRecords[0]); err == nil || !strings.Contains(err.Error(), "wal is broken") {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestChromemCompaction(t *testing.T) {
+	for name, key := range map[string]string{"plain": "", "encrypted": testKey} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			file := filepath.Join(t.TempDir(), "vectors.gob")
+			store := newChromemStore(t, file, key)
+			collection, _ := store.Collection("kb_1")
+			if err := collection.Add(ctx, testDocuments[:2]); err != nil {
+				t.Fatal(err)
+			}
+
+			// 日志没有超过阈值时不合并
+			if err := store.Persist(); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := os.Stat(file); !os.IsNotExist(err) {
+				t.Fatalf("snapshot should not exist yet: %v", err)
+			}
+
+			store.opts.CompactSize = 1
+			if err := store.Persist(); err != nil {
+				t.Fatal(err)
+			}
+			if store.wal.size != 0 || fileSize(t, file+".wal") != 0 {
+				t.Fatalf("wal size after compaction = %d", store.wal.size)
+			}
+			if _, err := os.Stat(file + ".tmp"); !os.IsNotExist(err) {
+				t.Fatalf("temporary snapshot left behind: %v", err)
+			}
+
+			// 快照之后的写操作只在日志中，重新打开时先导入快照再回放日志
+			if err := collection.Add(ctx, testDocuments[2:]); err != nil {
+				t.Fatal(err)
+			}
+			if err := collection.Delete(ctx, map[string]string{"type": "image"}); err != nil {
+				t.Fatal(err)
+			}
+			_ = store.wal.close()
+
+			reopened := newChromemStore(t, file, key)
+			c, _ := reopened.Collection("kb_1")
+			results, err := c.Query(ctx, []float32{1, 0, 0}, 10, Filter{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := ids(results); !reflect.DeepEqual(got, []string{"a", "b", "c"}) {
+				t.Fatalf("documents after reopen = %v", got)
+			}
+
+			if key != "" {
+				if _, err = NewChromem(ChromemOptions{File: file, EncryptionKey: strings.Repeat("x", 32)}); err == nil {
+					t.Fatal("opening with a wrong key should fail")
+				}
+			}
+		})
+	}
+}
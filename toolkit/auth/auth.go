@@ -22,6 +22,7 @@ func init() {
 	authMiddleware = &AuthMiddleware{
 		JwtSecret:    conf.Auth.JwtSecret,
 		JwtExpiresIn: conf.Auth.JwtExpiresIn,
+		Admins:       conf.Auth.Admins,
 	}
 }
 
@@ -36,6 +37,7 @@ func Jwt(inner http.Handler) http.Handler {
 type AuthMiddleware struct {
 	JwtSecret    string
 	JwtExpiresIn time.Duration
+	Admins       []string
 }
 
 type UserInfo struct {
@@ -72,6 +74,18 @@ func (auth *AuthMiddleware) JwtToken(userInfo UserInfo) (token string, expire ti
 	return token, expire
 }
 
+// IsGuest 判断接口是否标注了 @role(guest)，不需要登录
+func IsGuest(routeName string) bool {
+	annotation, ok := framework.GetAnnotation(routeName, "@role")
+	return ok && slices.Contains(annotation.Params, "guest")
+}
+
+// Allowed 判断用户能否访问接口，@role(admin) 的接口只允许配置的管理员访问
+func (auth *AuthMiddleware) Allowed(routeName string, userInfo UserInfo) bool {
+	annotation, ok := framework.GetAnnotation(routeName, "@role")
+	return !ok || !slices.Contains(annotation.Params, "admin") || slices.Contains(auth.Admins, userInfo.Username)
+}
+
 func (auth *AuthMiddleware) Jwt(inner http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if strings.Contains(r.URL.Path, "/go-doudou/") || !strings.HasPrefix(r.URL.Path, "/module") {
@@ -82,8 +96,7 @@ func (auth *AuthMiddleware) Jwt(inner http.Handler) http.Handler {
 		paramsFromCtx := httprouter.ParamsFromContext(r.Context())
 		routeName := paramsFromCtx.MatchedRouteName()
 
-		annotation, ok := framework.GetAnnotation(routeName, "@role")
-		if ok && slices.Contains(annotation.Params, "guest") {
+		if IsGuest(routeName) {
 			inner.ServeHTTP(w, r)
 			return
 		}
@@ -111,6 +124,12 @@ func (auth *AuthMiddleware) Jwt(inner http.Handler) http.Handler {
 			panic(err)
 		}
 
+		if !auth.Allowed(routeName, userInfo) {
+			w.WriteHeader(403)
+			w.Write([]byte("Forbidden.\n"))
+			return
+		}
+
 		r = r.WithContext(NewUserInfoContext(r.Context(), userInfo))
 		inner.ServeHTTP(w, r)
 	})
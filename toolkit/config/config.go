@@ -17,6 +17,8 @@ type Config struct {
 	Auth struct {
 		JwtSecret    string
 		JwtExpiresIn time.Duration
+		// 可以访问 @role(admin) 接口的用户名，多个用逗号分隔
+		Admins []string `default:"admin"`
 	}
 }
 
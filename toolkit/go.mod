@@ -4,6 +4,8 @@ go 1.24.2
 
 require (
 	github.com/golang-jwt/jwt/v5 v5.2.2
+	github.com/samber/do v1.6.0
+	github.com/tmc/langchaingo v0.1.13
 	github.com/unionj-cloud/go-doudou/v2 v2.5.10-0.20250513123447-d49c3eaed91b
 	github.com/unionj-cloud/toolkit v0.0.7-0.20250511143810-22755c81f8cd
 )
@@ -0,0 +1,110 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+var (
+	_ Provider   = (*Fake)(nil)
+	_ llms.Model = (*Fake)(nil)
+)
+
+// Reply Fake 的一次回答。设置了流式回调时按顺序逐个输出 Chunks，最终的回答为全部 Chunks 拼接；
+// Err 不为空时先输出 Chunks 再返回该错误，用于模拟生成到一半失败
+type Reply struct {
+	Chunks []string
+	Err    error
+	// 输出每一段之前等待的时间，用于模拟生成较慢的模型
+	Delay time.Duration
+}
+
+// Fake 按脚本回放回答的大模型，不请求任何服务，既是 Provider 也是 llms.Model。
+// 每次调用按顺序取下一个回答，同时记录收到的消息供测试断言
+type Fake struct {
+	mu      sync.Mutex
+	replies []Reply
+	calls   [][]llms.MessageContent
+}
+
+// NewFake 创建按 replies 顺序回答的 Fake，回答用完后再调用返回错误
+func NewFake(replies ...Reply) *Fake {
+	return &Fake{
+		replies: replies,
+	}
+}
+
+func (receiver *Fake) New(opts Options) (llms.Model, error) {
+	return receiver, nil
+}
+
+// Script 追加回答
+func (receiver *Fake) Script(replies ...Reply) {
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+
+	receiver.replies = append(receiver.replies, replies...)
+}
+
+// Calls 返回每次调用收到的消息
+func (receiver *Fake) Calls() [][]llms.MessageContent {
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+
+	return append([][]llms.MessageContent(nil), receiver.calls...)
+}
+
+func (receiver *Fake) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	var opts llms.CallOptions
+	for _, item := range options {
+		item(&opts)
+	}
+
+	receiver.mu.Lock()
+	receiver.calls = append(receiver.calls, messages)
+	if len(receiver.replies) == 0 {
+		receiver.mu.Unlock()
+		return nil, errors.New("fake llm has no scripted reply left")
+	}
+	reply := receiver.replies[0]
+	receiver.replies = receiver.replies[1:]
+	receiver.mu.Unlock()
+
+	for _, chunk := range reply.Chunks {
+		if reply.Delay > 0 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(reply.Delay):
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if opts.StreamingFunc != nil {
+			if err := opts.StreamingFunc(ctx, []byte(chunk)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if reply.Err != nil {
+		return nil, reply.Err
+	}
+
+	return &llms.ContentResponse{
+		Choices: []*llms.ContentChoice{
+			{
+				Content:    strings.Join(reply.Chunks, ""),
+				StopReason: "stop",
+			},
+		},
+	}, nil
+}
+
+func (receiver *Fake) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, receiver, prompt, options...)
+}
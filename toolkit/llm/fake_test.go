@@ -0,0 +1,54 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+func TestFake(t *testing.T) {
+	ctx := context.Background()
+	boom := errors.New("boom")
+	fake := NewFake(Reply{
+		Chunks: []string{"你", "好"},
+	}, Reply{
+		Chunks: []string{"半"},
+		Err:    boom,
+	})
+
+	model, err := fake.New(Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var streamed string
+	resp, err := model.GenerateContent(ctx, []llms.MessageContent{
+		llms.TextParts(llms.ChatMessageTypeHuman, "hi"),
+	}, llms.WithStreamingFunc(func(ctx context.Context, chunk []byte) error {
+		streamed += string(chunk)
+		return nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if streamed != "你好" || resp.Choices[0].Content != "你好" {
+		t.Fatalf("streamed %q, content %q", streamed, resp.Choices[0].Content)
+	}
+
+	if _, err = model.Call(ctx, "again"); !errors.Is(err, boom) {
+		t.Fatalf("err = %v, want %v", err, boom)
+	}
+	if _, err = model.Call(ctx, "no more"); err == nil {
+		t.Fatal("expected an error when replies run out")
+	}
+
+	calls := fake.Calls()
+	if len(calls) != 3 {
+		t.Fatalf("calls = %d, want 3", len(calls))
+	}
+	if text := calls[1][0].Parts[0].(llms.TextContent).Text; text != "again" {
+		t.Fatalf("second call = %q", text)
+	}
+}
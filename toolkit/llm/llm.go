@@ -0,0 +1,47 @@
+package llm
+
+import (
+	"os"
+
+	"github.com/samber/do"
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/llms/openai"
+	"github.com/unionj-cloud/toolkit/stringutils"
+)
+
+// Options 创建大模型客户端的参数，各模块从自己的配置中读取
+type Options struct {
+	BaseUrl string
+	// 为空时使用环境变量 OPENAI_API_KEY
+	Token string
+	Model string
+}
+
+// Provider 按参数创建大模型客户端，通过 samber/do 注入，测试时替换成 Fake
+type Provider interface {
+	New(opts Options) (llms.Model, error)
+}
+
+func init() {
+	do.Provide[Provider](nil, func(injector *do.Injector) (Provider, error) {
+		return &OpenAIProvider{}, nil
+	})
+}
+
+var _ Provider = (*OpenAIProvider)(nil)
+
+// OpenAIProvider 调用 OpenAI 兼容接口的大模型
+type OpenAIProvider struct {
+}
+
+func (receiver *OpenAIProvider) New(opts Options) (llms.Model, error) {
+	token := opts.Token
+	if stringutils.IsEmpty(token) {
+		token = os.Getenv("OPENAI_API_KEY")
+	}
+	return openai.New(
+		openai.WithBaseURL(opts.BaseUrl),
+		openai.WithToken(token),
+		openai.WithModel(opts.Model),
+	)
+}
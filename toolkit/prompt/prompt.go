@@ -0,0 +1,132 @@
+package prompt
+
+import (
+	"context"
+	"strings"
+	"text/template"
+
+	"github.com/samber/do"
+	"github.com/unionj-cloud/toolkit/stringutils"
+	"github.com/unionj-cloud/toolkit/zlogger"
+)
+
+// Default 没有为知识库或者请求指定模板时使用的模板名称
+const Default = "default"
+
+// 内置模板，数据库中没有模板或者模板中对应的部分为空时使用
+const (
+	DefaultSystem = "You are a senior public policy researcher."
+	DefaultPrompt = "请结合下面给出的上下文信息回答问题，答案必须分条阐述，力求条理清晰，如果不知道可以回答不知道，但不要编造答案。" +
+		"引用上下文时在相应语句末尾用方括号标注上下文的序号，例如 [1]、[2][3]：\n" +
+		"{{range .Contexts}}[{{.Index}}] {{.Content}}\n{{end}}" +
+		"请回答：{{.Question}}\n\n\n"
+	DefaultVision = `上面是一张图片。请执行两项任务:
+1. 如果图片包含任何文字，请提取并返回所有可见文字。
+2. 详细描述图片中显示的内容。
+
+请按以下格式返回:
+图片文字: [图片中的所有文字，如果没有则返回"无文字"]
+图片描述: [对图片内容的详细描述]`
+)
+
+// Template 提示词模板的一个版本，使用 text/template 语法，可以引用 Vars 中的变量
+type Template struct {
+	Name string
+	// 为 0 时是内置模板
+	Version int
+	// 系统提示词
+	System string
+	// 带有检索上下文的问题
+	Prompt string
+	// 入库时解析图片的提示词
+	Vision string
+}
+
+// Vars 模板变量，例如 {{.Question}}、{{range .Contexts}}[{{.Index}}] {{.Content}}{{end}}
+type Vars struct {
+	Question string
+	Contexts []Context
+	History  []Turn
+	// 当前用户名，入库解析图片时为空
+	User string
+}
+
+// Context 放进提示词的一段检索上下文，Index 与回答中的引用序号一致
+type Context struct {
+	Index    int
+	Content  string
+	FileName string
+	// 从 0 开始
+	Page int
+}
+
+// Turn 历史对话中的一条消息，Role 为 user 或 assistant
+type Turn struct {
+	Role    string
+	Content string
+}
+
+// Store 保存提示词模板，通过 samber/do 注入，由 module-chat 提供
+type Store interface {
+	// Get 返回模板的指定版本，version 为 0 时返回当前启用的版本
+	Get(ctx context.Context, name string, version int) (Template, bool)
+}
+
+// Builtin 返回内置模板
+func Builtin() Template {
+	return Template{
+		Name:   Default,
+		System: DefaultSystem,
+		Prompt: DefaultPrompt,
+		Vision: DefaultVision,
+	}
+}
+
+// Lookup 查找模板，name 为空时使用 Default。没有注入 Store 或者模板不存在时返回内置模板和 false，
+// 模板中为空的部分用内置模板补全
+func Lookup(ctx context.Context, name string, version int) (Template, bool) {
+	if stringutils.IsEmpty(name) {
+		name = Default
+	}
+	builtin := Builtin()
+	store, err := do.Invoke[Store](nil)
+	if err != nil {
+		return builtin, false
+	}
+	tpl, ok := store.Get(ctx, name, version)
+	if !ok {
+		return builtin, false
+	}
+	if stringutils.IsEmpty(tpl.System) {
+		tpl.System = builtin.System
+	}
+	if stringutils.IsEmpty(tpl.Prompt) {
+		tpl.Prompt = builtin.Prompt
+	}
+	if stringutils.IsEmpty(tpl.Vision) {
+		tpl.Vision = builtin.Vision
+	}
+	return tpl, true
+}
+
+// ForKb 查找知识库配置的模板，配置的模板不存在时使用内置模板并记录警告
+func ForKb(ctx context.Context, name string) Template {
+	tpl, ok := Lookup(ctx, name, 0)
+	if !ok && stringutils.IsNotEmpty(name) && name != Default {
+		zlogger.Warn().Msgf("Prompt template %s not found, fall back to the built-in template", name)
+	}
+	return tpl
+}
+
+// Render 用 vars 渲染模板
+func Render(text string, vars Vars) (string, error) {
+	t, err := template.New("prompt").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var out strings.Builder
+	if err = t.Execute(&out, vars); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
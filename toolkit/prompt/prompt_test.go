@@ -0,0 +1,63 @@
+package prompt
+
+import (
+	"context"
+	"testing"
+
+	"github.com/samber/do"
+)
+
+type fakeStore map[string]Template
+
+func (receiver fakeStore) Get(ctx context.Context, name string, version int) (Template, bool) {
+	tpl, ok := receiver[name]
+	return tpl, ok
+}
+
+func TestRender(t *testing.T) {
+	got, err := Render(DefaultPrompt, Vars{
+		Question: "住宿费标准是多少",
+		Contexts: []Context{
+			{Index: 1, Content: "一类城市每天不超过五百元。"},
+			{Index: 2, Content: "二类城市每天不超过四百元。"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "请结合下面给出的上下文信息回答问题，答案必须分条阐述，力求条理清晰，如果不知道可以回答不知道，但不要编造答案。" +
+		"引用上下文时在相应语句末尾用方括号标注上下文的序号，例如 [1]、[2][3]：\n" +
+		"[1] 一类城市每天不超过五百元。\n[2] 二类城市每天不超过四百元。\n请回答：住宿费标准是多少\n\n\n"
+	if got != want {
+		t.Fatalf("Render = %q", got)
+	}
+
+	if _, err = Render("{{.Unknown}}", Vars{}); err == nil {
+		t.Fatal("unknown variables should fail")
+	}
+}
+
+func TestLookup(t *testing.T) {
+	ctx := context.Background()
+	if tpl, ok := Lookup(ctx, "legal", 0); ok || tpl.Version != 0 || tpl.System != DefaultSystem {
+		t.Fatalf("without a store Lookup should return the builtin template, got %+v", tpl)
+	}
+
+	do.OverrideValue[Store](nil, fakeStore{
+		"legal": {Name: "legal", Version: 2, System: "你是一名法律顾问。"},
+	})
+	tpl, ok := Lookup(ctx, "legal", 0)
+	if !ok || tpl.Version != 2 || tpl.System != "你是一名法律顾问。" || tpl.Prompt != DefaultPrompt || tpl.Vision != DefaultVision {
+		t.Fatalf("Lookup = %+v", tpl)
+	}
+	if tpl, ok = Lookup(ctx, "", 0); ok || tpl.Name != Default || tpl.Version != 0 {
+		t.Fatalf("Lookup = %+v", tpl)
+	}
+	// 知识库配置的模板不存在时使用内置模板
+	if tpl = ForKb(ctx, "finance"); tpl.Name != Default || tpl.Vision != DefaultVision {
+		t.Fatalf("ForKb = %+v", tpl)
+	}
+	if tpl = ForKb(ctx, "legal"); tpl.Version != 2 {
+		t.Fatalf("ForKb = %+v", tpl)
+	}
+}